@@ -0,0 +1,151 @@
+package e5s
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sufield/e5s/audit"
+	"github.com/sufield/e5s/internal/config"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// auditor writes a server's audit events to its sink.
+//
+// A nil *auditor stands for "auditing disabled": every method does nothing,
+// so callers need no special case.
+type auditor struct {
+	sink audit.Sink
+	// owned is the part of sink opened from the config, closed on shutdown
+	owned audit.Sink
+	// failing is set while the sink returns errors, so the failure is logged
+	// once rather than for every event
+	failing atomic.Bool
+}
+
+// newAuditor opens the sinks of an audit section and combines them with
+// extra (from WithAuditSink). Returns nil if no sink is configured.
+func newAuditor(section config.AuditSection, extra audit.Sink) (*auditor, error) {
+	var owned []audit.Sink
+	closeOwned := func() {
+		for _, s := range owned {
+			_ = s.Close()
+		}
+	}
+	if path := strings.TrimSpace(section.File); path != "" {
+		sink, err := audit.OpenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		owned = append(owned, sink)
+	}
+	if section.Stderr {
+		owned = append(owned, audit.Stderr())
+	}
+	if section.Syslog {
+		sink, err := audit.Syslog(strings.TrimSpace(section.SyslogTag))
+		if err != nil {
+			closeOwned()
+			return nil, err
+		}
+		owned = append(owned, sink)
+	}
+	if len(owned) == 0 && extra == nil {
+		return nil, nil
+	}
+	ownedSink := audit.Multi(owned...)
+	return &auditor{sink: audit.Multi(ownedSink, extra), owned: ownedSink}, nil
+}
+
+// emit writes e, stamping the time. Sink errors are logged, not returned:
+// auditing must not fail requests. Each failure is logged when it starts and
+// when writes succeed again, rather than once per dropped event.
+func (a *auditor) emit(e audit.Event) {
+	if a == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	if err := a.sink.Write(e); err != nil {
+		if !a.failing.Swap(true) {
+			log.Printf("e5s: failed to write audit event, events are being dropped: %v", err)
+		}
+		return
+	}
+	if a.failing.Load() && a.failing.Swap(false) {
+		log.Printf("e5s: audit events are being written again")
+	}
+}
+
+// handshake records a client verification.
+func (a *auditor) handshake(info spiffehttp.HandshakeInfo) {
+	if a == nil {
+		return
+	}
+	e := audit.Event{
+		Stage:      audit.StageHandshake,
+		Decision:   audit.Allow,
+		RemoteAddr: addrString(info.RemoteAddr),
+		Listener:   addrString(info.LocalAddr),
+	}
+	if !info.PeerID.IsZero() {
+		e.PeerID = info.PeerID.String()
+	}
+	if info.Err != nil {
+		e.Decision, e.Reason = audit.Deny, info.Err.Error()
+	}
+	a.emit(e)
+}
+
+// request records a per-request decision for r. rule names what decided it,
+// e.g. "rules[1]" for an authorization rule, and may be empty.
+func (a *auditor) request(r *http.Request, d spiffehttp.Decision, rule string) {
+	if a == nil {
+		return
+	}
+	e := audit.Event{
+		Stage:      audit.StageRequest,
+		Decision:   audit.Allow,
+		RemoteAddr: r.RemoteAddr,
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Status:     d.Status,
+		Rule:       rule,
+		Reason:     d.Reason,
+	}
+	if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		e.Listener = local.String()
+	}
+	if !d.PeerID.IsZero() {
+		e.PeerID = d.PeerID.String()
+	}
+	if !d.Allowed {
+		e.Decision = audit.Deny
+	}
+	a.emit(e)
+}
+
+// hook returns the spiffehttp decision hook recording decisions for r.
+func (a *auditor) hook(r *http.Request) func(spiffehttp.Decision) {
+	return func(d spiffehttp.Decision) {
+		a.request(r, d, d.Rule)
+	}
+}
+
+// Close closes the sinks opened from the config.
+func (a *auditor) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.owned.Close()
+}
+
+// addrString formats addr, which may be nil.
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
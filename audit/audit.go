@@ -0,0 +1,190 @@
+// Package audit records authorization decisions made by e5s servers as
+// structured events.
+//
+// Every client handshake and every per-route decision produces an Event: who
+// the peer was, where it connected from and to, what decided the outcome and
+// why. Events are written to a Sink. The package provides sinks for JSON
+// lines to a file or stderr and for the local syslog daemon; implement Sink
+// to ship events anywhere else.
+//
+// Enable it from e5s.yaml:
+//
+//	server:
+//	  audit:
+//	    file: /var/log/e5s/audit.jsonl
+//	    syslog: true
+//
+// or in code with e5s.WithAuditSink.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Stage is the point at which a decision was made.
+type Stage string
+
+const (
+	// StageHandshake is the client verification during the mTLS handshake.
+	StageHandshake Stage = "handshake"
+
+	// StageRequest is a per-request decision: authorization rules,
+	// spiffehttp.Require middleware or the deny list.
+	StageRequest Stage = "request"
+)
+
+// Outcome is the result of a decision.
+type Outcome string
+
+const (
+	// Allow means the peer was accepted.
+	Allow Outcome = "allow"
+
+	// Deny means the peer was rejected.
+	Deny Outcome = "deny"
+)
+
+// Event is one authorization decision. Its JSON form is one line of a JSON
+// lines sink; empty fields are omitted.
+type Event struct {
+	// Time is when the decision was made.
+	Time time.Time `json:"time"`
+
+	// Stage is where the decision was made.
+	Stage Stage `json:"stage"`
+
+	// Decision is allow or deny.
+	Decision Outcome `json:"decision"`
+
+	// PeerID is the client's SPIFFE ID, if it presented one that could be parsed.
+	PeerID string `json:"peer_id,omitempty"`
+
+	// RemoteAddr is the client's address.
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// Listener is the server address the client connected to.
+	Listener string `json:"listener,omitempty"`
+
+	// Method and Path identify the request, for request-stage events.
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+
+	// Status is the HTTP status of a denied request.
+	Status int `json:"status,omitempty"`
+
+	// Rule names what decided the request: "rules[2]" for the third
+	// authorization rule, "deny_list" for the deny list.
+	Rule string `json:"rule,omitempty"`
+
+	// Reason explains a denial.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Sink receives audit events.
+//
+// Write is called on the request and handshake paths, concurrently, and
+// must not block for long. Close releases the sink's resources; Write is not
+// called after Close.
+type Sink interface {
+	Write(e Event) error
+	Close() error
+}
+
+// jsonSink writes events as JSON lines.
+type jsonSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewJSONSink returns a sink writing each event to w as one line of JSON.
+// Writes are serialized, so w needs no locking of its own. Close does not
+// close w.
+func NewJSONSink(w io.Writer) Sink {
+	return &jsonSink{w: w}
+}
+
+// Stderr returns a sink writing JSON lines to standard error, for platforms
+// that collect container output.
+func Stderr() Sink {
+	return NewJSONSink(os.Stderr)
+}
+
+// OpenFile returns a sink appending JSON lines to the file at path, creating
+// it with mode 0600 if needed. Close closes the file.
+//
+// The file is opened once. To rotate it with logrotate, use copytruncate.
+func OpenFile(path string) (Sink, error) {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600) // #nosec G304 - Audit log path is trusted (from admin/user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &jsonSink{w: f, closer: f}, nil
+}
+
+// Write writes e as one line of JSON.
+func (s *jsonSink) Write(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+// Close closes the underlying file, if the sink opened one.
+func (s *jsonSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// multiSink writes each event to several sinks.
+type multiSink []Sink
+
+// Multi returns a sink writing each event to all of sinks, in order. Nil
+// sinks are skipped. Write and Close reach every sink and return their
+// errors joined.
+func Multi(sinks ...Sink) Sink {
+	var m multiSink
+	for _, s := range sinks {
+		if s != nil {
+			m = append(m, s)
+		}
+	}
+	return m
+}
+
+// Write writes e to every sink.
+func (m multiSink) Write(e Event) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink.
+func (m multiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package audit_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/sufield/e5s/audit"
+)
+
+// ExampleNewJSONSink shows the JSON lines written for a denied request.
+func ExampleNewJSONSink() {
+	sink := audit.NewJSONSink(os.Stdout)
+	defer sink.Close()
+
+	_ = sink.Write(audit.Event{
+		Time:       time.Date(2025, 11, 3, 9, 30, 0, 0, time.UTC),
+		Stage:      audit.StageRequest,
+		Decision:   audit.Deny,
+		PeerID:     "spiffe://example.org/billing",
+		RemoteAddr: "10.0.0.7:51234",
+		Listener:   "10.0.0.2:8443",
+		Method:     "POST",
+		Path:       "/admin/reload",
+		Status:     403,
+		Rule:       "rules[0]",
+		Reason:     `SPIFFE ID "spiffe://example.org/billing" is not allowed`,
+	})
+	// Output:
+	// {"time":"2025-11-03T09:30:00Z","stage":"request","decision":"deny","peer_id":"spiffe://example.org/billing","remote_addr":"10.0.0.7:51234","listener":"10.0.0.2:8443","method":"POST","path":"/admin/reload","status":403,"rule":"rules[0]","reason":"SPIFFE ID \"spiffe://example.org/billing\" is not allowed"}
+}
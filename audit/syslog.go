@@ -0,0 +1,47 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// syslogSink writes events to the local syslog daemon.
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+// Syslog returns a sink sending each event as a JSON message to the local
+// syslog daemon, with facility AUTH and the given tag ("e5s" if empty).
+// Allowed decisions are logged at severity INFO, denials at WARNING.
+//
+// Syslog is not available on Windows and Plan 9.
+func Syslog(tag string) (Sink, error) {
+	if tag == "" {
+		tag = "e5s"
+	}
+	w, err := syslog.New(syslog.LOG_AUTH|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &syslogSink{w: w}, nil
+}
+
+// Write sends e as one syslog message.
+func (s *syslogSink) Write(e Event) error {
+	msg, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if e.Decision == Deny {
+		return s.w.Warning(string(msg))
+	}
+	return s.w.Info(string(msg))
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package audit
+
+import "errors"
+
+// Syslog is not available on this platform and always returns an error.
+func Syslog(tag string) (Sink, error) {
+	return nil, errors.New("syslog audit sink is not supported on this platform")
+}
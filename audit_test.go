@@ -0,0 +1,83 @@
+package e5s
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sufield/e5s/audit"
+	"github.com/sufield/e5s/internal/config"
+)
+
+// flakySink is an audit sink whose writes fail while err is set.
+type flakySink struct {
+	mu     sync.Mutex
+	err    error
+	events []audit.Event
+}
+
+func (s *flakySink) Write(e audit.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *flakySink) Close() error { return nil }
+
+func (s *flakySink) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func TestAuditor_ReportsSinkFailures(t *testing.T) {
+	sink := &flakySink{}
+	a, err := newAuditor(config.AuditSection{}, sink)
+	if err != nil {
+		t.Fatalf("newAuditor() error = %v", err)
+	}
+	logs := captureLog(t)
+	event := audit.Event{Stage: audit.StageHandshake, Decision: audit.Allow}
+
+	a.emit(event)
+	if len(sink.events) != 1 || sink.events[0].Time.IsZero() {
+		t.Fatalf("events = %+v, want one stamped event", sink.events)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("successful write logged %q", logs.String())
+	}
+
+	// A failure episode is logged once, however many events are dropped
+	sink.fail(errors.New("disk full"))
+	for range 3 {
+		a.emit(event)
+	}
+	if n := strings.Count(logs.String(), "e5s: failed to write audit event, events are being dropped: disk full"); n != 1 {
+		t.Errorf("failure logged %d times, want once: %q", n, logs.String())
+	}
+
+	// Recovery is logged once too
+	logs.Reset()
+	sink.fail(nil)
+	a.emit(event)
+	a.emit(event)
+	if n := strings.Count(logs.String(), "e5s: audit events are being written again"); n != 1 {
+		t.Errorf("recovery logged %d times, want once: %q", n, logs.String())
+	}
+	if len(sink.events) != 3 {
+		t.Errorf("events written = %d, want 3", len(sink.events))
+	}
+
+	// A new failure is a new episode
+	logs.Reset()
+	sink.fail(errors.New("syslog down"))
+	a.emit(event)
+	if !strings.Contains(logs.String(), "syslog down") {
+		t.Errorf("second failure not logged, got %q", logs.String())
+	}
+}
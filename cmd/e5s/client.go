@@ -1,12 +1,14 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/sufield/e5s"
 )
@@ -60,7 +62,7 @@ func clientRequestCommand(args []string) error {
 	url := fs.String("url", "", "Server URL to request (required)")
 	method := fs.String("method", "GET", "HTTP method")
 	debug := fs.Bool("debug", false, "Enable debug output")
-	verbose := fs.Bool("verbose", false, "Show response headers")
+	verbose := fs.Bool("verbose", false, "Show the server's SPIFFE ID and response headers")
 
 	fs.Usage = func() {
 		fmt.Println(`Send an mTLS request using e5s client
@@ -73,7 +75,7 @@ FLAGS:
     --url string      Server URL to request (required)
     --method string   HTTP method (default: GET)
     --debug           Enable debug output (shows TLS handshake details)
-    --verbose         Show response headers
+    --verbose         Show the server's SPIFFE ID and response headers
 
 EXAMPLES:
     # Simple GET request
@@ -130,7 +132,7 @@ USE CASES:
 	if *debug {
 		log.Println("→ Creating e5s mTLS client...")
 	}
-	client, cleanup, err := e5s.Client(*config)
+	client, cleanup, err := e5s.Client(*config, e5s.WithServerPeerInContext(true))
 	if err != nil {
 		return fmt.Errorf("failed to create e5s client: %w", err)
 	}
@@ -160,8 +162,16 @@ USE CASES:
 	// Print response status
 	fmt.Printf("HTTP/%d.%d %d %s\n", resp.ProtoMajor, resp.ProtoMinor, resp.StatusCode, resp.Status)
 
-	// Print headers if verbose
+	// Print the server identity and headers if verbose, keeping stdout to the
+	// response itself
 	if *verbose || *debug {
+		if server, ok := e5s.ServerPeer(resp); ok {
+			fmt.Fprintf(os.Stderr, "* Server SPIFFE ID: %s\n", server.ID)
+			fmt.Fprintf(os.Stderr, "* Server address: %s\n", server.RemoteAddr)
+			fmt.Fprintf(os.Stderr, "* Server certificate: serial %x, expires %s\n", server.SerialNumber, server.ExpiresAt.Format(time.RFC3339))
+			fmt.Fprintf(os.Stderr, "* TLS: %s, %s\n", tls.VersionName(server.TLSVersion), tls.CipherSuiteName(server.CipherSuite))
+		}
+
 		for name, values := range resp.Header {
 			for _, value := range values {
 				fmt.Printf("%s: %s\n", name, value)
@@ -187,6 +197,9 @@ USE CASES:
 	if *debug {
 		log.Printf("✓ Request completed successfully")
 		log.Printf("  Status: %d", resp.StatusCode)
+		if server, ok := e5s.ServerPeer(resp); ok {
+			log.Printf("  Server: %s", server.ID)
+		}
 		log.Printf("  Body size: %d bytes", len(body))
 		if ct := resp.Header.Get("Content-Type"); ct != "" {
 			log.Printf("  Content-Type: %s", ct)
@@ -3,8 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/sufield/e5s/internal/config"
+	"github.com/sufield/e5s/spiffehttp"
 )
 
 func validateCommand(args []string) error {
@@ -71,8 +75,7 @@ func validateAuto(path string) error {
 	serverCfg, serverErr := config.LoadServerConfig(path)
 	if serverErr == nil {
 		// Validate server config
-		_, _, err := config.ValidateServerConfig(&serverCfg)
-		if err == nil {
+		if err := validateServer(&serverCfg); err == nil {
 			fmt.Println("✓ Detected server configuration")
 			return printServerConfig(&serverCfg, path)
 		}
@@ -82,8 +85,7 @@ func validateAuto(path string) error {
 	clientCfg, clientErr := config.LoadClientConfig(path)
 	if clientErr == nil {
 		// Validate client config
-		_, _, err := config.ValidateClientConfig(&clientCfg)
-		if err == nil {
+		if err := validateClient(&clientCfg); err == nil {
 			fmt.Println("✓ Detected client configuration")
 			return printClientConfig(&clientCfg, path)
 		}
@@ -99,8 +101,7 @@ func validateServerFile(path string) error {
 		return fmt.Errorf("failed to load server config: %w", err)
 	}
 
-	_, _, err = config.ValidateServerConfig(&cfg)
-	if err != nil {
+	if err := validateServer(&cfg); err != nil {
 		return fmt.Errorf("server validation failed: %w", err)
 	}
 
@@ -113,34 +114,57 @@ func validateClientFile(path string) error {
 		return fmt.Errorf("failed to load client config: %w", err)
 	}
 
-	_, _, err = config.ValidateClientConfig(&cfg)
-	if err != nil {
+	if err := validateClient(&cfg); err != nil {
 		return fmt.Errorf("client validation failed: %w", err)
 	}
 
 	return printClientConfig(&cfg, path)
 }
 
-func printServerConfig(cfg *config.ServerFileConfig, path string) error {
-	fmt.Printf("✓ Valid server configuration: %s\n", path)
-	fmt.Println("\nServer settings:")
-	fmt.Printf("  Listen address: %s\n", cfg.Server.ListenAddr)
+// validateServer validates a server config like e5s does when it starts,
+// including the syntax of SPIFFE ID patterns.
+func validateServer(cfg *config.ServerFileConfig) error {
+	_, authz, err := config.ValidateServerConfig(cfg)
+	if err != nil {
+		return err
+	}
+	return checkIDPatterns(authz.AllIDPatterns())
+}
 
-	if cfg.Server.AllowedClientSPIFFEID != "" {
-		fmt.Printf("  Authorization: Specific SPIFFE ID\n")
-		fmt.Printf("    Allowed client: %s\n", cfg.Server.AllowedClientSPIFFEID)
-		fmt.Println("  Security level: ✓ Zero-trust (recommended)")
-	} else if cfg.Server.AllowedClientTrustDomain != "" {
-		fmt.Printf("  Authorization: Trust domain\n")
-		fmt.Printf("    Allowed domain: %s\n", cfg.Server.AllowedClientTrustDomain)
-		fmt.Println("  Security level: ⚠ Permissive (use specific SPIFFE ID for production)")
+// validateClient validates a client config like e5s does when it starts,
+// including the syntax of SPIFFE ID patterns.
+func validateClient(cfg *config.ClientFileConfig) error {
+	_, authz, err := config.ValidateClientConfig(cfg)
+	if err != nil {
+		return err
 	}
+	return checkIDPatterns(authz.AllIDPatterns())
+}
 
-	fmt.Printf("\nSPIRE settings:\n")
-	fmt.Printf("  Workload socket: %s\n", cfg.SPIRE.WorkloadSocket)
-	if cfg.SPIRE.InitialFetchTimeout != "" {
-		fmt.Printf("  Initial fetch timeout: %s\n", cfg.SPIRE.InitialFetchTimeout)
+// checkIDPatterns parses the SPIFFE ID patterns collected by config, which
+// leaves their syntax to spiffehttp.
+func checkIDPatterns(patterns []config.IDPattern) error {
+	for _, p := range patterns {
+		if _, err := spiffehttp.ParseIDPattern(p.Pattern); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", p.Field, p.Pattern, err)
+		}
 	}
+	return nil
+}
+
+func printServerConfig(cfg *config.ServerFileConfig, path string) error {
+	fmt.Printf("✓ Valid server configuration: %s\n", path)
+	for _, name := range cfg.SectionNames() {
+		section, _ := cfg.Section(name)
+		if name == "" {
+			fmt.Println("\nServer settings:")
+		} else {
+			fmt.Printf("\nServer settings (%s):\n", name)
+		}
+		printServerSection(section)
+	}
+
+	printIdentity(cfg.SPIRE, cfg.Identity)
 
 	return nil
 }
@@ -150,21 +174,137 @@ func printClientConfig(cfg *config.ClientFileConfig, path string) error {
 	fmt.Println("\nClient settings:")
 	fmt.Println("  Note: Server URL should be passed via SERVER_URL env var or -url flag")
 
-	if cfg.Client.ExpectedServerSPIFFEID != "" {
+	ids := nonEmpty(cfg.Client.ExpectedServerSPIFFEID, cfg.Client.ExpectedServerSPIFFEIDs)
+	tds := nonEmpty(cfg.Client.ExpectedServerTrustDomain, cfg.Client.ExpectedServerTrustDomains)
+	if len(ids) > 0 {
 		fmt.Printf("  Server verification: Specific SPIFFE ID\n")
-		fmt.Printf("    Expected server: %s\n", cfg.Client.ExpectedServerSPIFFEID)
-		fmt.Println("  Security level: ✓ Zero-trust (recommended)")
-	} else if cfg.Client.ExpectedServerTrustDomain != "" {
+		for _, id := range ids {
+			fmt.Printf("    Expected server: %s\n", id)
+		}
+	}
+	if len(tds) > 0 {
 		fmt.Printf("  Server verification: Trust domain\n")
-		fmt.Printf("    Expected domain: %s\n", cfg.Client.ExpectedServerTrustDomain)
+		for _, td := range tds {
+			fmt.Printf("    Expected domain: %s\n", td)
+		}
+	}
+	if patterns := nonEmpty("", cfg.Client.ExpectedServerSPIFFEIDPatterns); len(patterns) > 0 {
+		fmt.Printf("  Server verification: SPIFFE ID pattern\n")
+		for _, p := range patterns {
+			fmt.Printf("    Expected pattern: %s\n", p)
+		}
+	}
+	if len(tds) > 0 {
 		fmt.Println("  Security level: ⚠ Permissive (use specific SPIFFE ID for production)")
+	} else if len(ids) > 0 {
+		fmt.Println("  Security level: ✓ Zero-trust (recommended)")
 	}
+	if len(cfg.Client.Destinations) > 0 {
+		fmt.Println("  Per-destination server verification:")
+		hosts := make([]string, 0, len(cfg.Client.Destinations))
+		for host := range cfg.Client.Destinations {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		for _, host := range hosts {
+			d := cfg.Client.Destinations[host]
+			expected := slices.Concat(
+				nonEmpty(d.ExpectedServerSPIFFEID, d.ExpectedServerSPIFFEIDs),
+				nonEmpty(d.ExpectedServerTrustDomain, d.ExpectedServerTrustDomains),
+				nonEmpty("", d.ExpectedServerSPIFFEIDPatterns),
+			)
+			fmt.Printf("    %s: %s\n", host, strings.Join(expected, ", "))
+		}
+		if len(ids) == 0 && len(tds) == 0 && len(nonEmpty("", cfg.Client.ExpectedServerSPIFFEIDPatterns)) == 0 {
+			fmt.Println("    Other hosts: rejected")
+		}
+	}
+
+	printIdentity(cfg.SPIRE, cfg.Identity)
+
+	return nil
+}
 
+// printIdentity prints where the process gets its SVID: the identity files in
+// files mode, the local CA in dev mode, otherwise the SPIRE Workload API.
+func printIdentity(spire config.SPIRESection, identity config.IdentitySection) {
+	switch strings.TrimSpace(identity.Mode) {
+	case config.IdentityModeDev:
+		fmt.Printf("\nDev identity (insecure, local development only):\n")
+		fmt.Printf("  SPIFFE ID: %s\n", identity.SPIFFEID)
+		if identity.SVIDTTL != "" {
+			fmt.Printf("  SVID TTL: %s\n", identity.SVIDTTL)
+		}
+		if identity.CAKeyFile != "" {
+			fmt.Printf("  CA key file: %s\n", identity.CAKeyFile)
+		}
+		fmt.Println("  ⚠ Requires E5S_ALLOW_DEV_IDENTITY=1 at startup")
+		return
+	case config.IdentityModeFiles:
+		fmt.Printf("\nIdentity files:\n")
+		fmt.Printf("  Certificate: %s\n", identity.CertFile)
+		fmt.Printf("  Key: %s\n", identity.KeyFile)
+		fmt.Printf("  Bundle: %s\n", identity.BundleFile)
+		if identity.PollInterval != "" {
+			fmt.Printf("  Poll interval: %s\n", identity.PollInterval)
+		}
+		return
+	}
 	fmt.Printf("\nSPIRE settings:\n")
-	fmt.Printf("  Workload socket: %s\n", cfg.SPIRE.WorkloadSocket)
-	if cfg.SPIRE.InitialFetchTimeout != "" {
-		fmt.Printf("  Initial fetch timeout: %s\n", cfg.SPIRE.InitialFetchTimeout)
+	fmt.Printf("  Workload socket: %s\n", spire.WorkloadSocket)
+	if spire.InitialFetchTimeout != "" {
+		fmt.Printf("  Initial fetch timeout: %s\n", spire.InitialFetchTimeout)
 	}
+}
 
-	return nil
+func printServerSection(server config.ServerSection) {
+	fmt.Printf("  Listen address: %s\n", server.ListenAddr)
+
+	ids := nonEmpty(server.AllowedClientSPIFFEID, server.AllowedClientSPIFFEIDs)
+	tds := nonEmpty(server.AllowedClientTrustDomain, server.AllowedClientTrustDomains)
+	if len(ids) > 0 {
+		fmt.Printf("  Authorization: Specific SPIFFE ID\n")
+		for _, id := range ids {
+			fmt.Printf("    Allowed client: %s\n", id)
+		}
+	}
+	if len(tds) > 0 {
+		fmt.Printf("  Authorization: Trust domain\n")
+		for _, td := range tds {
+			fmt.Printf("    Allowed domain: %s\n", td)
+		}
+	}
+	if patterns := nonEmpty("", server.AllowedClientSPIFFEIDPatterns); len(patterns) > 0 {
+		fmt.Printf("  Authorization: SPIFFE ID pattern\n")
+		for _, p := range patterns {
+			fmt.Printf("    Allowed pattern: %s\n", p)
+		}
+	}
+	if len(tds) > 0 {
+		fmt.Println("  Security level: ⚠ Permissive (use specific SPIFFE ID for production)")
+	} else if len(ids) > 0 {
+		fmt.Println("  Security level: ✓ Zero-trust (recommended)")
+	}
+	if rules := server.Authorization.Rules; len(rules) > 0 {
+		fmt.Printf("  Route authorization: %d rules, deny by default\n", len(rules))
+		for _, rule := range rules {
+			methods := "ANY"
+			if len(rule.Methods) > 0 {
+				methods = strings.Join(rule.Methods, ",")
+			}
+			allowed := append(append(append([]string{}, rule.AllowedSPIFFEIDs...), rule.AllowedSPIFFEIDPatterns...), rule.AllowedTrustDomains...)
+			fmt.Printf("    %s %s -> %s\n", methods, rule.Path, strings.Join(allowed, ", "))
+		}
+	}
+}
+
+// nonEmpty returns single followed by list, skipping blank values.
+func nonEmpty(single string, list []string) []string {
+	var out []string
+	for _, v := range append([]string{single}, list...) {
+		if strings.TrimSpace(v) != "" {
+			out = append(out, v)
+		}
+	}
+	return out
 }
@@ -0,0 +1,52 @@
+package e5s
+
+import "github.com/sufield/e5s/internal/config"
+
+// ServerConfig is the in-memory form of an e5s server configuration file.
+//
+// It has exactly the same fields and YAML tags as the file read by Start(), so
+// a configuration assembled in code is validated with the same rules as
+// e5s.yaml. Pass it to StartWithConfig().
+type ServerConfig = config.ServerFileConfig
+
+// ClientConfig is the in-memory form of an e5s client configuration file.
+//
+// It has exactly the same fields and YAML tags as the file read by Client(), so
+// a configuration assembled in code is validated with the same rules as
+// e5s.yaml. Pass it to NewClient().
+type ClientConfig = config.ClientFileConfig
+
+// SPIRESection is the "spire" section of ServerConfig and ClientConfig.
+type SPIRESection = config.SPIRESection
+
+// IdentitySection is the "identity" section of ServerConfig, ClientConfig
+// and Config, selecting where the SVID and trust bundle come from.
+type IdentitySection = config.IdentitySection
+
+// ServerSection is the "server" section of ServerConfig.
+type ServerSection = config.ServerSection
+
+// AuditSection is the "audit" section of a ServerSection.
+type AuditSection = config.AuditSection
+
+// AuthorizationSection is the "authorization" section of a ServerSection.
+type AuthorizationSection = config.AuthorizationSection
+
+// AuthorizationRule is one entry of AuthorizationSection.Rules.
+type AuthorizationRule = config.AuthorizationRule
+
+// NamedServerSection is one entry of the "servers" list of ServerConfig.
+type NamedServerSection = config.NamedServerSection
+
+// ClientSection is the "client" section of ClientConfig.
+type ClientSection = config.ClientSection
+
+// DestinationSection is one entry of the "client.destinations" map of ClientConfig.
+type DestinationSection = config.DestinationSection
+
+// TransportSection is the "client.transport" section of ClientConfig.
+type TransportSection = config.TransportSection
+
+// Config is the in-memory form of a combined e5s configuration file, with
+// both a server and a client section. It is read by New() and NewWithConfig().
+type Config = config.FileConfig
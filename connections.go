@@ -0,0 +1,76 @@
+package e5s
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// Connection describes a live mTLS connection from a client to a Server.
+type Connection struct {
+	// ID is the client's SPIFFE ID.
+	ID spiffeid.ID
+
+	// RemoteAddr is the client's network address.
+	RemoteAddr string
+
+	// Established is when the connection served its first request, right
+	// after the handshake.
+	Established time.Time
+
+	// Requests is how many requests the connection has served, including
+	// the one in flight.
+	Requests uint64
+
+	// ExpiresAt is when the client's certificate chain expires. The server
+	// closes the connection once it has passed.
+	ExpiresAt time.Time
+}
+
+// Connections returns the server's live client connections, keyed by the
+// client's SPIFFE ID, oldest first.
+//
+// Connections are listed from their first request until they are closed.
+// Hijacked connections (WebSockets, raw streams) stay listed until their
+// client's certificate expires or they are disconnected. max_connection_age
+// does not close them, but they are closed once the client stops being
+// trusted, like any other connection.
+//
+// Usage:
+//
+//	for id, conns := range srv.Connections() {
+//	    for _, c := range conns {
+//	        log.Printf("%s from %s since %s, %d requests", id, c.RemoteAddr, c.Established, c.Requests)
+//	    }
+//	}
+func (s *Server) Connections() map[spiffeid.ID][]Connection {
+	return s.conns.list()
+}
+
+// Disconnect closes every live connection whose client's SPIFFE ID matches
+// pattern and returns how many were closed. Requests in flight on those
+// connections fail.
+//
+// pattern is a SPIFFE ID or an ID pattern as described in spiffehttp.IDPattern,
+// such as "spiffe://example.org/ns/billing/*".
+//
+// Disconnected clients can connect again straight away. To keep a
+// compromised workload out, add it to server.deny_list_file first, then
+// disconnect it: the new handshake is rejected.
+//
+// Usage:
+//
+//	n, err := srv.Disconnect("spiffe://example.org/ns/billing/sa/api")
+//	if err != nil {
+//	    return err
+//	}
+//	log.Printf("closed %d connections", n)
+func (s *Server) Disconnect(pattern string) (int, error) {
+	p, err := spiffehttp.ParseIDPattern(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("invalid SPIFFE ID pattern %q: %w", pattern, err)
+	}
+	return s.conns.disconnect(p), nil
+}
@@ -0,0 +1,386 @@
+package e5s
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// connectionCheckInterval is how often tracked connections are checked
+// against their peer's certificate expiry, the current trust bundles and
+// server.max_connection_age.
+const connectionCheckInterval = 5 * time.Second
+
+// connTracker tracks the live mTLS connections of a server or client, because
+// authorization only happens during the handshake: without it an HTTP/2 or
+// keep-alive connection would outlive its peer's certificate or a CA removed
+// from the trust bundle.
+//
+// Every connectionCheckInterval, connections whose peer certificate chain has
+// expired or no longer verifies against the current bundle are closed,
+// failing any request in flight on them. Server connections older than
+// maxAge are closed as soon as they have no request in flight.
+//
+// Hijacked server connections (WebSockets, raw streams) belong to their
+// handler: they are never closed for their age, but they are closed like
+// any other connection once their peer is no longer trusted.
+//
+// On servers it is also the registry behind Server.Connections and
+// Server.Disconnect.
+//
+// A nil *connTracker stands for "no tracking": every method does nothing, so
+// callers need no special case.
+type connTracker struct {
+	bundles x509bundle.Source
+	maxAge  time.Duration
+
+	mu    sync.Mutex
+	conns map[net.Conn]*trackedConn
+
+	started  atomic.Bool
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// trackedConn is one live connection.
+type trackedConn struct {
+	conn net.Conn
+	id   spiffeid.ID
+	// chain is the certificates the peer sent, leaf first
+	chain       []*x509.Certificate
+	expiresAt   time.Time
+	established time.Time
+	// bundle is the trust bundle chain last verified against
+	bundle *x509bundle.Bundle
+	// idle is set while the server has no request in flight on the
+	// connection
+	idle bool
+	// hijacked is set once a handler took over the connection
+	hijacked bool
+	// retiring is set once the connection exceeded maxAge
+	retiring bool
+	// requests counts the requests served on the connection
+	requests uint64
+}
+
+// newConnTracker returns a tracker verifying peers against bundles. maxAge
+// of 0 disables age-based closing.
+func newConnTracker(bundles x509bundle.Source, maxAge time.Duration) *connTracker {
+	return &connTracker{
+		bundles: bundles,
+		maxAge:  maxAge,
+		conns:   make(map[net.Conn]*trackedConn),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start checks the tracked connections in the background until Stop.
+func (t *connTracker) Start() {
+	if t == nil || t.started.Swap(true) {
+		return
+	}
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(connectionCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				t.check(time.Now())
+			}
+		}
+	}()
+}
+
+// Stop ends background checking and waits for a check in progress, so the
+// bundle source can be closed afterwards. Connections are left open. Safe to
+// call more than once, and without Start.
+func (t *connTracker) Stop() {
+	if t == nil {
+		return
+	}
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+	if t.started.Load() {
+		<-t.done
+	}
+}
+
+// add starts tracking conn, whose handshake produced state. Connections
+// without a SPIFFE peer are ignored.
+func (t *connTracker) add(conn net.Conn, state tls.ConnectionState) {
+	if len(state.PeerCertificates) == 0 {
+		return
+	}
+	id, err := x509svid.IDFromCert(state.PeerCertificates[0])
+	if err != nil {
+		return
+	}
+	tc := &trackedConn{
+		conn:        conn,
+		id:          id,
+		chain:       state.PeerCertificates,
+		expiresAt:   state.PeerCertificates[0].NotAfter,
+		established: time.Now(),
+	}
+	for _, cert := range state.PeerCertificates[1:] {
+		if cert.NotAfter.Before(tc.expiresAt) {
+			tc.expiresAt = cert.NotAfter
+		}
+	}
+	// The chain was just verified against the current bundle
+	if bundle, err := t.bundles.GetX509BundleForTrustDomain(id.TrustDomain()); err == nil {
+		tc.bundle = bundle
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.conns[conn] = tc
+}
+
+// context key type (unexported) to avoid collisions with keys from other packages.
+type trackedConnCtxKey struct{}
+
+var trackedConnKey = trackedConnCtxKey{}
+
+// withConn returns ctx carrying conn, so track can attribute requests to it.
+// It is part of a tracked server's ConnContext.
+func (t *connTracker) withConn(ctx context.Context, conn net.Conn) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, trackedConnKey, conn)
+}
+
+// track wraps next so that every request is counted against its connection.
+func (t *connTracker) track(next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, ok := r.Context().Value(trackedConnKey).(net.Conn); ok {
+			t.mu.Lock()
+			if tc, ok := t.conns[conn]; ok {
+				tc.requests++
+			}
+			t.mu.Unlock()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// list returns the tracked connections grouped by peer, oldest first.
+func (t *connTracker) list() map[spiffeid.ID][]Connection {
+	conns := make(map[spiffeid.ID][]Connection)
+	if t == nil {
+		return conns
+	}
+	t.mu.Lock()
+	for _, tc := range t.conns {
+		conns[tc.id] = append(conns[tc.id], Connection{
+			ID:          tc.id,
+			RemoteAddr:  addrString(tc.conn.RemoteAddr()),
+			Established: tc.established,
+			Requests:    tc.requests,
+			ExpiresAt:   tc.expiresAt,
+		})
+	}
+	t.mu.Unlock()
+
+	for _, list := range conns {
+		slices.SortFunc(list, func(a, b Connection) int {
+			return a.Established.Compare(b.Established)
+		})
+	}
+	return conns
+}
+
+// disconnect closes the tracked connections whose peer matches pattern and
+// returns how many were closed.
+func (t *connTracker) disconnect(pattern *spiffehttp.IDPattern) int {
+	if t == nil {
+		return 0
+	}
+	var toClose []*trackedConn
+	t.mu.Lock()
+	for conn, tc := range t.conns {
+		if _, ok := pattern.Match(tc.id); ok {
+			toClose = append(toClose, tc)
+			delete(t.conns, conn)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, tc := range toClose {
+		debugf("disconnecting %s (%s): matches %q", tc.conn.RemoteAddr(), tc.id, pattern)
+		_ = tc.conn.Close()
+	}
+	return len(toClose)
+}
+
+// remove stops tracking conn.
+func (t *connTracker) remove(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, conn)
+}
+
+// connState is the http.Server.ConnState hook of a tracked server.
+func (t *connTracker) connState(conn net.Conn, state http.ConnState) {
+	if t == nil {
+		return
+	}
+	switch state {
+	case http.StateActive, http.StateIdle, http.StateHijacked:
+		t.mu.Lock()
+		tc, ok := t.conns[conn]
+		if ok {
+			tc.idle = state == http.StateIdle
+			tc.hijacked = state == http.StateHijacked
+		}
+		retire := ok && tc.idle && tc.retiring
+		if retire {
+			delete(t.conns, conn)
+		}
+		t.mu.Unlock()
+
+		if !ok && state == http.StateActive {
+			// The handshake is complete once the first request arrives
+			if tlsConn, isTLS := conn.(*tls.Conn); isTLS {
+				t.add(conn, tlsConn.ConnectionState())
+			}
+		}
+		if retire {
+			_ = conn.Close()
+		}
+	case http.StateClosed:
+		t.remove(conn)
+	}
+}
+
+// dialContext wraps dial so that the connections it returns stop being
+// tracked when closed. Clients pair it with withClientTrace.
+func (t *connTracker) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if t == nil {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &trackedNetConn{Conn: conn, tracker: t}, nil
+	}
+}
+
+// trackedNetConn is a client connection that stops being tracked when closed.
+type trackedNetConn struct {
+	net.Conn
+	tracker *connTracker
+}
+
+// Close closes the connection and stops tracking it.
+func (c *trackedNetConn) Close() error {
+	c.tracker.remove(c)
+	return c.Conn.Close()
+}
+
+// withClientTrace returns ctx set up to track the connection a client request
+// gets, if it is a new one.
+func (t *connTracker) withClientTrace(ctx context.Context) context.Context {
+	if t == nil {
+		return ctx
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				return
+			}
+			tlsConn, ok := info.Conn.(*tls.Conn)
+			if !ok {
+				return
+			}
+			// Key by the dialed connection, which removes itself when closed
+			if conn, ok := tlsConn.NetConn().(*trackedNetConn); ok {
+				t.add(conn, tlsConn.ConnectionState())
+			}
+		},
+	})
+}
+
+// check closes the connections whose peer is no longer trusted and, once
+// idle, those older than maxAge. Hijacked connections are never closed for
+// their age.
+func (t *connTracker) check(now time.Time) {
+	type closing struct {
+		tc     *trackedConn
+		reason error
+	}
+	var toClose []closing
+
+	t.mu.Lock()
+	for conn, tc := range t.conns {
+		if err := t.verify(tc, now); err != nil {
+			toClose = append(toClose, closing{tc, err})
+			delete(t.conns, conn)
+			continue
+		}
+		if t.maxAge > 0 && !tc.hijacked && now.Sub(tc.established) >= t.maxAge {
+			tc.retiring = true
+			if tc.idle {
+				toClose = append(toClose, closing{tc, nil})
+				delete(t.conns, conn)
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	// Closing outside the lock: a closed client connection removes itself
+	for _, c := range toClose {
+		if c.reason != nil {
+			debugf("closing connection with %s (%s): %v", c.tc.conn.RemoteAddr(), c.tc.id, c.reason)
+		} else {
+			debugf("closing connection with %s (%s): older than max_connection_age %v", c.tc.conn.RemoteAddr(), c.tc.id, t.maxAge)
+		}
+		_ = c.tc.conn.Close()
+	}
+}
+
+// verify reports why tc's peer is no longer trusted at now, or nil. The chain
+// is only verified again when the trust bundle has changed.
+func (t *connTracker) verify(tc *trackedConn, now time.Time) error {
+	if now.After(tc.expiresAt) {
+		return fmt.Errorf("peer certificate expired at %s", tc.expiresAt.UTC().Format(time.RFC3339))
+	}
+	bundle, err := t.bundles.GetX509BundleForTrustDomain(tc.id.TrustDomain())
+	if err != nil {
+		return fmt.Errorf("no trust bundle for the peer: %w", err)
+	}
+	if bundle == tc.bundle || (tc.bundle != nil && bundle.Equal(tc.bundle)) {
+		tc.bundle = bundle
+		return nil
+	}
+	if _, _, err := x509svid.Verify(tc.chain, bundle); err != nil {
+		return fmt.Errorf("peer certificate no longer verifies against the trust bundle: %w", err)
+	}
+	tc.bundle = bundle
+	return nil
+}
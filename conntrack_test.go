@@ -0,0 +1,265 @@
+package e5s
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// closeRecorder is a connection that records whether it was closed.
+type closeRecorder struct {
+	net.Conn
+	closed atomic.Bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed.Store(true)
+	return c.Conn.Close()
+}
+
+// newTestConn returns one end of an in-memory connection.
+func newTestConn(t *testing.T) *closeRecorder {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+	return &closeRecorder{Conn: server}
+}
+
+// addTestConn tracks a new connection from id, whose SVID is valid until
+// notAfter.
+func addTestConn(t *testing.T, tracker *connTracker, ca *testCA, id string, notAfter time.Time) *closeRecorder {
+	t.Helper()
+	conn := newTestConn(t)
+	tracker.add(conn, tls.ConnectionState{PeerCertificates: ca.chain(t, id, notAfter)})
+	return conn
+}
+
+// tracked reports whether tracker still tracks conn.
+func tracked(tracker *connTracker, conn net.Conn) bool {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	_, ok := tracker.conns[conn]
+	return ok
+}
+
+func TestConnTracker_ClosesExpiredPeers(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	tracker := newConnTracker(ca.bundle(), 0)
+	now := time.Now()
+	conn := addTestConn(t, tracker, ca, "spiffe://example.org/client", now.Add(time.Hour))
+
+	tracker.check(now)
+	if conn.closed.Load() || !tracked(tracker, conn) {
+		t.Fatal("connection closed before its peer certificate expired")
+	}
+
+	tracker.check(now.Add(2 * time.Hour))
+	if !conn.closed.Load() {
+		t.Error("connection with an expired peer certificate was not closed")
+	}
+	if tracked(tracker, conn) {
+		t.Error("closed connection is still tracked")
+	}
+}
+
+func TestConnTracker_ClosesPeersNoLongerTrusted(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	bundles := x509bundle.NewSet(ca.bundle())
+	tracker := newConnTracker(bundles, 0)
+	now := time.Now()
+	conn := addTestConn(t, tracker, ca, "spiffe://example.org/client", now.Add(time.Hour))
+
+	// Same authorities in a new bundle: nothing changes
+	bundles.Add(ca.bundle())
+	tracker.check(now)
+	if conn.closed.Load() {
+		t.Fatal("connection closed after the bundle was refreshed with the same CA")
+	}
+
+	// The CA was replaced: the chain no longer verifies
+	bundles.Add(newTestCA(t, "example.org").bundle())
+	tracker.check(now)
+	if !conn.closed.Load() {
+		t.Error("connection whose CA was removed from the bundle was not closed")
+	}
+
+	// No bundle at all for the peer's trust domain
+	conn = addTestConn(t, tracker, ca, "spiffe://example.org/client", now.Add(time.Hour))
+	bundles.Remove(ca.td)
+	tracker.check(now)
+	if !conn.closed.Load() {
+		t.Error("connection without a trust bundle for its peer was not closed")
+	}
+}
+
+func TestConnTracker_MaxAge(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	tracker := newConnTracker(ca.bundle(), time.Minute)
+	now := time.Now()
+	idle := addTestConn(t, tracker, ca, "spiffe://example.org/idle", now.Add(time.Hour))
+	active := addTestConn(t, tracker, ca, "spiffe://example.org/active", now.Add(time.Hour))
+	tracker.connState(idle, http.StateIdle)
+	tracker.connState(active, http.StateActive)
+
+	tracker.check(now)
+	if idle.closed.Load() || active.closed.Load() {
+		t.Fatal("connection closed before max_connection_age")
+	}
+
+	tracker.check(now.Add(2 * time.Minute))
+	if !idle.closed.Load() {
+		t.Error("idle connection older than max_connection_age was not closed")
+	}
+	if active.closed.Load() {
+		t.Fatal("connection closed with a request in flight")
+	}
+
+	// Retired as soon as its request is done
+	tracker.connState(active, http.StateIdle)
+	if !active.closed.Load() {
+		t.Error("retiring connection was not closed once idle")
+	}
+	if tracked(tracker, active) {
+		t.Error("retired connection is still tracked")
+	}
+}
+
+func TestConnTracker_HijackedConnections(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	tracker := newConnTracker(ca.bundle(), time.Minute)
+	now := time.Now()
+	conn := addTestConn(t, tracker, ca, "spiffe://example.org/client", now.Add(time.Hour))
+	tracker.connState(conn, http.StateActive)
+	tracker.connState(conn, http.StateHijacked)
+
+	tracker.check(now.Add(2 * time.Minute))
+	if conn.closed.Load() {
+		t.Fatal("hijacked connection closed for its age")
+	}
+	if !tracked(tracker, conn) {
+		t.Fatal("hijacked connection no longer tracked before its peer expired")
+	}
+
+	tracker.check(now.Add(2 * time.Hour))
+	if !conn.closed.Load() {
+		t.Error("hijacked connection with an expired peer certificate was not closed")
+	}
+	if tracked(tracker, conn) {
+		t.Error("closed hijacked connection is still tracked")
+	}
+}
+
+func TestConnTracker_ClosesHijackedConnectionsNoLongerTrusted(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	bundles := x509bundle.NewSet(ca.bundle())
+	tracker := newConnTracker(bundles, 0)
+	conn := addTestConn(t, tracker, ca, "spiffe://example.org/client", time.Now().Add(time.Hour))
+	tracker.connState(conn, http.StateActive)
+	tracker.connState(conn, http.StateHijacked)
+
+	bundles.Add(newTestCA(t, "example.org").bundle())
+	tracker.check(time.Now())
+	if !conn.closed.Load() {
+		t.Error("hijacked connection whose CA was removed from the bundle was not closed")
+	}
+}
+
+func TestConnTracker_ConnState(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	tracker := newConnTracker(ca.bundle(), 0)
+	conn := addTestConn(t, tracker, ca, "spiffe://example.org/client", time.Now().Add(time.Hour))
+
+	tracker.connState(conn, http.StateClosed)
+	if tracked(tracker, conn) {
+		t.Error("closed connection is still tracked")
+	}
+
+	// Connections without a SPIFFE peer are not tracked
+	plain := newTestConn(t)
+	tracker.add(plain, tls.ConnectionState{})
+	if tracked(tracker, plain) {
+		t.Error("connection without peer certificates is tracked")
+	}
+}
+
+func TestConnTracker_Nil(t *testing.T) {
+	var tracker *connTracker
+	tracker.Start()
+	tracker.Stop()
+	tracker.connState(newTestConn(t), http.StateActive)
+	if got := tracker.list(); len(got) != 0 {
+		t.Errorf("list() = %v, want empty", got)
+	}
+	if tracker.track(http.NotFoundHandler()) == nil {
+		t.Error("track() returned nil")
+	}
+	pattern, err := spiffehttp.ParseIDPattern("spiffe://example.org/*")
+	if err != nil {
+		t.Fatalf("ParseIDPattern() error = %v", err)
+	}
+	if n := tracker.disconnect(pattern); n != 0 {
+		t.Errorf("disconnect() = %d, want 0", n)
+	}
+}
+
+func TestConnTracker_ListAndDisconnect(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	tracker := newConnTracker(ca.bundle(), 0)
+	notAfter := time.Now().Add(time.Hour)
+	billing1 := addTestConn(t, tracker, ca, "spiffe://example.org/ns/billing/sa/api", notAfter)
+	billing2 := addTestConn(t, tracker, ca, "spiffe://example.org/ns/billing/sa/api", notAfter)
+	orders := addTestConn(t, tracker, ca, "spiffe://example.org/ns/orders/sa/api", notAfter)
+
+	// Requests are counted against the connection they arrive on
+	handler := tracker.track(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(tracker.withConn(req.Context(), billing2))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	billingID := spiffeid.RequireFromString("spiffe://example.org/ns/billing/sa/api")
+	conns := tracker.list()
+	if len(conns) != 2 || len(conns[billingID]) != 2 {
+		t.Fatalf("list() = %v, want 2 billing connections and 1 orders connection", conns)
+	}
+	if got := conns[billingID][0].Requests + conns[billingID][1].Requests; got != 3 {
+		t.Errorf("Requests = %d, want 3", got)
+	}
+	if conns[billingID][0].Established.After(conns[billingID][1].Established) {
+		t.Error("list() not sorted oldest first")
+	}
+
+	pattern, err := spiffehttp.ParseIDPattern("spiffe://example.org/ns/billing/*/*")
+	if err != nil {
+		t.Fatalf("ParseIDPattern() error = %v", err)
+	}
+	if n := tracker.disconnect(pattern); n != 2 {
+		t.Errorf("disconnect() = %d, want 2", n)
+	}
+	if !billing1.closed.Load() || !billing2.closed.Load() {
+		t.Error("matching connections were not closed")
+	}
+	if orders.closed.Load() {
+		t.Error("connection not matching the pattern was closed")
+	}
+	conns = tracker.list()
+	if len(conns) != 1 || len(conns[billingID]) != 0 {
+		t.Errorf("list() after disconnect = %v, want only the orders connection", conns)
+	}
+
+	if n := tracker.disconnect(pattern); n != 0 {
+		t.Errorf("second disconnect() = %d, want 0", n)
+	}
+}
@@ -0,0 +1,222 @@
+package e5s
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sufield/e5s/internal/config"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// denyListPollInterval is how often deny list files are checked for changes.
+// Polling the content rather than watching for events also picks up
+// Kubernetes ConfigMap updates, which swap a symlink instead of writing the file.
+const denyListPollInterval = 2 * time.Second
+
+// denyListWatcher keeps a spiffehttp.DenyList in sync with its file.
+//
+// A nil *denyListWatcher stands for "no deny list": List returns nil and
+// Stop does nothing, so callers need no special case.
+type denyListWatcher struct {
+	path     string
+	list     *spiffehttp.DenyList
+	onChange func()
+	last     []byte
+
+	// readErr is set while the file cannot be read, and parseErr while its
+	// content cannot be parsed; each is logged once rather than on every poll
+	mu       sync.Mutex
+	readErr  error
+	parseErr error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// loadDenyList loads the deny list file at path. Once started, the watcher
+// reloads the file whenever its content changes and calls onChange (if
+// non-nil) after each reload. Returns a nil watcher if path is empty.
+//
+// The initial load must succeed. A later file that cannot be read or parsed
+// is logged and reported by Err, and the previous entries are kept, so a bad
+// edit never drops identities that were already denied.
+func loadDenyList(path string, onChange func()) (*denyListWatcher, error) {
+	if path == "" {
+		return nil, nil
+	}
+	path = filepath.Clean(path)
+	data, err := os.ReadFile(path) // #nosec G304 - Deny list path is trusted (from admin/user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deny list: %w", err)
+	}
+	entries, err := parseDenyList(data)
+	if err != nil {
+		return nil, fmt.Errorf("deny list %q: %w", path, err)
+	}
+
+	w := &denyListWatcher{
+		path:     path,
+		list:     spiffehttp.NewDenyList(entries),
+		onChange: onChange,
+		last:     data,
+		stop:     make(chan struct{}),
+	}
+
+	counts := w.list.Counts()
+	debugf("deny list loaded path=%q spiffe_ids=%d spiffe_id_patterns=%d serial_numbers=%d",
+		path, counts.IDs, counts.IDPatterns, counts.SerialNumbers)
+	return w, nil
+}
+
+// List returns the live deny list, or nil if there is none.
+func (w *denyListWatcher) List() *spiffehttp.DenyList {
+	if w == nil {
+		return nil
+	}
+	return w.list
+}
+
+// Err returns why the file's current content is not in force, or nil if it
+// is.
+func (w *denyListWatcher) Err() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.readErr != nil {
+		return w.readErr
+	}
+	return w.parseErr
+}
+
+// Start begins reloading the file in the background.
+func (w *denyListWatcher) Start() {
+	if w == nil {
+		return
+	}
+	go w.run()
+}
+
+// Stop ends the reload loop. It is safe to call more than once.
+func (w *denyListWatcher) Stop() {
+	if w == nil {
+		return
+	}
+	w.stopOnce.Do(func() { close(w.stop) })
+}
+
+// run polls the file until Stop is called.
+func (w *denyListWatcher) run() {
+	ticker := time.NewTicker(denyListPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.reload()
+		}
+	}
+}
+
+// reload re-reads the file and applies it if its content changed.
+func (w *denyListWatcher) reload() {
+	data, err := os.ReadFile(w.path)
+	w.mu.Lock()
+	failed := w.readErr != nil || w.parseErr != nil
+	if err != nil {
+		if w.readErr == nil {
+			log.Printf("e5s: failed to reload deny list %q, keeping previous entries: %v", w.path, err)
+		}
+		w.readErr = err
+		w.mu.Unlock()
+		return
+	}
+	readFailed := w.readErr != nil
+	w.readErr = nil
+	if bytes.Equal(data, w.last) {
+		if readFailed && w.parseErr == nil {
+			log.Printf("e5s: deny list %q can be read again, its entries are unchanged", w.path)
+		}
+		w.mu.Unlock()
+		return
+	}
+	entries, err := parseDenyList(data)
+	// Remember bad content too, so it is reported once, not on every poll
+	w.last = data
+	if err != nil {
+		w.parseErr = fmt.Errorf("deny list %q: %w", w.path, err)
+		w.mu.Unlock()
+		log.Printf("e5s: failed to reload deny list %q, keeping previous entries: %v", w.path, err)
+		return
+	}
+	w.parseErr = nil
+	w.mu.Unlock()
+	w.list.Set(entries)
+
+	counts := w.list.Counts()
+	if failed {
+		log.Printf("e5s: reloaded deny list %q after an earlier failure: %d SPIFFE IDs, %d ID patterns, %d serial numbers",
+			w.path, counts.IDs, counts.IDPatterns, counts.SerialNumbers)
+	} else {
+		debugf("reloaded deny list %q: %d SPIFFE IDs, %d ID patterns, %d serial numbers",
+			w.path, counts.IDs, counts.IDPatterns, counts.SerialNumbers)
+	}
+	if w.onChange != nil {
+		w.onChange()
+	}
+}
+
+// parseDenyList parses the content of a deny list file into spiffehttp
+// entries.
+func parseDenyList(data []byte) (spiffehttp.DenyEntries, error) {
+	list, err := config.ParseDenyList(data)
+	if err != nil {
+		return spiffehttp.DenyEntries{}, err
+	}
+	patterns, err := parseIDPatterns(list.IDPatterns)
+	if err != nil {
+		return spiffehttp.DenyEntries{}, err
+	}
+	return spiffehttp.DenyEntries{IDs: list.IDs, IDPatterns: patterns, SerialNumbers: list.SerialNumbers}, nil
+}
+
+// denyRequest writes 403 Forbidden and returns the reason if the client of r
+// is denied by w, or returns nil. It catches clients denied after their
+// connection was established; the response also closes that connection.
+func (w *denyListWatcher) denyRequest(rw http.ResponseWriter, r *http.Request, peer spiffehttp.Peer) error {
+	list := w.List()
+	if list == nil || r.TLS == nil {
+		return nil
+	}
+	err := list.Authorize(peer.ID, [][]*x509.Certificate{r.TLS.PeerCertificates})
+	if err == nil {
+		return nil
+	}
+	rw.Header().Set("Connection", "close")
+	http.Error(rw, http.StatusText(http.StatusForbidden)+": "+err.Error(), http.StatusForbidden)
+	return err
+}
+
+// DenyListError returns why the current content of server.deny_list_file is
+// not in force, or nil if it is or no deny list is configured.
+//
+// A deny list edit that cannot be read or parsed is logged and ignored: the
+// previous entries stay in force until the file is fixed. Check DenyListError
+// from a health or alerting loop so a broken edit is noticed even when the
+// logs are not watched:
+//
+//	if err := srv.DenyListError(); err != nil {
+//	    alert("deny list edit rejected: %v", err)
+//	}
+func (s *Server) DenyListError() error {
+	return s.denyList.Err()
+}
@@ -0,0 +1,133 @@
+package e5s
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the standard logger to a buffer for the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestDenyListWatcher_ReportsBadEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write deny list: %v", err)
+		}
+	}
+	write("spiffe_ids:\n  - spiffe://example.org/compromised\n")
+
+	changes := 0
+	w, err := loadDenyList(path, func() { changes++ })
+	if err != nil {
+		t.Fatalf("loadDenyList() error = %v", err)
+	}
+	logs := captureLog(t)
+
+	// A malformed edit is logged and reported, and the entries stay in force
+	write("spiffe_ids:\n  - spiffe://example.org/compromised\n  - not-a-spiffe-id\n")
+	w.reload()
+	if err := w.Err(); err == nil || !strings.Contains(err.Error(), "spiffe_ids[1]") {
+		t.Errorf("Err() = %v, want the rejected entry", err)
+	}
+	if !strings.Contains(logs.String(), "e5s: failed to reload deny list") {
+		t.Errorf("malformed edit not logged, got %q", logs.String())
+	}
+	if got := w.List().Counts().IDs; got != 1 {
+		t.Errorf("IDs in force = %d, want the previous 1", got)
+	}
+	if changes != 0 {
+		t.Errorf("onChange called %d times for a rejected edit", changes)
+	}
+
+	// Reported once, not on every poll
+	logs.Reset()
+	w.reload()
+	if logs.Len() != 0 {
+		t.Errorf("unchanged bad content logged again: %q", logs.String())
+	}
+	if w.Err() == nil {
+		t.Error("Err() = nil while the bad content is still in the file")
+	}
+
+	// Fixing the file clears the error
+	write("spiffe_ids:\n  - spiffe://example.org/compromised\n  - spiffe://example.org/also-compromised\n")
+	w.reload()
+	if err := w.Err(); err != nil {
+		t.Errorf("Err() after a good edit = %v, want nil", err)
+	}
+	if got := w.List().Counts().IDs; got != 2 {
+		t.Errorf("IDs in force = %d, want 2", got)
+	}
+	if changes != 1 {
+		t.Errorf("onChange called %d times, want 1", changes)
+	}
+	if !strings.Contains(logs.String(), "after an earlier failure") {
+		t.Errorf("recovery not logged, got %q", logs.String())
+	}
+}
+
+func TestDenyListWatcher_ReportsUnreadableFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.yaml")
+	content := []byte("spiffe_ids:\n  - spiffe://example.org/compromised\n")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("write deny list: %v", err)
+	}
+	w, err := loadDenyList(path, nil)
+	if err != nil {
+		t.Fatalf("loadDenyList() error = %v", err)
+	}
+	logs := captureLog(t)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("remove deny list: %v", err)
+	}
+	w.reload()
+	w.reload()
+	if w.Err() == nil {
+		t.Error("Err() = nil for a missing file")
+	}
+	if n := strings.Count(logs.String(), "e5s: failed to reload deny list"); n != 1 {
+		t.Errorf("read failure logged %d times, want once: %q", n, logs.String())
+	}
+
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("restore deny list: %v", err)
+	}
+	w.reload()
+	if err := w.Err(); err != nil {
+		t.Errorf("Err() after the file came back = %v, want nil", err)
+	}
+	if !strings.Contains(logs.String(), "can be read again") {
+		t.Errorf("recovery not logged, got %q", logs.String())
+	}
+}
+
+func TestDenyListWatcher_Nil(t *testing.T) {
+	w, err := loadDenyList("", nil)
+	if err != nil || w != nil {
+		t.Fatalf("loadDenyList(\"\") = %v, %v, want nil, nil", w, err)
+	}
+	if w.Err() != nil || w.List() != nil {
+		t.Error("nil watcher reports a deny list")
+	}
+	if err := (&Server{}).DenyListError(); err != nil {
+		t.Errorf("DenyListError() without a deny list = %v, want nil", err)
+	}
+}
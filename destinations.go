@@ -0,0 +1,141 @@
+package e5s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// context key type (unexported) to avoid collisions with keys from other packages.
+type expectedServerCtxKey struct{}
+
+var expectedServerKey = expectedServerCtxKey{}
+
+// WithExpectedServer returns a context that makes requests sent with it by an
+// e5s client accept only a server presenting id.
+//
+// The override replaces the client's configured policy (the expected_server_*
+// fields and client.destinations) for those requests, including redirects
+// they follow. A custom authorizer set with WithServerAuthorizer still
+// applies. Connections verified against id are pooled separately, so a
+// connection is never reused for a request expecting a different server.
+//
+// Example:
+//
+//	ctx := e5s.WithExpectedServer(r.Context(), spiffeid.RequireFromString("spiffe://corp/billing"))
+//	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://billing.internal:8443/invoices", nil)
+//	resp, err := client.Do(req)
+func WithExpectedServer(ctx context.Context, id spiffeid.ID) context.Context {
+	return context.WithValue(ctx, expectedServerKey, id)
+}
+
+// expectedServerFromContext returns the identity set with WithExpectedServer.
+func expectedServerFromContext(ctx context.Context) (spiffeid.ID, bool) {
+	id, ok := ctx.Value(expectedServerKey).(spiffeid.ID)
+	return id, ok && !id.IsZero()
+}
+
+// destinationTransport selects the transport, and so the expected server
+// identity, for each request: the identity set with WithExpectedServer first,
+// then the request host's entry in client.destinations, then the default
+// policy. Each identity has its own *http.Transport and connection pool.
+type destinationTransport struct {
+	// fallback serves unlisted hosts; nil rejects them
+	fallback *http.Transport
+	// byHost is keyed by config.DestinationKey
+	byHost map[string]*http.Transport
+	// newTransport builds a transport verifying the server against policy
+	newTransport func(policy spiffehttp.ClientConfig) (*http.Transport, error)
+	// attachPeer attaches the server's peer to each response (see
+	// WithServerPeerInContext)
+	attachPeer bool
+	// conns tracks the connections of every transport
+	conns *connTracker
+
+	mu        sync.Mutex
+	overrides map[spiffeid.ID]*http.Transport
+}
+
+// RoundTrip sends req over the transport for its expected server identity.
+func (t *destinationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt, err := t.transportFor(req)
+	if err != nil {
+		// A RoundTripper must close the body, even on errors
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+	req = req.WithContext(t.conns.withClientTrace(req.Context()))
+	if t.attachPeer {
+		return roundTripWithPeer(rt, req)
+	}
+	return rt.RoundTrip(req)
+}
+
+// transportFor returns the transport for req, failing closed for a host
+// without an expected server identity.
+func (t *destinationTransport) transportFor(req *http.Request) (*http.Transport, error) {
+	if id, ok := expectedServerFromContext(req.Context()); ok {
+		return t.override(id)
+	}
+
+	host := strings.ToLower(req.URL.Hostname())
+	port := req.URL.Port()
+	if port == "" {
+		port = "443"
+		if req.URL.Scheme == "http" {
+			port = "80"
+		}
+	}
+	if rt, ok := t.byHost[net.JoinHostPort(host, port)]; ok {
+		return rt, nil
+	}
+	if rt, ok := t.byHost[host]; ok {
+		return rt, nil
+	}
+	if t.fallback == nil {
+		return nil, fmt.Errorf("no expected server identity configured for %q (add it to client.destinations)", req.URL.Host)
+	}
+	return t.fallback, nil
+}
+
+// override returns the transport expecting id, creating it on first use.
+func (t *destinationTransport) override(id spiffeid.ID) (*http.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if rt, ok := t.overrides[id]; ok {
+		return rt, nil
+	}
+	rt, err := t.newTransport(spiffehttp.ClientConfig{ExpectedServerID: id.String()})
+	if err != nil {
+		return nil, err
+	}
+	if t.overrides == nil {
+		t.overrides = make(map[spiffeid.ID]*http.Transport)
+	}
+	t.overrides[id] = rt
+	return rt, nil
+}
+
+// CloseIdleConnections closes the idle connections of every transport, so
+// http.Client.CloseIdleConnections and Runtime.Close reach all of them.
+func (t *destinationTransport) CloseIdleConnections() {
+	if t.fallback != nil {
+		t.fallback.CloseIdleConnections()
+	}
+	for _, rt := range t.byHost {
+		rt.CloseIdleConnections()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, rt := range t.overrides {
+		rt.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,166 @@
+package e5s
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+func TestDestinationTransport_TransportFor(t *testing.T) {
+	fallback := &http.Transport{}
+	api := &http.Transport{}
+	apiAdmin := &http.Transport{}
+	ipv6 := &http.Transport{}
+	dt := &destinationTransport{
+		fallback: fallback,
+		byHost: map[string]*http.Transport{
+			"api.internal":      api,
+			"api.internal:9443": apiAdmin,
+			"::1":               ipv6,
+		},
+	}
+
+	tests := []struct {
+		url  string
+		want *http.Transport
+	}{
+		{"https://api.internal/v1", api},
+		{"https://API.Internal/v1", api},
+		{"https://api.internal:443/v1", api},
+		{"https://api.internal:9443/v1", apiAdmin},
+		{"https://api.internal:8443/v1", api},
+		{"https://[::1]:8443/", ipv6},
+		{"https://other.internal/v1", fallback},
+		{"https://api.internal.evil/v1", fallback},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			got, err := dt.transportFor(req)
+			if err != nil {
+				t.Fatalf("transportFor() error = %v", err)
+			}
+			if got != tt.want {
+				t.Error("transportFor() returned the wrong transport")
+			}
+		})
+	}
+}
+
+func TestDestinationTransport_DefaultPort(t *testing.T) {
+	https := &http.Transport{}
+	plain := &http.Transport{}
+	dt := &destinationTransport{
+		byHost: map[string]*http.Transport{
+			"api.internal:443": https,
+			"api.internal:80":  plain,
+		},
+	}
+
+	for url, want := range map[string]*http.Transport{
+		"https://api.internal/": https,
+		"http://api.internal/":  plain,
+	} {
+		got, err := dt.transportFor(httptest.NewRequest(http.MethodGet, url, nil))
+		if err != nil {
+			t.Fatalf("transportFor(%s) error = %v", url, err)
+		}
+		if got != want {
+			t.Errorf("transportFor(%s) returned the wrong transport", url)
+		}
+	}
+}
+
+func TestDestinationTransport_NoFallback(t *testing.T) {
+	dt := &destinationTransport{
+		byHost: map[string]*http.Transport{"api.internal": {}},
+	}
+
+	body := &closeTracker{Reader: strings.NewReader("payload")}
+	req := httptest.NewRequest(http.MethodPost, "https://other.internal/v1", body)
+	_, err := dt.RoundTrip(req)
+	if err == nil || !strings.Contains(err.Error(), "client.destinations") {
+		t.Fatalf("RoundTrip() error = %v, want the host to be rejected", err)
+	}
+	if !body.closed {
+		t.Error("RoundTrip() did not close the request body on error")
+	}
+}
+
+func TestDestinationTransport_ExpectedServerOverride(t *testing.T) {
+	var created []string
+	dt := &destinationTransport{
+		fallback: &http.Transport{},
+		byHost:   map[string]*http.Transport{"api.internal": {}},
+		newTransport: func(policy spiffehttp.ClientConfig) (*http.Transport, error) {
+			created = append(created, policy.ExpectedServerID)
+			return &http.Transport{}, nil
+		},
+	}
+	billing := spiffeid.RequireFromString("spiffe://example.org/billing")
+	orders := spiffeid.RequireFromString("spiffe://example.org/orders")
+
+	request := func(id spiffeid.ID) *http.Transport {
+		t.Helper()
+		ctx := WithExpectedServer(context.Background(), id)
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "https://api.internal/v1", nil)
+		rt, err := dt.transportFor(req)
+		if err != nil {
+			t.Fatalf("transportFor() error = %v", err)
+		}
+		if rt == dt.byHost["api.internal"] {
+			t.Fatal("transportFor() ignored WithExpectedServer")
+		}
+		return rt
+	}
+
+	first := request(billing)
+	if again := request(billing); again != first {
+		t.Error("override transport was not reused for the same server identity")
+	}
+	if other := request(orders); other == first {
+		t.Error("override transport shared between server identities")
+	}
+	if want := []string{billing.String(), orders.String()}; strings.Join(created, ",") != strings.Join(want, ",") {
+		t.Errorf("created transports for %v, want %v", created, want)
+	}
+
+	// A zero ID is no override
+	ctx := WithExpectedServer(context.Background(), spiffeid.ID{})
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "https://api.internal/v1", nil)
+	if rt, err := dt.transportFor(req); err != nil || rt != dt.byHost["api.internal"] {
+		t.Errorf("transportFor() with a zero expected server = %v, %v, want the destination's transport", rt, err)
+	}
+}
+
+func TestDestinationTransport_OverrideError(t *testing.T) {
+	wantErr := errors.New("no SVID")
+	dt := &destinationTransport{
+		newTransport: func(spiffehttp.ClientConfig) (*http.Transport, error) {
+			return nil, wantErr
+		},
+	}
+	ctx := WithExpectedServer(context.Background(), spiffeid.RequireFromString("spiffe://example.org/billing"))
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "https://api.internal/v1", nil)
+	if _, err := dt.RoundTrip(req); !errors.Is(err, wantErr) {
+		t.Errorf("RoundTrip() error = %v, want %v", err, wantErr)
+	}
+}
+
+// closeTracker is a request body that records whether it was closed.
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTracker) Close() error {
+	b.closed = true
+	return nil
+}
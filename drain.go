@@ -0,0 +1,64 @@
+package e5s
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// requestTracker counts handlers that are still running.
+//
+// http.Server.Shutdown waits for active connections to go idle, but it does
+// not wait for hijacked connections (WebSockets, raw streams). Counting the
+// handler invocations themselves covers both: a handler that hijacked its
+// connection keeps running until it is done with it.
+type requestTracker struct {
+	mu     sync.Mutex
+	active int
+	idle   chan struct{} // closed when active drops back to zero
+}
+
+// track wraps next so that every invocation is counted.
+func (t *requestTracker) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.begin()
+		defer t.end()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *requestTracker) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active++
+}
+
+func (t *requestTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if t.active == 0 {
+		close(t.idle)
+	}
+}
+
+// wait blocks until no handlers are running or ctx is done.
+func (t *requestTracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+	if t.active == 0 {
+		t.mu.Unlock()
+		return nil
+	}
+	idle := t.idle
+	t.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,257 @@
+package e5s
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sufield/e5s/internal/config"
+)
+
+func TestRequestTracker_Wait(t *testing.T) {
+	var tracker requestTracker
+	if err := tracker.wait(context.Background()); err != nil {
+		t.Fatalf("wait() with no handlers running = %v, want nil", err)
+	}
+
+	tracker.begin()
+	tracker.begin()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tracker.wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wait() with handlers running = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- tracker.wait(context.Background()) }()
+	tracker.end()
+	select {
+	case err := <-done:
+		t.Fatalf("wait() returned %v with a handler still running", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	tracker.end()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("wait() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait() did not return once the handlers finished")
+	}
+
+	// The tracker can be reused after draining to zero
+	tracker.begin()
+	tracker.end()
+	if err := tracker.wait(context.Background()); err != nil {
+		t.Errorf("wait() after reuse = %v, want nil", err)
+	}
+}
+
+// drainTestServer is a plain-HTTP Server set up like a started e5s server,
+// enough to exercise Shutdown.
+type drainTestServer struct {
+	*Server
+	url            string
+	ready          *atomic.Bool
+	sourceClosed   atomic.Bool
+	handlerStarted chan struct{}
+}
+
+// newDrainTestServer serves handler and returns once it accepts requests.
+func newDrainTestServer(t *testing.T, handler http.HandlerFunc) *drainTestServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	ready := new(atomic.Bool)
+	ready.Store(true)
+	ts := &drainTestServer{
+		url:            "http://" + ln.Addr().String(),
+		ready:          ready,
+		handlerStarted: make(chan struct{}, 1),
+	}
+	requests := &requestTracker{}
+	ts.Server = &Server{
+		httpServer: &http.Server{
+			Handler: requests.track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ts.handlerStarted <- struct{}{}
+				handler(w, r)
+			})),
+			ReadHeaderTimeout: time.Second,
+		},
+		identityShutdown: func() error {
+			ts.sourceClosed.Store(true)
+			return nil
+		},
+		opts:     &serverOptions{readiness: ready},
+		shutdown: config.ServerShutdown{Timeout: time.Second},
+		requests: requests,
+		listener: ln,
+	}
+	go func() {
+		_ = ts.httpServer.Serve(ln)
+	}()
+	t.Cleanup(func() {
+		_ = ts.httpServer.Close()
+	})
+	return ts
+}
+
+// startRequest sends a request in the background and waits for its handler
+// to start. The returned channel receives the request's error.
+func (ts *drainTestServer) startRequest(t *testing.T) <-chan error {
+	t.Helper()
+	errc := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(ts.url)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		errc <- err
+	}()
+	select {
+	case <-ts.handlerStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not start")
+	}
+	return errc
+}
+
+func TestServerShutdown_WaitsForRequests(t *testing.T) {
+	release := make(chan struct{})
+	ts := newDrainTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	errc := ts.startRequest(t)
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- ts.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown() returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if ts.ready.Load() {
+		t.Error("readiness flag still set while draining")
+	}
+	if err := ts.Ready(); err == nil {
+		t.Error("Ready() = nil while draining")
+	}
+	if ts.sourceClosed.Load() {
+		t.Error("identity source closed before the request finished")
+	}
+
+	close(release)
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Shutdown() = %v, want nil", err)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("in-flight request failed: %v", err)
+	}
+	if !ts.sourceClosed.Load() {
+		t.Error("identity source not closed after Shutdown")
+	}
+	if err := ts.Shutdown(context.Background()); err != nil {
+		t.Errorf("second Shutdown() = %v, want nil", err)
+	}
+}
+
+func TestServerShutdown_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	ts := newDrainTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	errc := ts.startRequest(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ts.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !ts.sourceClosed.Load() {
+		t.Error("identity source not closed after the drain timed out")
+	}
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("request still in flight at the deadline succeeded, want its connection closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection still open after the drain timed out")
+	}
+}
+
+func TestServerShutdown_WaitsForHijackedConnections(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	ts := newDrainTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		<-release
+	})
+
+	conn, err := net.Dial("tcp", ts.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n")); err != nil {
+		t.Fatalf("write request: %v", err)
+	}
+	select {
+	case <-ts.handlerStarted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not start")
+	}
+
+	// http.Server.Shutdown alone would return at once: it does not track
+	// hijacked connections
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ts.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() = %v, want %v while a hijacked handler runs", err, context.DeadlineExceeded)
+	}
+}
+
+func TestServerShutdown_DrainDelay(t *testing.T) {
+	ts := newDrainTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	ts.shutdown.DrainDelay = 100 * time.Millisecond
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- ts.Shutdown(context.Background()) }()
+
+	// Still serving during the delay, but no longer ready
+	time.Sleep(20 * time.Millisecond)
+	errc := ts.startRequest(t)
+	if err := <-errc; err != nil {
+		t.Errorf("request during the drain delay failed: %v", err)
+	}
+	if ts.ready.Load() {
+		t.Error("readiness flag still set during the drain delay")
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Shutdown() = %v, want nil", err)
+	}
+
+	// A context ending during the delay cuts it short
+	ts = newDrainTestServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	ts.shutdown.DrainDelay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_ = ts.Shutdown(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Shutdown() took %v, want it bounded by the context", elapsed)
+	}
+}
@@ -25,11 +25,19 @@
 //
 // Server (advanced - custom shutdown logic):
 //
-//	shutdown, err := e5s.Start("e5s.yaml", handler)
+//	srv, err := e5s.Start("e5s.yaml", handler)
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
-//	defer shutdown()
+//	defer srv.Shutdown(context.Background())
+//	log.Printf("listening on %s", srv.Addr())
+//
+// Server (configuration built in code instead of e5s.yaml):
+//
+//	srv, err := e5s.StartWithConfig(ctx, e5s.ServerConfig{
+//	    SPIRE:  e5s.SPIRESection{WorkloadSocket: socket},
+//	    Server: e5s.ServerSection{ListenAddr: ":8443", AllowedClientTrustDomain: "example.org"},
+//	}, handler)
 //
 // Client (simple):
 //
@@ -59,17 +67,18 @@ package e5s
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/spiffe/go-spiffe/v2/workloadapi"
 	"github.com/sufield/e5s/internal/config"
 	"github.com/sufield/e5s/spiffehttp"
 	"github.com/sufield/e5s/spire"
@@ -101,50 +110,125 @@ func firstErr(errs ...error) error {
 	return nil
 }
 
-// newSPIRESource initializes the SPIRE identity source and returns:
+// newIdentitySource initializes the identity source selected by the identity
+// section and returns:
 //   - x509Source: the X.509 source used for TLS
 //   - shutdown: an idempotent function that closes the source
-func newSPIRESource(
+//
+// By default this is the SPIRE Workload API; in files mode the SVID and
+// bundle are read from the identity section's files instead, and in dev mode
+// they are issued by a local dev CA.
+func newIdentitySource(
 	ctx context.Context,
-	workloadSocket string,
-	initialFetchTimeout time.Duration,
-) (x509Source *workloadapi.X509Source, shutdown func() error, err error) {
-	src, err := spire.NewIdentitySource(ctx, spire.Config{
-		WorkloadSocket:      workloadSocket,
-		InitialFetchTimeout: initialFetchTimeout,
-	})
-	if err != nil {
-		return nil, nil, err
+	spireSection config.SPIRESection,
+	identity config.IdentitySection,
+	spireConfig config.SPIREConfig,
+) (x509Source identitySource, shutdown func() error, err error) {
+	var closeSource func() error
+	switch spireConfig.Mode {
+	case config.IdentityModeFiles:
+		src, err := spire.NewFileSource(ctx, spire.FileConfig{
+			CertFile:     strings.TrimSpace(identity.CertFile),
+			KeyFile:      strings.TrimSpace(identity.KeyFile),
+			BundleFile:   strings.TrimSpace(identity.BundleFile),
+			PollInterval: spireConfig.PollInterval,
+			Logf:         debugf,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load identity files: %w", err)
+		}
+		debugf("identity mode=files cert_file=%q key_file=%q bundle_file=%q", identity.CertFile, identity.KeyFile, identity.BundleFile)
+		x509Source, closeSource = src, src.Close
+	case config.IdentityModeDev:
+		src, err := spire.NewDevSource(ctx, spire.DevConfig{
+			ID:        spireConfig.DevID,
+			SVIDTTL:   spireConfig.SVIDTTL,
+			CAKeyFile: strings.TrimSpace(identity.CAKeyFile),
+			Logf:      debugf,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create dev identity: %w", err)
+		}
+		debugf("identity mode=dev spiffe_id=%s svid_ttl=%v ca_key_file=%q", spireConfig.DevID, spireConfig.SVIDTTL, identity.CAKeyFile)
+		x509Source, closeSource = src, src.Close
+	default:
+		src, err := spire.NewIdentitySource(ctx, spire.Config{
+			WorkloadSocket:      spireSection.WorkloadSocket,
+			InitialFetchTimeout: spireConfig.InitialFetchTimeout,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create SPIRE source: %w", err)
+		}
+		x509Source, closeSource = src.X509Source(), src.Close
 	}
 
-	x509 := src.X509Source()
-
 	var once sync.Once
 	var shutdownErr error
 	shutdown = func() error {
 		once.Do(func() {
-			shutdownErr = src.Close()
+			shutdownErr = closeSource()
 		})
 		return shutdownErr
 	}
 
-	return x509, shutdown, nil
+	return x509Source, shutdown, nil
 }
 
 // loadServerConfig loads and validates server configuration from the specified file.
 // Returns the raw config and validated SPIRE config ready for use.
-func loadServerConfig(path string) (config.ServerFileConfig, config.SPIREConfig, error) {
+func loadServerConfig(path string, opts *serverOptions) (config.ServerFileConfig, config.SPIREConfig, error) {
 	cfg, err := config.LoadServerConfig(path)
 	if err != nil {
 		return config.ServerFileConfig{}, config.SPIREConfig{}, fmt.Errorf("failed to load config: %w", err)
 	}
-	spireCfg, _, err := config.ValidateServerConfig(&cfg)
+	spireCfg, err := validateServerConfig(&cfg, opts)
 	if err != nil {
-		return config.ServerFileConfig{}, config.SPIREConfig{}, fmt.Errorf("invalid server config: %w", err)
+		return config.ServerFileConfig{}, config.SPIREConfig{}, err
 	}
 	return cfg, spireCfg, nil
 }
 
+// validateServerConfig runs the same checks on an in-memory server config
+// that loadServerConfig runs on a config file.
+//
+// When the caller supplied its own listener via WithListener, listen_addr is
+// optional and defaults to the listener's address.
+func validateServerConfig(cfg *config.ServerFileConfig, opts *serverOptions) (config.SPIREConfig, error) {
+	if opts.listener != nil && strings.TrimSpace(cfg.Server.ListenAddr) == "" {
+		cfg.Server.ListenAddr = opts.listener.Addr().String()
+	}
+	spireCfg, authz, err := config.ValidateServerConfig(cfg)
+	if err != nil {
+		return config.SPIREConfig{}, fmt.Errorf("invalid server config: %w", err)
+	}
+	if _, err := parseIDPatterns(authz.AllIDPatterns()); err != nil {
+		return config.SPIREConfig{}, fmt.Errorf("invalid server config: %w", err)
+	}
+	// A config with only a servers list is valid, but single-server entry
+	// points have nothing to listen on
+	if strings.TrimSpace(cfg.Server.ListenAddr) == "" {
+		return config.SPIREConfig{}, errors.New("invalid server config: server.listen_addr must be set (use ServeMulti to run the servers list)")
+	}
+	return spireCfg, nil
+}
+
+// validateServerSection is validateServerConfig for the server called name,
+// whose section the caller copied into cfg.Server. Errors name the section
+// as it appears in the config file, e.g. servers[api].listen_addr.
+func validateServerSection(cfg *config.ServerFileConfig, name string, opts *serverOptions) (config.SPIREConfig, error) {
+	if opts.listener != nil && strings.TrimSpace(cfg.Server.ListenAddr) == "" {
+		cfg.Server.ListenAddr = opts.listener.Addr().String()
+	}
+	spireCfg, authz, err := config.ValidateServerSection(cfg, config.SectionPath(name))
+	if err != nil {
+		return config.SPIREConfig{}, fmt.Errorf("invalid server config: %w", err)
+	}
+	if _, err := parseIDPatterns(authz.AllIDPatterns()); err != nil {
+		return config.SPIREConfig{}, fmt.Errorf("invalid server config: %w", err)
+	}
+	return spireCfg, nil
+}
+
 // loadClientConfig loads and validates client configuration from the specified file.
 // Returns the raw config and validated SPIRE config ready for use.
 func loadClientConfig(path string) (config.ClientFileConfig, config.SPIREConfig, error) {
@@ -152,36 +236,151 @@ func loadClientConfig(path string) (config.ClientFileConfig, config.SPIREConfig,
 	if err != nil {
 		return config.ClientFileConfig{}, config.SPIREConfig{}, fmt.Errorf("failed to load config: %w", err)
 	}
-	spireCfg, _, err := config.ValidateClientConfig(&cfg)
+	spireCfg, err := validateClientConfig(&cfg)
 	if err != nil {
-		return config.ClientFileConfig{}, config.SPIREConfig{}, fmt.Errorf("invalid client config: %w", err)
+		return config.ClientFileConfig{}, config.SPIREConfig{}, err
 	}
 	return cfg, spireCfg, nil
 }
 
+// validateClientConfig runs the same checks on an in-memory client config
+// that loadClientConfig runs on a config file.
+func validateClientConfig(cfg *config.ClientFileConfig) (config.SPIREConfig, error) {
+	spireCfg, authz, err := config.ValidateClientConfig(cfg)
+	if err != nil {
+		return config.SPIREConfig{}, fmt.Errorf("invalid client config: %w", err)
+	}
+	if _, err := parseIDPatterns(authz.AllIDPatterns()); err != nil {
+		return config.SPIREConfig{}, fmt.Errorf("invalid client config: %w", err)
+	}
+	return spireCfg, nil
+}
+
+// parseAuthorization parses the authorization rules of a server section into
+// spiffehttp rules, reporting errors under prefix.
+func parseAuthorization(authz config.AuthorizationSection, prefix string) ([]spiffehttp.Rule, error) {
+	parsed, err := config.ParseAuthorization(authz, prefix)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]spiffehttp.Rule, 0, len(parsed))
+	for _, r := range parsed {
+		patterns, err := parseIDPatterns(r.IDPatterns)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, spiffehttp.Rule{
+			PathPrefix:   r.PathPrefix,
+			Methods:      r.Methods,
+			IDs:          r.IDs,
+			TrustDomains: r.TrustDomains,
+			IDPatterns:   patterns,
+		})
+	}
+	return rules, nil
+}
+
+// parseIDPatterns parses SPIFFE ID patterns collected by internal/config,
+// naming the config field of the first invalid one.
+func parseIDPatterns(raw []config.IDPattern) ([]*spiffehttp.IDPattern, error) {
+	patterns := make([]*spiffehttp.IDPattern, 0, len(raw))
+	for _, p := range raw {
+		pattern, err := spiffehttp.ParseIDPattern(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", p.Field, p.Pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
 // buildServerWithContext constructs the HTTP server and SPIRE identity source with a custom context.
 //
 // This is the context-aware version used internally by StartWithContext.
 // The context is used for SPIRE source initialization and TLS config creation.
-func buildServerWithContext(ctx context.Context, configPath string, handler http.Handler) (
-	srv *http.Server,
-	identityShutdown func() error,
-	err error,
-) {
+func buildServerWithContext(ctx context.Context, configPath string, handler http.Handler, opts *serverOptions) (*Server, error) {
 	// Load and validate configuration
-	cfg, spireConfig, err := loadServerConfig(configPath)
+	cfg, spireConfig, err := loadServerConfig(configPath, opts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
+	debugf("server config_path=%q", configPath)
+
+	return buildServerFromConfig(ctx, cfg, spireConfig, handler, opts)
+}
+
+// buildServerFromConfig constructs the HTTP server and SPIRE identity source
+// from an already validated configuration.
+//
+// Both the file-based and the programmatic entry points end up here, so they
+// share identical SPIRE wiring and TLS setup.
+//
+// The returned Server is not yet listening; call start() or serve().
+func buildServerFromConfig(ctx context.Context, cfg config.ServerFileConfig, spireConfig config.SPIREConfig, handler http.Handler, opts *serverOptions) (*Server, error) {
 	// Centralized SPIRE setup with provided context
-	x509Source, identityShutdown, err := newSPIRESource(
-		ctx,
-		cfg.SPIRE.WorkloadSocket,
-		spireConfig.InitialFetchTimeout,
-	)
+	x509Source, identityShutdown, err := newIdentitySource(ctx, cfg.SPIRE, cfg.Identity, spireConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return newServer(ctx, cfg, "server", x509Source, identityShutdown, handler, opts)
+}
+
+// newServer constructs the HTTP server on top of an existing SPIRE source.
+// cfg.Server is the section at prefix in the config file ("server" or
+// "servers[<name>]"); errors are reported under it.
+//
+// identityShutdown is called when the server shuts down, and on any error
+// returned here. Servers that share a source (see Runtime) pass a no-op.
+func newServer(ctx context.Context, cfg config.ServerFileConfig, prefix string, x509Source identitySource, identityShutdown func() error, handler http.Handler, opts *serverOptions) (*Server, error) {
+	denyList, err := loadDenyList(strings.TrimSpace(cfg.Server.DenyListFile), nil)
+	if err != nil {
+		_ = identityShutdown()
+		return nil, fmt.Errorf("invalid server config: %s.deny_list_file: %w", prefix, err)
+	}
+	denyList.Start()
+	auditor, err := newAuditor(cfg.Server.Audit, opts.auditSink)
+	if err != nil {
+		denyList.Stop()
+		_ = identityShutdown()
+		return nil, fmt.Errorf("invalid server config: %s.audit: %w", prefix, err)
+	}
+
+	maxConnectionAge, err := config.ParseMaxConnectionAge(cfg.Server, prefix)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create SPIRE source: %w", err)
+		denyList.Stop()
+		_ = auditor.Close()
+		_ = identityShutdown()
+		return nil, fmt.Errorf("invalid server config: %w", err)
+	}
+	// Close connections whose client is no longer trusted, or too old
+	conns := newConnTracker(x509Source, maxConnectionAge)
+	conns.Start()
+
+	// Stop reloading the deny list and checking connections, and close the
+	// audit log, with the rest of the server's identity
+	releaseIdentity := identityShutdown
+	identityShutdown = func() error {
+		denyList.Stop()
+		conns.Stop()
+		return firstErr(releaseIdentity(), auditor.Close())
+	}
+
+	// Count, audit and log every client verification. Rejections are logged
+	// at a limited rate: any peer can trigger them at handshake rate
+	handshakes := &spiffehttp.HandshakeStats{}
+	rejections := &rejectionLog{}
+	onHandshake := func(info spiffehttp.HandshakeInfo) {
+		handshakes.Observe(info)
+		auditor.handshake(info)
+		if info.Err == nil {
+			return
+		}
+		rejections.log(info, time.Now())
+		if opts.onHandshakeFail != nil {
+			opts.onHandshakeFail(info)
+		}
 	}
 
 	// Build server TLS config with client verification
@@ -190,45 +389,140 @@ func buildServerWithContext(ctx context.Context, configPath string, handler http
 		x509Source,
 		x509Source,
 		spiffehttp.ServerConfig{
-			AllowedClientID:          cfg.Server.AllowedClientSPIFFEID,
-			AllowedClientTrustDomain: cfg.Server.AllowedClientTrustDomain,
+			AllowedClientID:           cfg.Server.AllowedClientSPIFFEID,
+			AllowedClientIDs:          cfg.Server.AllowedClientSPIFFEIDs,
+			AllowedClientTrustDomain:  cfg.Server.AllowedClientTrustDomain,
+			AllowedClientTrustDomains: cfg.Server.AllowedClientTrustDomains,
+			AllowedClientIDPatterns:   cfg.Server.AllowedClientSPIFFEIDPatterns,
+			Authorizer:                opts.authorizer,
+			AuthorizerComposition:     opts.composition,
+			DenyList:                  denyList.List(),
+			OnHandshake:               onHandshake,
 		},
 	)
 	if err != nil {
 		if shutdownErr := identityShutdown(); shutdownErr != nil {
-			return nil, nil, fmt.Errorf("failed to create server TLS config: %w (cleanup error: %v)", err, shutdownErr)
+			return nil, fmt.Errorf("failed to create server TLS config: %w (cleanup error: %v)", err, shutdownErr)
+		}
+		return nil, fmt.Errorf("failed to create server TLS config: %w", err)
+	}
+
+	shutdownCfg, err := config.ParseServerShutdown(cfg.Server, prefix)
+	if err != nil {
+		_ = identityShutdown()
+		return nil, fmt.Errorf("invalid server config: %w", err)
+	}
+	if opts.shutdownTimeout > 0 {
+		shutdownCfg.Timeout = opts.shutdownTimeout
+	}
+
+	rules, err := parseAuthorization(cfg.Server.Authorization, prefix)
+	if err != nil {
+		_ = identityShutdown()
+		return nil, fmt.Errorf("invalid server config: %w", err)
+	}
+	if len(rules) > 0 {
+		handler = spiffehttp.RequireRules(spiffehttp.ErrorFormatAuto, rules...)(handler)
+	}
+
+	// Patterns were validated above, so parsing cannot fail here
+	var patterns []*spiffehttp.IDPattern
+	for _, raw := range cfg.Server.AllowedClientSPIFFEIDPatterns {
+		if pattern, err := spiffehttp.ParseIDPattern(raw); err == nil {
+			patterns = append(patterns, pattern)
 		}
-		return nil, nil, fmt.Errorf("failed to create server TLS config: %w", err)
 	}
 
-	// Wrap handler to inject peer identity into request context
-	wrapped := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if peer, ok := spiffehttp.PeerFromRequest(r); ok {
-			r = r.WithContext(spiffehttp.WithPeer(r.Context(), peer))
+	// Wrap handler to inject peer identity, computed once per connection, and
+	// the values captured by the first matching ID pattern, into request
+	// context. Clients denied after their connection was established are
+	// turned away here.
+	wrapped := spiffehttp.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auditor != nil {
+			r = r.WithContext(spiffehttp.WithDecisionHook(r.Context(), auditor.hook(r)))
+		}
+		if peer, ok := spiffehttp.PeerFromContext(r.Context()); ok {
+			if err := denyList.denyRequest(w, r, peer); err != nil {
+				auditor.request(r, spiffehttp.Decision{Status: http.StatusForbidden, PeerID: peer.ID, Reason: err.Error()}, "deny_list")
+				return
+			}
+			if vars, ok := spiffehttp.MatchIDPatterns(patterns, peer.ID); ok {
+				r = r.WithContext(spiffehttp.WithIDVars(r.Context(), vars))
+			}
 		}
 		handler.ServeHTTP(w, r)
-	})
+	}))
+
+	// Count running handlers so shutdown can wait for hijacked connections too
+	requests := &requestTracker{}
 
 	// Create HTTP server with mTLS
-	srv = &http.Server{
+	srv := &http.Server{
 		Addr:              cfg.Server.ListenAddr,
-		Handler:           wrapped,
+		Handler:           requests.track(conns.track(wrapped)),
 		TLSConfig:         tlsCfg,
-		ReadHeaderTimeout: 10 * time.Second,
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+		ConnContext:       connContext(conns, opts.connContext),
+		ConnState:         conns.connState,
 	}
 
 	// Enable debug logging if E5S_DEBUG is set
 	if debugEnabled {
 		srv.ErrorLog = log.New(os.Stderr, "e5s/http: ", log.LstdFlags|log.Lshortfile)
-		debugf("server config_path=%q listen_addr=%q allowed_client_spiffe_id=%q allowed_client_trust_domain=%q",
-			configPath,
+	}
+
+	// User hooks run last so they can override any of the defaults above
+	for _, hook := range opts.httpServerHooks {
+		hook(srv)
+	}
+	// Handshakes run on per-connection copies of tlsCfg, which do not see the
+	// ALPN protocols ServeTLS sets on its own copy: advertise only those the
+	// server, as configured by the hooks, speaks
+	if srv.TLSConfig != nil {
+		srv.TLSConfig.NextProtos = spiffehttp.ServerNextProtos(srv)
+	}
+
+	if debugEnabled {
+		debugf("server listen_addr=%q allowed_client_spiffe_id=%q allowed_client_spiffe_ids=%q allowed_client_trust_domain=%q allowed_client_trust_domains=%q allowed_client_spiffe_id_patterns=%q authorization_rules=%d deny_list_file=%q max_connection_age=%v",
 			cfg.Server.ListenAddr,
 			cfg.Server.AllowedClientSPIFFEID,
+			cfg.Server.AllowedClientSPIFFEIDs,
 			cfg.Server.AllowedClientTrustDomain,
+			cfg.Server.AllowedClientTrustDomains,
+			cfg.Server.AllowedClientSPIFFEIDPatterns,
+			len(rules),
+			cfg.Server.DenyListFile,
+			maxConnectionAge,
 		)
 	}
 
-	return srv, identityShutdown, nil
+	return &Server{
+		httpServer:       srv,
+		source:           x509Source,
+		identityShutdown: identityShutdown,
+		opts:             opts,
+		shutdown:         shutdownCfg,
+		requests:         requests,
+		healthAddr:       strings.TrimSpace(cfg.Server.HealthListenAddr),
+		handshakes:       handshakes,
+		conns:            conns,
+		denyList:         denyList,
+	}, nil
+}
+
+// connContext returns the server's ConnContext: spiffehttp.ConnContext, so
+// the peer is extracted once per connection, and the connection for conns to
+// count requests against, followed by the user's hook from WithConnContext,
+// if any.
+func connContext(conns *connTracker, user func(ctx context.Context, c net.Conn) context.Context) func(ctx context.Context, c net.Conn) context.Context {
+	return func(ctx context.Context, c net.Conn) context.Context {
+		ctx = spiffehttp.ConnContext(ctx, c)
+		ctx = conns.withConn(ctx, c)
+		if user != nil {
+			ctx = user(ctx, c)
+		}
+		return ctx
+	}
 }
 
 // buildServer constructs the HTTP server and SPIRE identity source used by both Start and StartSingleThread.
@@ -237,15 +531,10 @@ func buildServerWithContext(ctx context.Context, configPath string, handler http
 // identical configuration, SPIRE wiring, and TLS setup. It uses context.Background() internally.
 //
 // Returns:
-//   - srv: configured HTTP server ready to serve
-//   - identityShutdown: function to release SPIRE resources (idempotent)
+//   - srv: configured server ready to bind and serve
 //   - err: if config loading, SPIRE connection, or TLS setup fails
-func buildServer(configPath string, handler http.Handler) (
-	srv *http.Server,
-	identityShutdown func() error,
-	err error,
-) {
-	return buildServerWithContext(context.Background(), configPath, handler)
+func buildServer(configPath string, handler http.Handler, opts *serverOptions) (*Server, error) {
+	return buildServerWithContext(context.Background(), configPath, handler, opts)
 }
 
 // Start starts a production-grade mTLS server using SPIRE.
@@ -266,44 +555,63 @@ func buildServer(configPath string, handler http.Handler) (
 //	  workload_socket: unix:///tmp/spire-agent/public/api.sock
 //	server:
 //	  listen_addr: ":8443"
-//	  # Exactly one of these:
-//	  allowed_client_spiffe_id: "spiffe://example.org/client"
-//	  # OR
-//	  allowed_client_trust_domain: "example.org"
+//	  # At least one of these; a client matching any entry is allowed
+//	  allowed_client_spiffe_ids:
+//	    - "spiffe://example.org/client"
+//	  allowed_client_trust_domains:
+//	    - "partner.org"
+//	  allowed_client_spiffe_id_patterns:
+//	    - "spiffe://example.org/ns/{namespace}/sa/*"
+//
+// The single-value allowed_client_spiffe_id and allowed_client_trust_domain
+// fields are accepted too, and combine with the lists the same way.
 //
 // The handler can extract authenticated peer identity using PeerInfo(r) or PeerID(r).
 //
-// Returns:
-//   - shutdown: function to gracefully stop the server and release resources
-//   - error: if config loading, SPIRE connection, or server startup fails
+// Options tune the underlying server without giving up the e5s wiring:
 //
-// Shutdown semantics:
-//   - The shutdown function is safe to call multiple times (idempotent)
-//   - First call initiates graceful shutdown with 5-second timeout
-//   - Subsequent calls return the result of the first shutdown
-//   - Shutdown does NOT wait for in-flight requests (use sync.WaitGroup if needed)
-//   - After shutdown, the SPIRE source is closed and cannot be reused
+//	srv, err := e5s.Start("e5s.yaml", handler,
+//	    e5s.WithHTTPServer(func(s *http.Server) {
+//	        s.IdleTimeout = 2 * time.Minute
+//	        s.WriteTimeout = 0 // long-polling endpoints
+//	    }),
+//	    e5s.WithShutdownTimeout(30*time.Second),
+//	)
+//
+// The listener is bound before Start returns, so bind errors (address in use,
+// permission denied) are reported here rather than lost in a goroutine, and
+// srv.Addr() reports the actual port when listen_addr uses port 0.
+//
+// Returns:
+//   - srv: handle to the running server (see Server for Shutdown, Addr, Done, Identity)
+//   - error: if config loading, SPIRE connection, or binding the listener fails
 //
 // Usage:
 //
-//	shutdown, err := e5s.Start("e5s.yaml", myHandler)
+//	srv, err := e5s.Start("e5s.yaml", myHandler)
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
 //
-//	// Wait for interrupt signal
-//	sigChan := make(chan os.Signal, 1)
-//	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-//	<-sigChan
+//	// Wait for interrupt signal or server failure
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+//	defer stop()
+//	select {
+//	case <-ctx.Done():
+//	case err := <-srv.Done():
+//	    log.Printf("server stopped: %v", err)
+//	}
 //
 //	// Gracefully shutdown
-//	if err := shutdown(); err != nil {
+//	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//	defer cancel()
+//	if err := srv.Shutdown(shutdownCtx); err != nil {
 //	    log.Printf("Shutdown error: %v", err)
 //	    os.Exit(1)
 //	}
 //	os.Exit(0)
-func Start(configPath string, handler http.Handler) (shutdown func() error, err error) {
-	return StartWithContext(context.Background(), configPath, handler)
+func Start(configPath string, handler http.Handler, opts ...ServerOption) (*Server, error) {
+	return StartWithContext(context.Background(), configPath, handler, opts...)
 }
 
 // StartWithContext starts an mTLS server with a custom context for SPIRE initialization.
@@ -323,76 +631,90 @@ func Start(configPath string, handler http.Handler) (shutdown func() error, err
 // Otherwise, use Start() which uses context.Background() internally.
 //
 // Returns:
-//   - shutdown: function to gracefully stop the server and release resources
-//   - error: if config loading, SPIRE connection, or server startup fails
+//   - srv: handle to the running server
+//   - error: if config loading, SPIRE connection, or binding the listener fails
 //
 // Usage:
 //
 //	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 //	defer cancel()
 //
-//	shutdown, err := e5s.StartWithContext(ctx, "e5s.yaml", myHandler)
+//	srv, err := e5s.StartWithContext(ctx, "e5s.yaml", myHandler)
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
-//	defer shutdown()
-func StartWithContext(ctx context.Context, configPath string, handler http.Handler) (shutdown func() error, err error) {
-	srv, identityShutdown, err := buildServerWithContext(ctx, configPath, handler)
+//	defer srv.Shutdown(context.Background())
+func StartWithContext(ctx context.Context, configPath string, handler http.Handler, opts ...ServerOption) (*Server, error) {
+	return startWithOptions(ctx, configPath, handler, newServerOptions(opts))
+}
+
+// startWithOptions is StartWithContext with options already applied.
+func startWithOptions(ctx context.Context, configPath string, handler http.Handler, o *serverOptions) (*Server, error) {
+	srv, err := buildServerWithContext(ctx, configPath, handler, o)
 	if err != nil {
 		return nil, err
 	}
 
-	// Channel to capture server startup errors
-	errCh := make(chan error, 1)
-
-	// Start server in background
-	go func() {
-		err := srv.ListenAndServeTLS("", "")
-		if err != nil && err != http.ErrServerClosed {
-			errCh <- err
-		}
-	}()
-
-	// Give server a moment to bind or fail
-	select {
-	case err := <-errCh:
-		if shutdownErr := identityShutdown(); shutdownErr != nil {
-			return nil, fmt.Errorf("server startup failed: %w (cleanup error: %v)", err, shutdownErr)
-		}
-		return nil, fmt.Errorf("server startup failed: %w", err)
-	case <-time.After(100 * time.Millisecond):
-		// Server started successfully
+	if err := srv.start(); err != nil {
+		return nil, err
 	}
+	return srv, nil
+}
 
-	// Ensure shutdown is only executed once
-	var shutdownOnce sync.Once
-	var shutdownErr error
+// StartWithConfig starts an mTLS server from an in-memory configuration.
+//
+// This is identical to StartWithContext() except that the configuration is
+// supplied directly instead of being read from a YAML file. Use it when your
+// configuration comes from flags, environment variables or a remote config
+// service and you don't want to write a temporary e5s.yaml.
+//
+// cfg goes through the same validation as a config file (config.ValidateServerConfig),
+// so the same fields are required and the same errors are reported.
+//
+// Usage:
+//
+//	srv, err := e5s.StartWithConfig(ctx, e5s.ServerConfig{
+//	    SPIRE: e5s.SPIRESection{
+//	        WorkloadSocket: os.Getenv("SPIFFE_ENDPOINT_SOCKET"),
+//	    },
+//	    Server: e5s.ServerSection{
+//	        ListenAddr:               *listenAddr,
+//	        AllowedClientTrustDomain: "example.org",
+//	    },
+//	}, myHandler)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer srv.Shutdown(context.Background())
+func StartWithConfig(ctx context.Context, cfg ServerConfig, handler http.Handler, opts ...ServerOption) (*Server, error) {
+	o := newServerOptions(opts)
 
-	// Return shutdown function
-	shutdownFunc := func() error {
-		shutdownOnce.Do(func() {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
+	spireConfig, err := validateServerConfig(&cfg, o)
+	if err != nil {
+		return nil, err
+	}
 
-			err1 := srv.Shutdown(ctx)
-			err2 := identityShutdown()
-			shutdownErr = firstErr(err1, err2)
-		})
-		return shutdownErr
+	srv, err := buildServerFromConfig(ctx, cfg, spireConfig, handler, o)
+	if err != nil {
+		return nil, err
 	}
 
-	return shutdownFunc, nil
+	if err := srv.start(); err != nil {
+		return nil, err
+	}
+	return srv, nil
 }
 
 // Serve starts an mTLS server with graceful shutdown handling.
 //
 // This is a convenience wrapper around Start() that handles signal management
 // and graceful shutdown automatically. It blocks until receiving SIGINT or SIGTERM,
-// then performs graceful shutdown with a 5-second timeout.
+// then performs a graceful drain bounded by server.shutdown_timeout (5 seconds
+// by default).
 //
 // Use Serve() for typical servers that need standard signal handling.
+// Use ServeContext() to stop the server from your own supervisor or errgroup.
 // Use Start() if you need:
-//   - Custom shutdown triggers (not just signals)
 //   - Multiple servers or complex lifecycle management
 //   - Integration with existing shutdown orchestration
 //
@@ -401,12 +723,14 @@ func StartWithContext(ctx context.Context, configPath string, handler http.Handl
 // The function blocks until:
 //   - SIGINT is received (e.g., user presses Ctrl+C)
 //   - SIGTERM is received (e.g., Kubernetes pod termination)
+//   - The server stops serving because of an error
 //
-// Then it:
+// Then it drains the server as described in Server.Shutdown:
+//   - Withdraws readiness and keeps serving for server.drain_delay
 //   - Stops accepting new connections
-//   - Waits up to 5 seconds for in-flight requests to complete
+//   - Waits for in-flight requests, including hijacked connections, to complete
 //   - Closes SPIRE resources
-//   - Returns any shutdown errors
+//   - Returns the server error, if any, otherwise any shutdown error
 //
 // Usage:
 //
@@ -420,23 +744,75 @@ func StartWithContext(ctx context.Context, configPath string, handler http.Handl
 //	}
 //
 // For debug-friendly single-threaded execution, use StartSingleThread() instead.
-func Serve(configPath string, handler http.Handler) error {
-	shutdown, err := Start(configPath, handler)
+func Serve(configPath string, handler http.Handler, opts ...ServerOption) error {
+	return ServeContext(context.Background(), configPath, handler, opts...)
+}
+
+// ServeContext starts an mTLS server and blocks until ctx is done, a handled
+// signal arrives, or the server fails.
+//
+// It behaves like Serve() but lets the caller decide when to stop:
+//   - Cancelling ctx drains the server and returns nil
+//   - If the server stops serving on its own (for example the listener fails),
+//     the error is returned instead of being swallowed
+//   - Startup errors (config, SPIRE, bind) are returned immediately
+//
+// SIGINT and SIGTERM are handled by default, as with Serve(). Use
+// WithSignals() to handle a different set, or WithSignals() with no
+// arguments to leave signal handling entirely to the caller.
+//
+// ctx is also used for SPIRE initialization, like StartWithContext().
+//
+// Usage with errgroup:
+//
+//	g, ctx := errgroup.WithContext(ctx)
+//	g.Go(func() error {
+//	    return e5s.ServeContext(ctx, "e5s.yaml", handler, e5s.WithSignals())
+//	})
+//	g.Go(func() error { return runWorker(ctx) })
+//	if err := g.Wait(); err != nil {
+//	    log.Fatal(err)
+//	}
+func ServeContext(ctx context.Context, configPath string, handler http.Handler, opts ...ServerOption) error {
+	o := newServerOptions(opts)
+
+	srv, err := startWithOptions(ctx, configPath, handler, o)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if shutdownErr := shutdown(); shutdownErr != nil {
-			fmt.Fprintf(os.Stderr, "Shutdown error: %v\n", shutdownErr)
+
+	serveErr := waitForStop(ctx, o, srv.Done())
+	if serveErr != nil {
+		serveErr = fmt.Errorf("server exited with error: %w", serveErr)
+	}
+
+	if shutdownErr := srv.shutdownWithTimeout(); shutdownErr != nil {
+		if serveErr != nil {
+			return fmt.Errorf("%w (shutdown error: %v)", serveErr, shutdownErr)
 		}
-	}()
+		return fmt.Errorf("shutdown failed: %w", shutdownErr)
+	}
+	return serveErr
+}
 
-	// Wait for interrupt signal using context-based cancellation
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
-	defer stop()
+// waitForStop blocks until ctx is done, one of the signals selected by
+// WithSignals arrives, or a value is received from exited.
+//
+// It returns the received error, or nil if the caller asked to stop.
+func waitForStop(ctx context.Context, o *serverOptions, exited <-chan error) error {
+	if len(o.signals) > 0 {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, o.signals...)
+		defer stop()
+	}
 
-	<-ctx.Done()
-	return nil
+	select {
+	case <-ctx.Done():
+		debugf("server stopping: %v", context.Cause(ctx))
+		return nil
+	case err := <-exited:
+		return err
+	}
 }
 
 // StartSingleThread starts an mTLS server using SPIRE and blocks in the calling goroutine.
@@ -486,19 +862,25 @@ func Serve(configPath string, handler http.Handler) error {
 //	}
 //
 // For production deployments with graceful shutdown, use Start() or Serve() instead.
-func StartSingleThread(configPath string, handler http.Handler) error {
-	srv, identityShutdown, err := buildServer(configPath, handler)
+func StartSingleThread(configPath string, handler http.Handler, opts ...ServerOption) error {
+	o := newServerOptions(opts)
+
+	srv, err := buildServer(configPath, handler, o)
 	if err != nil {
 		return err
 	}
 	defer func() {
 		// Best effort cleanup - ignore errors during shutdown
-		_ = identityShutdown()
+		_ = srv.closeHealth()
+		_ = srv.identityShutdown()
 	}()
 
+	if err := srv.listen(); err != nil {
+		return err
+	}
+
 	// Run server in the current goroutine (blocks here)
-	err = srv.ListenAndServeTLS("", "")
-	if err != nil && err != http.ErrServerClosed {
+	if err := srv.serve(); err != nil {
 		return fmt.Errorf("server exited with error: %w", err)
 	}
 
@@ -566,6 +948,30 @@ func PeerID(r *http.Request) (string, bool) {
 	return peer.ID.String(), true
 }
 
+// PeerVars returns the values captured from the caller's SPIFFE ID by the
+// first matching server.allowed_client_spiffe_id_patterns entry.
+//
+// With the pattern "spiffe://prod.corp/ns/{namespace}/sa/billing-*", a
+// request from spiffe://prod.corp/ns/acme/sa/billing-api yields
+// {"namespace": "acme"}, so handlers can enforce tenant isolation without
+// parsing the ID again.
+//
+// Returns false if the caller was allowed by an exact ID or trust domain
+// instead of a pattern, or the request was not served by e5s.
+//
+// Usage in handler:
+//
+//	func myHandler(w http.ResponseWriter, r *http.Request) {
+//	    vars, ok := e5s.PeerVars(r)
+//	    if !ok || vars["namespace"] != r.PathValue("tenant") {
+//	        http.Error(w, "forbidden", http.StatusForbidden)
+//	        return
+//	    }
+//	}
+func PeerVars(r *http.Request) (map[string]string, bool) {
+	return spiffehttp.IDVarsFromContext(r.Context())
+}
+
 // WithClient creates an mTLS client, executes the provided function, and handles cleanup.
 //
 // This is a convenience wrapper around Client() that manages the client lifecycle
@@ -630,10 +1036,17 @@ func WithClient(configPath string, fn func(*http.Client) error) error {
 //	spire:
 //	  workload_socket: unix:///tmp/spire-agent/public/api.sock
 //	client:
-//	  # Exactly one of these:
-//	  expected_server_spiffe_id: "spiffe://example.org/api-server"
-//	  # OR
-//	  expected_server_trust_domain: "example.org"
+//	  # At least one of these; a server matching any entry is accepted
+//	  expected_server_spiffe_ids:
+//	    - "spiffe://example.org/api-server"
+//	  expected_server_trust_domains:
+//	    - "partner.org"
+//	  expected_server_spiffe_id_patterns:
+//	    - "spiffe://example.org/ns/*/sa/api"
+//
+// The single-value expected_server_spiffe_id and expected_server_trust_domain
+// fields are accepted too, and combine with the lists the same way.
+// client.destinations sets a different expectation per host.
 //
 // Returns:
 //   - client: HTTP client ready for mTLS connections
@@ -660,8 +1073,8 @@ func WithClient(configPath string, fn func(*http.Client) error) error {
 //	    log.Fatal(err)
 //	}
 //	defer resp.Body.Close()
-func Client(configPath string) (*http.Client, func() error, error) {
-	return ClientWithContext(context.Background(), configPath)
+func Client(configPath string, opts ...ClientOption) (*http.Client, func() error, error) {
+	return ClientWithContext(context.Background(), configPath, opts...)
 }
 
 // ClientWithContext returns an HTTP client configured for mTLS using SPIRE with a custom context.
@@ -695,53 +1108,200 @@ func Client(configPath string) (*http.Client, func() error, error) {
 //	    log.Fatal(err)
 //	}
 //	defer shutdown()
-func ClientWithContext(ctx context.Context, configPath string) (*http.Client, func() error, error) {
+func ClientWithContext(ctx context.Context, configPath string, opts ...ClientOption) (*http.Client, func() error, error) {
 	// Load and validate configuration
 	cfg, spireConfig, err := loadClientConfig(configPath)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	debugf("client config_path=%q", configPath)
+
+	return buildClientFromConfig(ctx, cfg, spireConfig, newClientOptions(opts))
+}
+
+// NewClient returns an HTTP client configured for mTLS from an in-memory configuration.
+//
+// This is identical to ClientWithContext() except that the configuration is
+// supplied directly instead of being read from a YAML file.
+//
+// cfg goes through the same validation as a config file (config.ValidateClientConfig).
+//
+// Usage:
+//
+//	client, shutdown, err := e5s.NewClient(ctx, e5s.ClientConfig{
+//	    SPIRE: e5s.SPIRESection{
+//	        WorkloadSocket: "unix:///tmp/spire-agent/public/api.sock",
+//	    },
+//	    Client: e5s.ClientSection{
+//	        ExpectedServerSPIFFEID: "spiffe://example.org/api-server",
+//	    },
+//	})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer shutdown()
+func NewClient(ctx context.Context, cfg ClientConfig, opts ...ClientOption) (*http.Client, func() error, error) {
+	spireConfig, err := validateClientConfig(&cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return buildClientFromConfig(ctx, cfg, spireConfig, newClientOptions(opts))
+}
+
+// buildClientFromConfig constructs the mTLS HTTP client and SPIRE identity source
+// from an already validated configuration.
+func buildClientFromConfig(ctx context.Context, cfg config.ClientFileConfig, spireConfig config.SPIREConfig, opts *clientOptions) (*http.Client, func() error, error) {
 	// Centralized SPIRE setup with provided context
-	x509Source, identityShutdown, err := newSPIRESource(
-		ctx,
-		cfg.SPIRE.WorkloadSocket,
-		spireConfig.InitialFetchTimeout,
-	)
+	x509Source, identityShutdown, err := newIdentitySource(ctx, cfg.SPIRE, cfg.Identity, spireConfig)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create SPIRE source: %w", err)
+		return nil, nil, err
 	}
 
-	// Build client TLS config with server verification
-	tlsCfg, err := spiffehttp.NewClientTLSConfig(
-		ctx,
-		x509Source,
-		x509Source,
-		spiffehttp.ClientConfig{
-			ExpectedServerID:          cfg.Client.ExpectedServerSPIFFEID,
-			ExpectedServerTrustDomain: cfg.Client.ExpectedServerTrustDomain,
-		},
-	)
+	httpClient, stop, err := newClient(ctx, cfg, x509Source, opts)
 	if err != nil {
 		if shutdownErr := identityShutdown(); shutdownErr != nil {
-			return nil, nil, fmt.Errorf("failed to create client TLS config: %w (cleanup error: %v)", err, shutdownErr)
+			return nil, nil, fmt.Errorf("%w (cleanup error: %v)", err, shutdownErr)
+		}
+		return nil, nil, err
+	}
+
+	shutdown := func() error {
+		stop()
+		return identityShutdown()
+	}
+	return httpClient, shutdown, nil
+}
+
+// newClient constructs the mTLS HTTP client on top of an existing SPIRE source.
+// The caller keeps ownership of the source, and calls stop once the client is
+// no longer used to end the client's background work (deny list reloads).
+func newClient(ctx context.Context, cfg config.ClientFileConfig, x509Source identitySource, opts *clientOptions) (client *http.Client, stop func(), err error) {
+	settings, err := config.ParseClientTransport(cfg.Client.Transport)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid client config: %w", err)
+	}
+	for _, override := range opts.transport {
+		override(&settings)
+	}
+
+	// On reload, idle connections are closed so the next request handshakes
+	// again and is checked against the new entries. The watcher is started
+	// once routing is complete.
+	routing := &destinationTransport{attachPeer: opts.serverPeerInContext}
+	// Close connections whose server is no longer trusted
+	conns := newConnTracker(x509Source, 0)
+	routing.conns = conns
+	denyList, err := loadDenyList(strings.TrimSpace(cfg.Client.DenyListFile), routing.CloseIdleConnections)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid client config: client.deny_list_file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			denyList.Stop()
+		}
+	}()
+
+	// newTransport builds an mTLS transport verifying the server against
+	// policy. Each expected identity gets its own transport, so pooled
+	// connections are never shared between identities.
+	newTransport := func(policy spiffehttp.ClientConfig) (*http.Transport, error) {
+		policy.Authorizer = opts.authorizer
+		policy.AuthorizerComposition = opts.composition
+		policy.DenyList = denyList.List()
+		tlsCfg, err := spiffehttp.NewClientTLSConfig(ctx, x509Source, x509Source, policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client TLS config: %w", err)
+		}
+		dialer := &net.Dialer{
+			Timeout:   settings.DialTimeout,
+			KeepAlive: settings.KeepAlive,
+		}
+		transport := &http.Transport{
+			TLSClientConfig:       tlsCfg,
+			DialContext:           conns.dialContext(dialer.DialContext),
+			TLSHandshakeTimeout:   settings.TLSHandshakeTimeout,
+			ResponseHeaderTimeout: settings.ResponseHeaderTimeout,
+			IdleConnTimeout:       settings.IdleConnTimeout,
+			MaxIdleConns:          settings.MaxIdleConns,
+			MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+			ForceAttemptHTTP2:     settings.ForceHTTP2,
+		}
+		if settings.ProxyFromEnvironment {
+			transport.Proxy = http.ProxyFromEnvironment
+		}
+		return transport, nil
+	}
+
+	routing.byHost = make(map[string]*http.Transport, len(cfg.Client.Destinations))
+	routing.newTransport = newTransport
+	for raw, d := range cfg.Client.Destinations {
+		key, err := config.DestinationKey(raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid client config: client.destinations[%q]: %w", raw, err)
+		}
+		routing.byHost[key], err = newTransport(spiffehttp.ClientConfig{
+			ExpectedServerID:           d.ExpectedServerSPIFFEID,
+			ExpectedServerIDs:          d.ExpectedServerSPIFFEIDs,
+			ExpectedServerTrustDomain:  d.ExpectedServerTrustDomain,
+			ExpectedServerTrustDomains: d.ExpectedServerTrustDomains,
+			ExpectedServerIDPatterns:   d.ExpectedServerSPIFFEIDPatterns,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("client.destinations[%q]: %w", raw, err)
+		}
+	}
+
+	// The expected_server_* policy serves hosts not in client.destinations.
+	// Without destinations it is required; with them, leaving it empty
+	// rejects unlisted hosts.
+	fallback := spiffehttp.ClientConfig{
+		ExpectedServerID:           cfg.Client.ExpectedServerSPIFFEID,
+		ExpectedServerIDs:          cfg.Client.ExpectedServerSPIFFEIDs,
+		ExpectedServerTrustDomain:  cfg.Client.ExpectedServerTrustDomain,
+		ExpectedServerTrustDomains: cfg.Client.ExpectedServerTrustDomains,
+		ExpectedServerIDPatterns:   cfg.Client.ExpectedServerSPIFFEIDPatterns,
+	}
+	if len(routing.byHost) == 0 || hasExpectedServer(fallback) {
+		routing.fallback, err = newTransport(fallback)
+		if err != nil {
+			return nil, nil, err
 		}
-		return nil, nil, fmt.Errorf("failed to create client TLS config: %w", err)
 	}
 
-	// Create HTTP client with mTLS
 	httpClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsCfg,
-		},
+		Transport: routing,
+		Timeout:   settings.Timeout,
 	}
 
 	// Enable debug logging if E5S_DEBUG is set
-	debugf("client config_path=%q expected_server_spiffe_id=%q expected_server_trust_domain=%q",
-		configPath,
+	debugf("client expected_server_spiffe_id=%q expected_server_spiffe_ids=%q expected_server_trust_domain=%q expected_server_trust_domains=%q expected_server_spiffe_id_patterns=%q destinations=%d deny_list_file=%q timeout=%v dial_timeout=%v",
 		cfg.Client.ExpectedServerSPIFFEID,
+		cfg.Client.ExpectedServerSPIFFEIDs,
 		cfg.Client.ExpectedServerTrustDomain,
+		cfg.Client.ExpectedServerTrustDomains,
+		cfg.Client.ExpectedServerSPIFFEIDPatterns,
+		len(routing.byHost),
+		cfg.Client.DenyListFile,
+		settings.Timeout,
+		settings.DialTimeout,
 	)
 
-	return httpClient, identityShutdown, nil
+	denyList.Start()
+	conns.Start()
+	return httpClient, func() {
+		denyList.Stop()
+		conns.Stop()
+	}, nil
+}
+
+// hasExpectedServer reports whether cfg sets any expected server ID, trust
+// domain or ID pattern.
+func hasExpectedServer(cfg spiffehttp.ClientConfig) bool {
+	values := slices.Concat(
+		[]string{cfg.ExpectedServerID, cfg.ExpectedServerTrustDomain},
+		cfg.ExpectedServerIDs, cfg.ExpectedServerTrustDomains, cfg.ExpectedServerIDPatterns,
+	)
+	return slices.ContainsFunc(values, func(v string) bool { return strings.TrimSpace(v) != "" })
 }
@@ -0,0 +1,85 @@
+package e5s_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sufield/e5s"
+	"github.com/sufield/e5s/spire"
+)
+
+// TestIdentityDev_RoundTrip verifies that a server and a client with dev
+// identities in the same trust domain trust each other, without SPIRE.
+func TestIdentityDev_RoundTrip(t *testing.T) {
+	t.Setenv(spire.DevIdentityEnv, "1")
+	const serverID = "spiffe://example.org/api"
+	const clientID = "spiffe://example.org/client"
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerID, ok := e5s.PeerID(r)
+		if !ok {
+			http.Error(w, "no peer", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, peerID)
+	})
+
+	srv, err := e5s.StartWithConfig(context.Background(), e5s.ServerConfig{
+		Identity: e5s.IdentitySection{Mode: "dev", SPIFFEID: serverID},
+		Server: e5s.ServerSection{
+			ListenAddr:            "127.0.0.1:0",
+			AllowedClientSPIFFEID: clientID,
+		},
+	}, handler)
+	if err != nil {
+		t.Fatalf("StartWithConfig() error = %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	client, shutdown, err := e5s.NewClient(context.Background(), e5s.ClientConfig{
+		Identity: e5s.IdentitySection{Mode: "dev", SPIFFEID: clientID, SVIDTTL: "5m"},
+		Client:   e5s.ClientSection{ExpectedServerSPIFFEID: serverID},
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer shutdown()
+
+	resp, err := client.Get(fmt.Sprintf("https://%s/", srv.Addr()))
+	if err != nil {
+		t.Fatalf("client request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != clientID {
+		t.Errorf("response = %d %q, want 200 %q", resp.StatusCode, body, clientID)
+	}
+}
+
+// TestIdentityDev_RequiresEnv verifies that dev mode refuses to start unless
+// explicitly allowed.
+func TestIdentityDev_RequiresEnv(t *testing.T) {
+	t.Setenv(spire.DevIdentityEnv, "")
+
+	srv, err := e5s.StartWithConfig(context.Background(), e5s.ServerConfig{
+		Identity: e5s.IdentitySection{Mode: "dev", SPIFFEID: "spiffe://example.org/api"},
+		Server: e5s.ServerSection{
+			ListenAddr:               "127.0.0.1:0",
+			AllowedClientTrustDomain: "example.org",
+		},
+	}, http.NotFoundHandler())
+	if err == nil {
+		_ = srv.Shutdown(context.Background())
+		t.Fatal("StartWithConfig() in dev mode without the env guard should fail")
+	}
+	if !strings.Contains(err.Error(), spire.DevIdentityEnv) {
+		t.Errorf("StartWithConfig() error = %q, want it to name %s", err, spire.DevIdentityEnv)
+	}
+}
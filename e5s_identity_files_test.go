@@ -0,0 +1,145 @@
+package e5s_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sufield/e5s"
+)
+
+// writeIdentityFiles writes a CA bundle and an X.509 SVID for id to dir, the
+// way spiffe-helper does, and returns the identity section reading them.
+func writeIdentityFiles(t *testing.T, dir, id string) e5s.IdentitySection {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(30 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{u},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identity := e5s.IdentitySection{
+		Mode:       "files",
+		CertFile:   filepath.Join(dir, "svid.pem"),
+		KeyFile:    filepath.Join(dir, "svid_key.pem"),
+		BundleFile: filepath.Join(dir, "svid_bundle.pem"),
+	}
+	for path, block := range map[string]*pem.Block{
+		identity.CertFile:   {Type: "CERTIFICATE", Bytes: der},
+		identity.KeyFile:    {Type: "PRIVATE KEY", Bytes: keyDER},
+		identity.BundleFile: {Type: "CERTIFICATE", Bytes: caDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return identity
+}
+
+// TestIdentityFiles_RoundTrip verifies that a server and a client get their
+// identity from files, without a Workload API.
+func TestIdentityFiles_RoundTrip(t *testing.T) {
+	const id = "spiffe://example.org/workload"
+	identity := writeIdentityFiles(t, t.TempDir(), id)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peerID, ok := e5s.PeerID(r)
+		if !ok {
+			http.Error(w, "no peer", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, peerID)
+	})
+
+	srv, err := e5s.StartWithConfig(context.Background(), e5s.ServerConfig{
+		Identity: identity,
+		Server: e5s.ServerSection{
+			ListenAddr:            "127.0.0.1:0",
+			AllowedClientSPIFFEID: id,
+		},
+	}, handler)
+	if err != nil {
+		t.Fatalf("StartWithConfig() error = %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	if got, err := srv.Identity(); err != nil || got.String() != id {
+		t.Errorf("Identity() = %v, %v, want %s", got, err, id)
+	}
+
+	client, shutdown, err := e5s.NewClient(context.Background(), e5s.ClientConfig{
+		Identity: identity,
+		Client:   e5s.ClientSection{ExpectedServerSPIFFEID: id},
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer shutdown()
+
+	resp, err := client.Get(fmt.Sprintf("https://%s/", srv.Addr()))
+	if err != nil {
+		t.Fatalf("client request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != id {
+		t.Errorf("response = %d %q, want 200 %q", resp.StatusCode, body, id)
+	}
+}
@@ -4,10 +4,9 @@
 package e5s_test
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -45,10 +44,9 @@ func TestServe_StartFailurePropagation(t *testing.T) {
 	}
 }
 
-// TestServe_DeferredShutdownExecution tests that shutdown is called via defer.
-// This verifies e5s.go:428-432 (defer mechanism and error logging).
-// We test this by verifying normal shutdown path works correctly.
-func TestServe_DeferredShutdownExecution(t *testing.T) {
+// TestServeContext_CancelShutsDown verifies that canceling ctx drains the
+// server and ServeContext returns nil.
+func TestServeContext_CancelShutsDown(t *testing.T) {
 	// Setup SPIRE infrastructure
 	st := testhelpers.SetupSPIRE(t)
 
@@ -70,68 +68,79 @@ server:
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 
-	// Capture stderr to verify shutdown behavior
-	oldStderr := os.Stderr
-	r, w, err := os.Pipe()
-	if err != nil {
-		t.Fatal(err)
-	}
-	os.Stderr = w
-
-	// Run Serve in goroutine with a cancellable context
-	// We'll cancel the context to trigger shutdown without using signals
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	done := make(chan error, 1)
 	go func() {
-		// Start server and let it run briefly
-		errChan := make(chan error, 1)
-		go func() {
-			errChan <- e5s.Serve(cfgPath, handler)
-		}()
-
-		// Wait for either context cancellation or server error
-		select {
-		case err := <-errChan:
-			done <- err
-		case <-ctx.Done():
-			// Context cancelled, wait a bit for cleanup then force return
-			time.Sleep(100 * time.Millisecond)
-			done <- fmt.Errorf("context cancelled")
-		}
+		done <- e5s.ServeContext(ctx, cfgPath, handler, e5s.WithSignals())
 	}()
 
-	// Let server start
-	time.Sleep(500 * time.Millisecond)
+	// Verify it blocks while ctx is live
+	select {
+	case err := <-done:
+		t.Fatalf("ServeContext returned before cancel: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
 
-	// Cancel context to trigger cleanup
 	cancel()
 
-	// Wait for completion
-	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer timeoutCancel()
-
 	select {
-	case <-done:
-		// Server stopped
-	case <-timeoutCtx.Done():
-		t.Log("Note: Serve is blocking as expected (waits for signal)")
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ServeContext returned error after cancel: %v", err)
+		}
+		t.Log("✓ ServeContext drained and returned after cancel")
+	case <-time.After(10 * time.Second):
+		t.Fatal("ServeContext did not return after ctx was canceled")
+	}
+}
+
+// TestServeContext_ListenerFailure verifies that a server error ends
+// ServeContext with that error instead of blocking until ctx is done.
+func TestServeContext_ListenerFailure(t *testing.T) {
+	// Setup SPIRE infrastructure
+	st := testhelpers.SetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "server.yaml")
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "unix://%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  allowed_client_trust_domain: "example.org"
+`, st.SocketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
 	}
 
-	// Close write end and restore stderr
-	w.Close()
-	os.Stderr = oldStderr
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// Read captured stderr
-	var buf bytes.Buffer
-	io.Copy(&buf, r)
-	stderrOutput := buf.String()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e5s.ServeContext(context.Background(), cfgPath, handler,
+			e5s.WithListener(ln), e5s.WithSignals())
+	}()
 
-	// In normal operation, there should be no shutdown errors
-	// This test verifies the defer mechanism is in place
-	t.Logf("✓ Serve executed with stderr: %q", stderrOutput)
-	if len(stderrOutput) > 0 {
-		t.Logf("  Stderr output present (may include shutdown messages)")
+	// Closing the listener out from under the server makes Serve fail
+	time.Sleep(500 * time.Millisecond)
+	ln.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected error after listener failure, got nil")
+		}
+		t.Logf("✓ ServeContext surfaced server error: %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("ServeContext did not return after listener failure")
 	}
 }
 
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -18,8 +19,8 @@ import (
 )
 
 // TestStartWithContext_SuccessfulStartup tests the happy path:
-// server starts in goroutine, binds successfully, responds to requests, and shuts down cleanly.
-// This covers e5s.go lines 340-395 (goroutine, errCh, shutdownOnce patterns).
+// server binds before returning, reports its address, and shuts down cleanly.
+// This covers server.go (listen, serve, Done and the shutdownOnce pattern).
 func TestStartWithContext_SuccessfulStartup(t *testing.T) {
 	// Setup SPIRE infrastructure
 	st := testhelpers.SetupSPIRE(t)
@@ -50,34 +51,50 @@ server:
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	shutdown, err := e5s.StartWithContext(ctx, cfgPath, handler)
+	srv, err := e5s.StartWithContext(ctx, cfgPath, handler)
 	if err != nil {
 		t.Fatalf("StartWithContext failed: %v", err)
 	}
 
-	// Verify shutdown function is returned
-	if shutdown == nil {
-		t.Fatal("shutdown function is nil")
+	// listen_addr uses port 0, so Addr must report the port actually bound
+	tcpAddr, ok := srv.Addr().(*net.TCPAddr)
+	if !ok || tcpAddr.Port == 0 {
+		t.Fatalf("Addr() = %v, want bound TCP address with non-zero port", srv.Addr())
 	}
 
-	// Give server time to fully start
-	time.Sleep(200 * time.Millisecond)
+	id, err := srv.Identity()
+	if err != nil {
+		t.Fatalf("Identity() failed: %v", err)
+	}
+	if id.TrustDomain().Name() != "example.org" {
+		t.Errorf("Identity() = %s, want member of example.org", id)
+	}
 
 	// Test shutdown - this verifies the shutdownOnce pattern and cleanup
-	if err := shutdown(); err != nil {
+	if err := srv.Shutdown(context.Background()); err != nil {
 		t.Errorf("shutdown failed: %v", err)
 	}
 
 	// Test multiple shutdown calls (should be idempotent via sync.Once)
-	if err := shutdown(); err != nil {
+	if err := srv.Shutdown(context.Background()); err != nil {
 		t.Errorf("second shutdown call failed: %v", err)
 	}
 
+	// Done must report a clean exit after Shutdown
+	select {
+	case err := <-srv.Done():
+		if err != nil {
+			t.Errorf("Done() = %v, want nil after Shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done() did not fire after Shutdown")
+	}
+
 	t.Log("✓ Server started successfully and shut down cleanly")
 }
 
 // TestStartWithContext_StartupError tests error handling when server fails to bind.
-// This covers e5s.go lines 358-362 (startup error path + identityShutdown cleanup).
+// This covers server.go listen (synchronous bind error + identityShutdown cleanup).
 func TestStartWithContext_StartupError(t *testing.T) {
 	// Setup SPIRE infrastructure
 	st := testhelpers.SetupSPIRE(t)
@@ -102,19 +119,17 @@ server:
 
 	// Attempt to start server - should fail due to invalid address
 	ctx := context.Background()
-	shutdown, err := e5s.StartWithContext(ctx, cfgPath, handler)
+	srv, err := e5s.StartWithContext(ctx, cfgPath, handler)
 
 	// Verify error is returned
 	if err == nil {
+		_ = srv.Shutdown(context.Background()) // Clean up if somehow succeeded
 		t.Fatal("Expected error for invalid listen address, got nil")
-		if shutdown != nil {
-			shutdown() // Clean up if somehow succeeded
-		}
 	}
 
-	// Verify shutdown function is NOT returned on failure
-	if shutdown != nil {
-		t.Error("Expected nil shutdown function on startup failure")
+	// Verify no server handle is returned on failure
+	if srv != nil {
+		t.Error("Expected nil server on startup failure")
 	}
 
 	t.Logf("✓ Startup error handled correctly: %v", err)
@@ -149,20 +164,17 @@ server:
 	// Create cancellable context
 	ctx, cancel := context.WithCancel(context.Background())
 
-	shutdown, err := e5s.StartWithContext(ctx, cfgPath, handler)
+	srv, err := e5s.StartWithContext(ctx, cfgPath, handler)
 	if err != nil {
 		t.Fatalf("StartWithContext failed: %v", err)
 	}
-	defer shutdown()
-
-	// Give server time to start
-	time.Sleep(200 * time.Millisecond)
+	defer srv.Shutdown(context.Background())
 
 	// Cancel context
 	cancel()
 
 	// Shutdown should still work after context cancellation
-	if err := shutdown(); err != nil {
+	if err := srv.Shutdown(context.Background()); err != nil {
 		t.Errorf("shutdown after context cancellation failed: %v", err)
 	}
 
@@ -183,7 +195,7 @@ func TestStart_WithRealRequests(t *testing.T) {
   initial_fetch_timeout: "30s"
 
 server:
-  listen_addr: "localhost:18444"
+  listen_addr: "localhost:0"
   allowed_client_trust_domain: "example.org"
 `, st.SocketPath)
 
@@ -221,18 +233,15 @@ client:
 	})
 
 	// Start server
-	shutdown, err := e5s.Start(serverCfgPath, handler)
+	srv, err := e5s.Start(serverCfgPath, handler)
 	if err != nil {
 		t.Fatalf("Failed to start server: %v", err)
 	}
-	defer shutdown()
-
-	// Give server time to start
-	time.Sleep(300 * time.Millisecond)
+	defer srv.Shutdown(context.Background())
 
 	// Create mTLS client and make request
 	err = e5s.WithClient(clientCfgPath, func(client *http.Client) error {
-		resp, err := client.Get("https://localhost:18444/test")
+		resp, err := client.Get("https://" + srv.Addr().String() + "/test")
 		if err != nil {
 			return fmt.Errorf("client request failed: %w", err)
 		}
@@ -264,3 +273,67 @@ client:
 
 	t.Log("✓ Server handled mTLS request successfully")
 }
+
+// TestStart_HealthEndpoints verifies /livez and /readyz on
+// server.health_listen_addr, and that readiness drops once shutdown begins.
+func TestStart_HealthEndpoints(t *testing.T) {
+	// Setup SPIRE infrastructure
+	st := testhelpers.SetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "server.yaml")
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "unix://%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "localhost:0"
+  health_listen_addr: "localhost:0"
+  allowed_client_trust_domain: "example.org"
+  shutdown_timeout: "5s"
+  drain_delay: "1s"
+`, st.SocketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	srv, err := e5s.Start(cfgPath, http.NotFoundHandler())
+	if err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	if srv.HealthAddr() == nil {
+		t.Fatal("HealthAddr() = nil with health_listen_addr set")
+	}
+	base := "http://" + srv.HealthAddr().String()
+
+	status := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := status("/livez"); got != http.StatusOK {
+		t.Errorf("/livez = %d, want 200", got)
+	}
+	if got := status("/readyz"); got != http.StatusOK {
+		t.Errorf("/readyz = %d, want 200 (Ready: %v)", got, srv.Ready())
+	}
+
+	// Start draining; the drain delay keeps the health endpoints up
+	go srv.Shutdown(context.Background())
+	time.Sleep(200 * time.Millisecond)
+
+	if got := status("/readyz"); got != http.StatusServiceUnavailable {
+		t.Errorf("/readyz while draining = %d, want 503", got)
+	}
+	if got := status("/livez"); got != http.StatusOK {
+		t.Errorf("/livez while draining = %d, want 200", got)
+	}
+}
@@ -2,11 +2,18 @@ package e5s_test
 
 import (
 	"context"
+	"crypto/tls"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/sufield/e5s"
+	"github.com/sufield/e5s/spire"
 )
 
 // TestStartSingleThread_InvalidConfig verifies StartSingleThread fails with invalid configuration.
@@ -154,6 +161,31 @@ func TestServe_InvalidConfig(t *testing.T) {
 	}
 }
 
+// TestServeContext_InvalidConfig verifies ServeContext returns startup errors
+// without waiting for ctx or a signal.
+func TestServeContext_InvalidConfig(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// A context that is never canceled: ServeContext must not block on it
+	ctx := context.Background()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e5s.ServeContext(ctx, "/nonexistent/config.yaml", handler, e5s.WithSignals())
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected error with invalid config, got nil")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeContext() did not return within timeout")
+	}
+}
+
 // TestClient_InvalidConfig verifies Client fails with invalid configuration.
 func TestClient_InvalidConfig(t *testing.T) {
 	tests := []struct {
@@ -277,3 +309,365 @@ func TestWithClient_CallbackError(t *testing.T) {
 		t.Error("expected error with invalid config, got nil")
 	}
 }
+
+// TestStartWithConfig_InvalidConfig verifies StartWithConfig applies the same
+// validation as the file-based entry points before touching SPIRE.
+func TestStartWithConfig_InvalidConfig(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		cfg    e5s.ServerConfig
+		errMsg string
+	}{
+		{
+			name:   "empty config",
+			cfg:    e5s.ServerConfig{},
+			errMsg: "workload_socket must be set",
+		},
+		{
+			name: "missing listen address",
+			cfg: e5s.ServerConfig{
+				SPIRE:  e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Server: e5s.ServerSection{AllowedClientTrustDomain: "example.org"},
+			},
+			errMsg: "listen_addr must be set",
+		},
+		{
+			name: "malformed entry in client ID list",
+			cfg: e5s.ServerConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Server: e5s.ServerSection{
+					ListenAddr:             ":8443",
+					AllowedClientSPIFFEIDs: []string{"spiffe://example.org/client", "example.org/ops"},
+				},
+			},
+			errMsg: "allowed_client_spiffe_ids[1]",
+		},
+		{
+			name: "invalid client ID pattern",
+			cfg: e5s.ServerConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Server: e5s.ServerSection{
+					ListenAddr:                    ":8443",
+					AllowedClientSPIFFEIDPatterns: []string{"spiffe://prod.corp/ns/{ns}/sa/{ns}"},
+				},
+			},
+			errMsg: "invalid server.allowed_client_spiffe_id_patterns[0]",
+		},
+		{
+			name: "unreachable authorization rule",
+			cfg: e5s.ServerConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Server: e5s.ServerSection{
+					ListenAddr:               ":8443",
+					AllowedClientTrustDomain: "example.org",
+					Authorization: e5s.AuthorizationSection{Rules: []e5s.AuthorizationRule{
+						{Path: "/", AllowedTrustDomains: []string{"example.org"}},
+						{Path: "/admin", AllowedSPIFFEIDs: []string{"spiffe://example.org/ops"}},
+					}},
+				},
+			},
+			errMsg: "server.authorization.rules[1] is unreachable",
+		},
+		{
+			name: "invalid authorization rule ID pattern",
+			cfg: e5s.ServerConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Server: e5s.ServerSection{
+					ListenAddr:               ":8443",
+					AllowedClientTrustDomain: "example.org",
+					Authorization: e5s.AuthorizationSection{Rules: []e5s.AuthorizationRule{
+						{Path: "/admin", AllowedSPIFFEIDPatterns: []string{"spiffe://example.org/ops/{"}},
+					}},
+				},
+			},
+			errMsg: "invalid server.authorization.rules[0].allowed_spiffe_id_patterns[0]",
+		},
+		{
+			name: "missing deny list file",
+			cfg: e5s.ServerConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Server: e5s.ServerSection{
+					ListenAddr:               ":8443",
+					AllowedClientTrustDomain: "example.org",
+					DenyListFile:             "/nonexistent/deny.yaml",
+				},
+			},
+			errMsg: "invalid server.deny_list_file",
+		},
+		{
+			name: "audit file in missing directory",
+			cfg: e5s.ServerConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Server: e5s.ServerSection{
+					ListenAddr:               ":8443",
+					AllowedClientTrustDomain: "example.org",
+					Audit:                    e5s.AuditSection{File: "/nonexistent/audit.jsonl"},
+				},
+			},
+			errMsg: "invalid server.audit.file",
+		},
+		{
+			name: "missing identity files",
+			cfg: e5s.ServerConfig{
+				Identity: e5s.IdentitySection{
+					Mode:       "files",
+					CertFile:   "/nonexistent/svid.pem",
+					KeyFile:    "/nonexistent/svid_key.pem",
+					BundleFile: "/nonexistent/svid_bundle.pem",
+				},
+				Server: e5s.ServerSection{
+					ListenAddr:               ":8443",
+					AllowedClientTrustDomain: "example.org",
+				},
+			},
+			errMsg: "failed to load identity files",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, err := e5s.StartWithConfig(context.Background(), tt.cfg, handler)
+			if err == nil {
+				_ = srv.Shutdown(context.Background())
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("StartWithConfig() error = %v, want it to contain %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+// TestStartWithConfig_InvalidDenyListPattern verifies that ID patterns of
+// a deny list file are parsed when the server starts, and errors name the
+// entry by its index in the file.
+func TestStartWithConfig_InvalidDenyListPattern(t *testing.T) {
+	t.Setenv(spire.DevIdentityEnv, "1")
+	path := filepath.Join(t.TempDir(), "deny.yaml")
+	data := "spiffe_id_patterns:\n  - \"\"\n  - \"spiffe://example.org/{ns\"\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := e5s.StartWithConfig(context.Background(), e5s.ServerConfig{
+		Identity: e5s.IdentitySection{Mode: "dev", SPIFFEID: "spiffe://example.org/api"},
+		Server: e5s.ServerSection{
+			ListenAddr:               "127.0.0.1:0",
+			AllowedClientTrustDomain: "example.org",
+			DenyListFile:             path,
+		},
+	}, http.NotFoundHandler())
+	if err == nil {
+		_ = srv.Shutdown(context.Background())
+		t.Fatal("expected error, got nil")
+	}
+	if want := "invalid spiffe_id_patterns[1]"; !strings.Contains(err.Error(), want) {
+		t.Errorf("StartWithConfig() error = %v, want it to contain %q", err, want)
+	}
+}
+
+// TestNewClient_InvalidConfig verifies NewClient applies the same validation
+// as the file-based entry points before touching SPIRE.
+func TestNewClient_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    e5s.ClientConfig
+		errMsg string
+	}{
+		{
+			name:   "empty config",
+			cfg:    e5s.ClientConfig{},
+			errMsg: "workload_socket must be set",
+		},
+		{
+			name: "missing server policy",
+			cfg: e5s.ClientConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+			},
+			errMsg: "must set at least one",
+		},
+		{
+			name: "invalid initial fetch timeout",
+			cfg: e5s.ClientConfig{
+				SPIRE: e5s.SPIRESection{
+					WorkloadSocket:      "unix:///tmp/agent.sock",
+					InitialFetchTimeout: "soon",
+				},
+				Client: e5s.ClientSection{ExpectedServerTrustDomain: "example.org"},
+			},
+			errMsg: "initial_fetch_timeout",
+		},
+		{
+			name: "invalid transport timeout",
+			cfg: e5s.ClientConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Client: e5s.ClientSection{
+					ExpectedServerTrustDomain: "example.org",
+					Transport:                 e5s.TransportSection{ResponseHeaderTimeout: "-5s"},
+				},
+			},
+			errMsg: "client.transport.response_header_timeout",
+		},
+		{
+			name: "destination without expected identity",
+			cfg: e5s.ClientConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Client: e5s.ClientSection{
+					Destinations: map[string]e5s.DestinationSection{"billing.internal:8443": {}},
+				},
+			},
+			errMsg: `client.destinations["billing.internal:8443"]`,
+		},
+		{
+			name: "server ID pattern with partial capture",
+			cfg: e5s.ClientConfig{
+				SPIRE:  e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Client: e5s.ClientSection{ExpectedServerSPIFFEIDPatterns: []string{"spiffe://example.org/ns/api-{name}"}},
+			},
+			errMsg: "invalid client.expected_server_spiffe_id_patterns[0]",
+		},
+		{
+			name: "invalid destination ID pattern",
+			cfg: e5s.ClientConfig{
+				SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+				Client: e5s.ClientSection{
+					Destinations: map[string]e5s.DestinationSection{
+						"ledger.internal": {ExpectedServerSPIFFEIDPatterns: []string{"spiffe://*.org/ledger"}},
+					},
+				},
+			},
+			errMsg: `invalid client.destinations["ledger.internal"].expected_server_spiffe_id_patterns[0]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, shutdown, err := e5s.NewClient(context.Background(), tt.cfg)
+			if err == nil {
+				_ = shutdown()
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("NewClient() error = %v, want it to contain %q", err, tt.errMsg)
+			}
+		})
+	}
+}
+
+// TestStartWithConfig_ListenerReplacesListenAddr verifies that WithListener
+// makes server.listen_addr optional.
+func TestStartWithConfig_ListenerReplacesListenAddr(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	cfg := e5s.ServerConfig{
+		SPIRE: e5s.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+	}
+
+	// The config is still invalid (no client policy), but listen_addr must
+	// no longer be what validation complains about.
+	_, err = e5s.StartWithConfig(context.Background(), cfg, http.NotFoundHandler(), e5s.WithListener(ln))
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if strings.Contains(err.Error(), "listen_addr") {
+		t.Errorf("StartWithConfig() with WithListener should not require listen_addr, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "must set at least one") {
+		t.Errorf("StartWithConfig() error = %v, want client policy error", err)
+	}
+}
+
+// TestNew_InvalidConfig verifies New and NewWithConfig reject bad configs
+// before connecting to SPIRE.
+func TestNew_InvalidConfig(t *testing.T) {
+	if _, err := e5s.New(context.Background(), "/nonexistent/config.yaml"); err == nil {
+		t.Error("New() with missing file: expected error, got nil")
+	}
+
+	_, err := e5s.NewWithConfig(context.Background(), e5s.Config{})
+	if err == nil {
+		t.Fatal("NewWithConfig() with empty config: expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "workload_socket must be set") {
+		t.Errorf("NewWithConfig() error = %q, want it to contain %q", err, "workload_socket must be set")
+	}
+}
+
+// TestServeMulti_InvalidConfig verifies ServeMulti rejects bad configs and
+// mismatched handler bindings without blocking.
+func TestServeMulti_InvalidConfig(t *testing.T) {
+	handlers := map[string]http.Handler{"admin": http.NotFoundHandler()}
+
+	err := e5s.ServeMulti(context.Background(), "/nonexistent/config.yaml", handlers, e5s.WithSignals())
+	if err == nil {
+		t.Error("ServeMulti() with missing file: expected error, got nil")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	err = e5s.ServeMulti(context.Background(), "/nonexistent/config.yaml", handlers, e5s.WithListener(ln))
+	if err == nil || !strings.Contains(err.Error(), "WithListener") {
+		t.Errorf("ServeMulti() with WithListener error = %v, want WithListener error", err)
+	}
+}
+
+// TestStartWithConfig_HTTP2Disabled verifies that a server whose hook turns
+// HTTP/2 off stops offering it during the handshake, so clients preferring
+// HTTP/2 fall back to HTTP/1.1.
+func TestStartWithConfig_HTTP2Disabled(t *testing.T) {
+	t.Setenv(spire.DevIdentityEnv, "1")
+	const id = "spiffe://example.org/api"
+
+	srv, err := e5s.StartWithConfig(context.Background(), e5s.ServerConfig{
+		Identity: e5s.IdentitySection{Mode: "dev", SPIFFEID: id},
+		Server: e5s.ServerSection{
+			ListenAddr:            "127.0.0.1:0",
+			AllowedClientSPIFFEID: id,
+		},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}), e5s.WithHTTPServer(func(s *http.Server) {
+		s.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}))
+	if err != nil {
+		t.Fatalf("StartWithConfig() error = %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	client, shutdown, err := e5s.NewClient(context.Background(), e5s.ClientConfig{
+		Identity: e5s.IdentitySection{Mode: "dev", SPIFFEID: id},
+		Client: e5s.ClientSection{
+			ExpectedServerSPIFFEID: id,
+			Transport:              e5s.TransportSection{ForceHTTP2: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer shutdown()
+
+	resp, err := client.Get("https://" + srv.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("client request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "HTTP/1.1" {
+		t.Errorf("request served over %q, want HTTP/1.1", body)
+	}
+}
@@ -1,6 +1,7 @@
 package e5s_test
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -21,21 +22,52 @@ func ExampleStart() {
 	})
 
 	// Start server with explicit config path
-	shutdown, err := e5s.Start("e5s.prod.yaml", handler)
+	srv, err := e5s.Start("e5s.prod.yaml", handler)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Server is now running in background
-	// Call shutdown() when you want to stop gracefully
+	// Server is now listening and serving in background
+	// Call Shutdown() when you want to stop gracefully
 	defer func() {
-		if err := shutdown(); err != nil {
+		if err := srv.Shutdown(context.Background()); err != nil {
 			log.Printf("Shutdown error: %v", err)
 		}
 	}()
 
 	// ... do other work ...
-	// Server continues running until shutdown() is called
+	// Server continues running until Shutdown() is called
+	log.Printf("Server is listening on %s", srv.Addr())
+}
+
+// ExampleStartWithConfig demonstrates starting an mTLS server from a
+// configuration built in code instead of read from a YAML file.
+func ExampleStartWithConfig() {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	cfg := e5s.ServerConfig{
+		SPIRE: e5s.SPIRESection{
+			WorkloadSocket:      "unix:///tmp/spire-agent/public/api.sock",
+			InitialFetchTimeout: "10s",
+		},
+		Server: e5s.ServerSection{
+			ListenAddr:               ":8443",
+			AllowedClientTrustDomain: "example.org",
+		},
+	}
+
+	srv, err := e5s.StartWithConfig(context.Background(), cfg, handler)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			log.Printf("Shutdown error: %v", err)
+		}
+	}()
+
 	log.Println("Server is running")
 }
 
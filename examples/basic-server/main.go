@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -99,20 +100,27 @@ func main() {
 	} else {
 		// Normal mode: use Start (spawns goroutine, returns immediately)
 		log.Println("Starting e5s mTLS server...")
-		shutdown, err := e5s.Start(*configPath, r)
+		srv, err := e5s.Start(*configPath, r)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		log.Println("Server running - press Ctrl+C to stop")
+		log.Printf("Server running on %s - press Ctrl+C to stop", srv.Addr())
 
-		// Wait for interrupt signal
+		// Wait for interrupt signal or server failure
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-		<-sigChan
+		select {
+		case <-sigChan:
+		case err := <-srv.Done():
+			log.Printf("Server stopped: %v", err)
+		}
 
 		log.Println("Shutting down gracefully...")
-		if err := shutdown(); err != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = srv.Shutdown(shutdownCtx)
+		cancel()
+		if err != nil {
 			log.Printf("Error during shutdown: %v", err)
 			os.Exit(1)
 		}
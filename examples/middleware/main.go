@@ -47,36 +47,6 @@ func authMiddleware(next http.Handler) http.Handler {
 
 // example-end:auth-middleware
 
-// trustDomainMiddleware is an example with explicit trust domain authorization.
-//
-// This shows how to enforce trust domain boundaries - useful when you accept
-// mTLS from multiple trust domains but want per-route policies.
-func trustDomainMiddleware(allowedTD spiffeid.TrustDomain) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			peer, ok := spiffehttp.PeerFromRequest(r)
-			if !ok {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-
-			// Check trust domain
-			if !peer.ID.MemberOf(allowedTD) {
-				http.Error(w, fmt.Sprintf("Forbidden: must be from trust domain %s", allowedTD.Name()),
-					http.StatusForbidden)
-				return
-			}
-
-			// Log successful authentication
-			log.Printf("Authenticated: %s from %s (cert expires: %s)",
-				peer.ID.Path(), peer.ID.TrustDomain().Name(), peer.ExpiresAt)
-
-			ctx := spiffehttp.WithPeer(r.Context(), peer)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-}
-
 // certExpiryWarningMiddleware logs warnings for certificates expiring soon.
 //
 // This is useful for debugging certificate rotation issues.
@@ -152,23 +122,40 @@ func main() {
 	protectedHandler := authMiddleware(http.HandlerFunc(helloHandler))
 	mux.Handle("/api/hello", protectedHandler)
 
-	// Protected endpoint with trust domain check
+	// Protected endpoint with trust domain check, using the shipped
+	// spiffehttp.Require middleware instead of a hand-rolled one
 	allowedTD, err := spiffeid.TrustDomainFromString("example.org")
 	if err != nil {
 		log.Fatalf("Invalid trust domain: %v", err)
 	}
-	restrictedHandler := trustDomainMiddleware(allowedTD)(http.HandlerFunc(helloHandler))
+	restrictedHandler := spiffehttp.Require(spiffehttp.Policy{
+		TrustDomains: []spiffeid.TrustDomain{allowedTD},
+	})(http.HandlerFunc(helloHandler))
 	mux.Handle("/api/restricted", restrictedHandler)
 
+	// Admin endpoint: one identity, write methods only, JSON problem details
+	adminID, err := spiffeid.FromString("spiffe://example.org/ops/admin")
+	if err != nil {
+		log.Fatalf("Invalid SPIFFE ID: %v", err)
+	}
+	adminHandler := spiffehttp.Require(spiffehttp.Policy{
+		IDs:         []spiffeid.ID{adminID},
+		Methods:     []string{http.MethodPost},
+		ErrorFormat: spiffehttp.ErrorFormatProblemJSON,
+	})(http.HandlerFunc(helloHandler))
+	mux.Handle("/api/admin", adminHandler)
+
 	// Chain multiple middleware
 	monitoredHandler := certExpiryWarningMiddleware(5 * time.Minute)(protectedHandler)
 	mux.Handle("/api/monitored", monitoredHandler)
 
-	// Start HTTPS server
+	// Start HTTPS server. spiffehttp.Middleware attaches the peer to every
+	// request; ConnContext lets it parse the certificate once per connection.
 	server := &http.Server{
 		Addr:              ":8443",
-		Handler:           mux,
+		Handler:           spiffehttp.Middleware(mux),
 		TLSConfig:         tlsConfig,
+		ConnContext:       spiffehttp.ConnContext,
 		ReadHeaderTimeout: 10 * time.Second, // Prevent Slowloris attacks
 	}
 
@@ -178,6 +165,7 @@ func main() {
 		log.Println("  GET /health          - Public health check")
 		log.Println("  GET /api/hello       - Basic auth (any peer)")
 		log.Println("  GET /api/restricted  - Trust domain auth (example.org only)")
+		log.Println("  POST /api/admin      - Single identity, POST only")
 		log.Println("  GET /api/monitored   - With cert expiry warnings")
 
 		if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
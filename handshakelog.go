@@ -0,0 +1,62 @@
+package e5s
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// rejectionLogInterval is how often a rejected client handshake of each cause
+// is logged outside debug mode.
+const rejectionLogInterval = 10 * time.Second
+
+// rejectionLog logs rejected client handshakes with their cause and the
+// client's SPIFFE ID. Any peer that can reach the port can trigger them, so
+// outside debug mode each cause is logged at most once per
+// rejectionLogInterval and the next line says how many were left out.
+type rejectionLog struct {
+	mu     sync.Mutex
+	causes map[spiffehttp.HandshakeFailure]*rejectionCause
+}
+
+// rejectionCause is the log state of one HandshakeFailure.
+type rejectionCause struct {
+	logged     time.Time
+	suppressed int
+}
+
+// log logs info, a rejected handshake, unless its cause was logged less than
+// rejectionLogInterval before now.
+func (l *rejectionLog) log(info spiffehttp.HandshakeInfo, now time.Time) {
+	if debugEnabled {
+		debugf("rejected client handshake from %s: %v", addrString(info.RemoteAddr), info.Err)
+		return
+	}
+
+	l.mu.Lock()
+	if l.causes == nil {
+		l.causes = make(map[spiffehttp.HandshakeFailure]*rejectionCause)
+	}
+	cause, ok := l.causes[info.Failure]
+	if !ok {
+		cause = &rejectionCause{}
+		l.causes[info.Failure] = cause
+	}
+	if ok && now.Sub(cause.logged) < rejectionLogInterval {
+		cause.suppressed++
+		l.mu.Unlock()
+		return
+	}
+	suppressed := cause.suppressed
+	cause.logged, cause.suppressed = now, 0
+	l.mu.Unlock()
+
+	if suppressed > 0 {
+		log.Printf("e5s: rejected client handshake from %s: %v (%d more %s rejections not logged)",
+			addrString(info.RemoteAddr), info.Err, suppressed, info.Failure)
+		return
+	}
+	log.Printf("e5s: rejected client handshake from %s: %v", addrString(info.RemoteAddr), info.Err)
+}
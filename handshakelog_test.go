@@ -0,0 +1,59 @@
+package e5s
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+func TestRejectionLog(t *testing.T) {
+	if debugEnabled {
+		t.Skip("E5S_DEBUG logs every rejection")
+	}
+	logs := captureLog(t)
+	var l rejectionLog
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 3, 17), Port: 51344}
+	unauthorized := spiffehttp.HandshakeInfo{
+		RemoteAddr: addr,
+		Failure:    spiffehttp.FailureUnauthorized,
+		Err:        errors.New(`client SPIFFE ID is not authorized (spiffe://example.org/batch)`),
+	}
+	noCert := spiffehttp.HandshakeInfo{
+		RemoteAddr: addr,
+		Failure:    spiffehttp.FailureNoCertificate,
+		Err:        errors.New("client did not provide a certificate"),
+	}
+	now := time.Now()
+
+	l.log(unauthorized, now)
+	want := "e5s: rejected client handshake from 10.0.3.17:51344: client SPIFFE ID is not authorized (spiffe://example.org/batch)\n"
+	if got := logs.String(); got != want {
+		t.Fatalf("first rejection logged %q, want %q", got, want)
+	}
+
+	// Within the interval: left out, but other causes are still logged
+	logs.Reset()
+	l.log(unauthorized, now.Add(time.Second))
+	l.log(unauthorized, now.Add(2*time.Second))
+	l.log(noCert, now.Add(3*time.Second))
+	if got := logs.String(); strings.Contains(got, "not authorized") || !strings.Contains(got, "did not provide a certificate") {
+		t.Fatalf("logged %q, want only the other cause", got)
+	}
+
+	// After the interval: logged with the number left out
+	logs.Reset()
+	l.log(unauthorized, now.Add(rejectionLogInterval))
+	if got := logs.String(); !strings.Contains(got, "not authorized") || !strings.Contains(got, "(2 more unauthorized_id rejections not logged)") {
+		t.Errorf("logged %q, want the rejection and the count left out", got)
+	}
+
+	logs.Reset()
+	l.log(unauthorized, now.Add(3*rejectionLogInterval))
+	if got := logs.String(); strings.Contains(got, "more") {
+		t.Errorf("logged %q, want no count after nothing was left out", got)
+	}
+}
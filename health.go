@@ -0,0 +1,137 @@
+package e5s
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// identitySource is what a Server needs from its SPIRE source: its own SVID
+// and the trust bundles used to verify peers.
+type identitySource interface {
+	x509svid.Source
+	x509bundle.Source
+}
+
+// Health endpoint paths served on server.health_listen_addr.
+const (
+	livenessPath  = "/livez"
+	readinessPath = "/readyz"
+)
+
+// Ready reports whether the server can take new traffic.
+//
+// It returns nil when all of the following hold, and an error naming the
+// first one that does not:
+//   - The listener is bound
+//   - The server is not draining (Shutdown has not been called)
+//   - The SPIRE source is connected and returns an SVID
+//   - The current SVID has not expired
+//   - A trust bundle is present for the server's trust domain
+//
+// This is the check behind /readyz on server.health_listen_addr. Call it
+// directly to fold e5s state into a readiness probe of your own.
+func (s *Server) Ready() error {
+	if s.listener == nil {
+		return errors.New("listener not bound")
+	}
+	if s.draining.Load() {
+		return errors.New("server is draining")
+	}
+
+	svid, err := s.source.GetX509SVID()
+	if err != nil {
+		return fmt.Errorf("SPIRE source unavailable: %w", err)
+	}
+	if len(svid.Certificates) == 0 {
+		return errors.New("SVID has no certificates")
+	}
+	if expiry := svid.Certificates[0].NotAfter; !time.Now().Before(expiry) {
+		return fmt.Errorf("SVID expired at %s", expiry.Format(time.RFC3339))
+	}
+
+	bundle, err := s.source.GetX509BundleForTrustDomain(svid.ID.TrustDomain())
+	if err != nil {
+		return fmt.Errorf("trust bundle unavailable: %w", err)
+	}
+	if len(bundle.X509Authorities()) == 0 {
+		return fmt.Errorf("trust bundle for %q is empty", svid.ID.TrustDomain().Name())
+	}
+
+	return nil
+}
+
+// HealthAddr returns the address the plain-HTTP health endpoints listen on,
+// or nil if server.health_listen_addr is not set.
+func (s *Server) HealthAddr() net.Addr {
+	if s.healthListener == nil {
+		return nil
+	}
+	return s.healthListener.Addr()
+}
+
+// healthHandler serves /livez and /readyz.
+//
+// /livez answers 200 while the process can serve HTTP at all. /readyz answers
+// 200 when Ready() returns nil and 503 with the reason otherwise. Neither
+// endpoint requires a client certificate, so kubelet probes can reach them.
+func (s *Server) healthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(livenessPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc(readinessPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := s.Ready(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintf(w, "not ready: %v\n", err)
+			return
+		}
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	return mux
+}
+
+// listenHealth binds server.health_listen_addr, if set, and serves the health
+// endpoints in the background.
+func (s *Server) listenHealth() error {
+	if s.healthAddr == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", s.healthAddr)
+	if err != nil {
+		return fmt.Errorf("health listener: %w", err)
+	}
+	s.healthListener = ln
+	s.healthServer = &http.Server{
+		Handler:           s.healthHandler(),
+		ReadHeaderTimeout: defaultReadHeaderTimeout,
+	}
+	if debugEnabled {
+		s.healthServer.ErrorLog = log.New(os.Stderr, "e5s/health: ", log.LstdFlags|log.Lshortfile)
+	}
+
+	debugf("health endpoints bound addr=%q", ln.Addr().String())
+
+	go func() {
+		_ = s.healthServer.Serve(ln)
+	}()
+	return nil
+}
+
+// closeHealth stops the health endpoints, if they are running.
+func (s *Server) closeHealth() error {
+	if s.healthServer == nil {
+		return nil
+	}
+	return s.healthServer.Close()
+}
@@ -0,0 +1,178 @@
+package e5s
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// fakeSource is an identitySource returning fixed values.
+type fakeSource struct {
+	svid      *x509svid.SVID
+	svidErr   error
+	bundle    *x509bundle.Bundle
+	bundleErr error
+}
+
+func (s *fakeSource) GetX509SVID() (*x509svid.SVID, error) {
+	return s.svid, s.svidErr
+}
+
+func (s *fakeSource) GetX509BundleForTrustDomain(spiffeid.TrustDomain) (*x509bundle.Bundle, error) {
+	return s.bundle, s.bundleErr
+}
+
+func TestServerReady(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	id := "spiffe://example.org/server"
+	valid := ca.svid(t, id, time.Now().Add(time.Hour))
+	ln := fakeListener{}
+
+	tests := []struct {
+		name     string
+		listener net.Listener
+		draining bool
+		source   *fakeSource
+		wantErr  string
+	}{
+		{
+			name:     "ready",
+			listener: ln,
+			source:   &fakeSource{svid: valid, bundle: ca.bundle()},
+		},
+		{
+			name:    "listener not bound",
+			source:  &fakeSource{svid: valid, bundle: ca.bundle()},
+			wantErr: "listener not bound",
+		},
+		{
+			name:     "draining",
+			listener: ln,
+			draining: true,
+			source:   &fakeSource{svid: valid, bundle: ca.bundle()},
+			wantErr:  "draining",
+		},
+		{
+			name:     "source unavailable",
+			listener: ln,
+			source:   &fakeSource{svidErr: errors.New("no connection to agent")},
+			wantErr:  "SPIRE source unavailable: no connection to agent",
+		},
+		{
+			name:     "SVID without certificates",
+			listener: ln,
+			source:   &fakeSource{svid: &x509svid.SVID{ID: valid.ID}, bundle: ca.bundle()},
+			wantErr:  "SVID has no certificates",
+		},
+		{
+			name:     "SVID expired",
+			listener: ln,
+			source:   &fakeSource{svid: ca.svid(t, id, time.Now().Add(-time.Minute)), bundle: ca.bundle()},
+			wantErr:  "SVID expired",
+		},
+		{
+			name:     "bundle unavailable",
+			listener: ln,
+			source:   &fakeSource{svid: valid, bundleErr: errors.New("no bundle")},
+			wantErr:  "trust bundle unavailable",
+		},
+		{
+			name:     "bundle empty",
+			listener: ln,
+			source:   &fakeSource{svid: valid, bundle: x509bundle.New(ca.td)},
+			wantErr:  `trust bundle for "example.org" is empty`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{listener: tt.listener, source: tt.source}
+			s.draining.Store(tt.draining)
+
+			err := s.Ready()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Ready() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Ready() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerHealthHandler(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	source := &fakeSource{svid: ca.svid(t, "spiffe://example.org/server", time.Now().Add(time.Hour)), bundle: ca.bundle()}
+	s := &Server{listener: fakeListener{}, source: source}
+	handler := s.healthHandler()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, string(body)
+	}
+
+	if code, body := get(livenessPath); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("GET %s = %d %q, want 200 \"ok\\n\"", livenessPath, code, body)
+	}
+	if code, body := get(readinessPath); code != http.StatusOK || body != "ok\n" {
+		t.Errorf("GET %s = %d %q, want 200 \"ok\\n\"", readinessPath, code, body)
+	}
+	if code, _ := get("/other"); code != http.StatusNotFound {
+		t.Errorf("GET /other = %d, want 404", code)
+	}
+
+	// Not ready: /readyz reports why, /livez is unaffected
+	s.draining.Store(true)
+	if code, body := get(readinessPath); code != http.StatusServiceUnavailable || body != "not ready: server is draining\n" {
+		t.Errorf("GET %s while draining = %d %q, want 503 with the reason", readinessPath, code, body)
+	}
+	if code, _ := get(livenessPath); code != http.StatusOK {
+		t.Errorf("GET %s while draining = %d, want 200", livenessPath, code)
+	}
+}
+
+func TestServerListenHealth(t *testing.T) {
+	s := &Server{}
+	if err := s.listenHealth(); err != nil {
+		t.Fatalf("listenHealth() without an address = %v", err)
+	}
+	if s.HealthAddr() != nil {
+		t.Errorf("HealthAddr() = %v, want nil without server.health_listen_addr", s.HealthAddr())
+	}
+	if err := s.closeHealth(); err != nil {
+		t.Errorf("closeHealth() = %v, want nil", err)
+	}
+
+	s = &Server{healthAddr: "127.0.0.1:0", listener: fakeListener{}, source: &fakeSource{svidErr: errors.New("no SVID")}}
+	if err := s.listenHealth(); err != nil {
+		t.Fatalf("listenHealth() error = %v", err)
+	}
+	defer s.closeHealth()
+
+	resp, err := http.Get("http://" + s.HealthAddr().String() + readinessPath)
+	if err != nil {
+		t.Fatalf("GET %s: %v", readinessPath, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("GET %s = %d, want 503", readinessPath, resp.StatusCode)
+	}
+}
+
+// fakeListener is a bound listener for Ready; it accepts nothing.
+type fakeListener struct{ net.Listener }
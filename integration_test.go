@@ -4,14 +4,22 @@
 package e5s_test
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/sufield/e5s"
 	"github.com/sufield/e5s/internal/testhelpers"
 	"github.com/sufield/e5s/spiffehttp"
@@ -92,19 +100,16 @@ client:
 
 	// Start server with integration config
 	t.Logf("Starting server with config: %s", cfgPath)
-	shutdown, err := e5s.Start(cfgPath, handler)
+	srv, err := e5s.Start(cfgPath, handler)
 	if err != nil {
 		t.Fatalf("failed to start e5s server: %v", err)
 	}
 	defer func() {
-		if err := shutdown(); err != nil {
+		if err := srv.Shutdown(context.Background()); err != nil {
 			t.Errorf("shutdown failed: %v", err)
 		}
 	}()
 
-	// Give the server time to bind to port
-	time.Sleep(500 * time.Millisecond)
-
 	// Create client with same config
 	t.Logf("Creating client with config: %s", cfgPath)
 	client, cleanup, err := e5s.Client(cfgPath)
@@ -149,6 +154,752 @@ client:
 	if seenPeerInfo.ExpiresAt.Before(time.Now()) {
 		t.Error("peer certificate already expired")
 	}
+	if seenPeerInfo.SerialNumber == nil || len(seenPeerInfo.Chain) == 0 || seenPeerInfo.NotBefore.After(time.Now()) {
+		t.Errorf("peer info missing certificate details: serial=%v chain=%d not_before=%s",
+			seenPeerInfo.SerialNumber, len(seenPeerInfo.Chain), seenPeerInfo.NotBefore)
+	}
+	if seenPeerInfo.TLSVersion != tls.VersionTLS13 || seenPeerInfo.CipherSuite == 0 || seenPeerInfo.RemoteAddr == "" {
+		t.Errorf("peer info missing connection details: version=%x cipher=%x remote=%q",
+			seenPeerInfo.TLSVersion, seenPeerInfo.CipherSuite, seenPeerInfo.RemoteAddr)
+	}
 	t.Logf("✓ Verified peer info: trust domain=%s, expires=%s",
 		seenPeerInfo.ID.TrustDomain().Name(), seenPeerInfo.ExpiresAt)
 }
+
+// TestE2E_Runtime_SharedSource verifies that a server and a client handed out
+// by one Runtime talk to each other over the runtime's single SPIRE source,
+// and that Close tears both down.
+func TestE2E_Runtime_SharedSource(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-runtime.yaml")
+
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "localhost:0"
+  allowed_client_trust_domain: "example.org"
+
+client:
+  expected_server_trust_domain: "example.org"
+`, socketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := e5s.PeerID(r)
+		fmt.Fprintf(w, "hello %s", id)
+	})
+
+	srv, err := rt.Server("", handler)
+	if err != nil {
+		t.Fatalf("failed to start runtime server: %v", err)
+	}
+	client, err := rt.Client()
+	if err != nil {
+		t.Fatalf("failed to create runtime client: %v", err)
+	}
+
+	url := fmt.Sprintf("https://%s/", srv.Addr())
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("client request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+
+	if err := rt.Close(); err != nil {
+		t.Fatalf("runtime close failed: %v", err)
+	}
+
+	select {
+	case err := <-srv.Done():
+		if err != nil {
+			t.Errorf("server exited with error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server still running after runtime Close")
+	}
+	if _, err := rt.Client(); err == nil {
+		t.Error("expected error from Client after Close, got nil")
+	}
+	t.Log("✓ Runtime server and client shared one SPIRE source")
+}
+
+// TestE2E_Runtime_NamedServers verifies that named servers from one config
+// enforce their own client policies while sharing one SPIRE source.
+func TestE2E_Runtime_NamedServers(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-multi.yaml")
+
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+servers:
+  - name: api
+    listen_addr: "localhost:0"
+    allowed_client_trust_domain: "example.org"
+  - name: admin
+    listen_addr: "localhost:0"
+    allowed_client_spiffe_id: "spiffe://example.org/ops/admin"
+
+client:
+  expected_server_trust_domain: "example.org"
+`, socketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	api, err := rt.Server("api", ok)
+	if err != nil {
+		t.Fatalf("failed to start api server: %v", err)
+	}
+	admin, err := rt.Server("admin", ok)
+	if err != nil {
+		t.Fatalf("failed to start admin server: %v", err)
+	}
+	if _, err := rt.Server("metrics", ok); err == nil {
+		t.Error("expected error for unknown server name, got nil")
+	}
+
+	client, err := rt.Client()
+	if err != nil {
+		t.Fatalf("failed to create runtime client: %v", err)
+	}
+
+	resp, err := client.Get(fmt.Sprintf("https://%s/", api.Addr()))
+	if err != nil {
+		t.Fatalf("api request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// The test workload is not spiffe://example.org/ops/admin
+	if resp, err := client.Get(fmt.Sprintf("https://%s/", admin.Addr())); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected admin server to reject the test workload")
+	}
+	t.Log("✓ Named servers enforced independent policies")
+}
+
+// TestE2E_Authorizers verifies that custom authorizers narrow the config
+// policy with RequireBoth and widen it with RequireEither.
+func TestE2E_Authorizers(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-authorizer.yaml")
+
+	// The test workload is not spiffe://example.org/nobody, so the static
+	// policy alone rejects it.
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "localhost:0"
+  allowed_client_spiffe_id: "spiffe://example.org/nobody"
+
+client:
+  expected_server_trust_domain: "example.org"
+`, socketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	var calls atomic.Int32
+	acceptAll := func(id spiffeid.ID, _ [][]*x509.Certificate) error {
+		calls.Add(1)
+		return nil
+	}
+	rejectAll := func(id spiffeid.ID, _ [][]*x509.Certificate) error {
+		return fmt.Errorf("%s rejected by test authorizer", id)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	either, err := rt.Server("", ok, e5s.WithClientAuthorizer(acceptAll, spiffehttp.RequireEither))
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	both, err := rt.Server("", ok, e5s.WithClientAuthorizer(acceptAll, spiffehttp.RequireBoth))
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	client, err := rt.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	resp, err := client.Get(fmt.Sprintf("https://%s/", either.Addr()))
+	if err != nil {
+		t.Fatalf("RequireEither: expected authorizer to admit the client: %v", err)
+	}
+	resp.Body.Close()
+	if calls.Load() == 0 {
+		t.Error("RequireEither: custom authorizer was not called")
+	}
+
+	if resp, err := client.Get(fmt.Sprintf("https://%s/", both.Addr())); err == nil {
+		resp.Body.Close()
+		t.Fatal("RequireBoth: expected the config policy to still reject the client")
+	}
+
+	strict, err := rt.Client(e5s.WithServerAuthorizer(rejectAll, spiffehttp.RequireBoth))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if resp, err := strict.Get(fmt.Sprintf("https://%s/", either.Addr())); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected client authorizer to reject the server")
+	}
+	t.Log("✓ Custom authorizers composed with the config policy")
+}
+
+// TestE2E_Destinations verifies that client.destinations selects the
+// expected server identity by host, that unlisted hosts fail closed, and that
+// WithExpectedServer overrides the configured policy per request.
+func TestE2E_Destinations(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-destinations.yaml")
+
+	// Only 127.0.0.1 is listed and there is no default policy, so requests
+	// to "localhost" have no expected server identity.
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "127.0.0.1:0"
+  allowed_client_trust_domain: "example.org"
+
+client:
+  destinations:
+    "127.0.0.1":
+      expected_server_trust_domain: "example.org"
+`, socketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	srv, err := rt.Server("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	serverID, err := srv.Identity()
+	if err != nil {
+		t.Fatalf("failed to get server identity: %v", err)
+	}
+	client, err := rt.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(srv.Addr().String())
+
+	get := func(ctx context.Context, host string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+net.JoinHostPort(host, port)+"/", nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	ctx := context.Background()
+	if err := get(ctx, "127.0.0.1"); err != nil {
+		t.Fatalf("listed destination: %v", err)
+	}
+	if err := get(ctx, "localhost"); err == nil || !strings.Contains(err.Error(), "no expected server identity") {
+		t.Fatalf("unlisted destination: expected fail-closed error, got %v", err)
+	}
+
+	if err := get(e5s.WithExpectedServer(ctx, serverID), "localhost"); err != nil {
+		t.Fatalf("override with the server's ID: %v", err)
+	}
+	wrong := spiffeid.RequireFromString("spiffe://example.org/not-the-server")
+	if err := get(e5s.WithExpectedServer(ctx, wrong), "127.0.0.1"); err == nil {
+		t.Fatal("override with another ID: expected the server to be rejected")
+	}
+	t.Log("✓ Expected server identity selected per destination and per request")
+}
+
+// TestE2E_DenyList verifies that adding the client's SPIFFE ID to the
+// server's deny list file cuts the client off without a restart.
+func TestE2E_DenyList(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-deny.yaml")
+	denyPath := filepath.Join(tempDir, "deny.yaml")
+
+	if err := os.WriteFile(denyPath, nil, 0600); err != nil {
+		t.Fatalf("failed to create deny list: %v", err)
+	}
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "127.0.0.1:0"
+  allowed_client_trust_domain: "example.org"
+  deny_list_file: "%s"
+
+client:
+  expected_server_trust_domain: "example.org"
+`, socketPath, denyPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	srv, err := rt.Server("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	client, err := rt.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	url := fmt.Sprintf("https://%s/", srv.Addr())
+
+	// denied reports whether the server refused the request, either with a
+	// 403 on the pooled connection or by failing a new handshake
+	denied := func() bool {
+		resp, err := client.Get(url)
+		if err != nil {
+			return true
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode == http.StatusForbidden
+	}
+	if denied() {
+		t.Fatal("client denied before it was added to the deny list")
+	}
+
+	// The test workload is both client and server
+	id, err := srv.Identity()
+	if err != nil {
+		t.Fatalf("failed to get identity: %v", err)
+	}
+	if err := os.WriteFile(denyPath, []byte(fmt.Sprintf("spiffe_ids: [%q]\n", id)), 0600); err != nil {
+		t.Fatalf("failed to update deny list: %v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !denied() {
+		if time.Now().After(deadline) {
+			t.Fatal("client still allowed 10s after being added to the deny list")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	t.Log("✓ Deny list reloaded and enforced without a restart")
+}
+
+// TestE2E_AuditLog verifies that handshakes and per-route decisions are
+// written to the audit log file.
+func TestE2E_AuditLog(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-audit.yaml")
+	auditPath := filepath.Join(tempDir, "audit.jsonl")
+
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "127.0.0.1:0"
+  allowed_client_trust_domain: "example.org"
+  audit:
+    file: "%s"
+  authorization:
+    rules:
+      - path: /admin
+        allowed_spiffe_ids: ["spiffe://example.org/nobody"]
+      - path: /api
+        allowed_trust_domains: ["example.org"]
+
+client:
+  expected_server_trust_domain: "example.org"
+`, socketPath, auditPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	srv, err := rt.Server("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	client, err := rt.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	for path, want := range map[string]int{"/api/users": http.StatusOK, "/admin": http.StatusForbidden} {
+		resp, err := client.Get(fmt.Sprintf("https://%s%s", srv.Addr(), path))
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("GET %s: status %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+
+	data, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	log := string(data)
+	for _, want := range []string{
+		`"stage":"handshake","decision":"allow"`,
+		`"stage":"request","decision":"allow"`,
+		`"path":"/admin","status":403,"rule":"rules[0]"`,
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("audit log does not contain %s:\n%s", want, log)
+		}
+	}
+	t.Log("✓ Handshake and route decisions written to the audit log")
+}
+
+// TestE2E_HandshakeFailures verifies that rejected handshakes are classified,
+// counted and passed to the failure handler.
+func TestE2E_HandshakeFailures(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-handshakes.yaml")
+
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "127.0.0.1:0"
+  allowed_client_trust_domain: "example.org"
+`, socketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	failures := make(chan spiffehttp.HandshakeInfo, 2)
+	srv, err := rt.Server("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		e5s.WithHandshakeFailureHandler(func(info spiffehttp.HandshakeInfo) { failures <- info }))
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+
+	// A client without a certificate, then one limited to TLS 1.2
+	for _, cfg := range []*tls.Config{
+		{InsecureSkipVerify: true, MinVersion: tls.VersionTLS13}, // #nosec G402 - Test only connects to be rejected
+		{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}, // #nosec G402 - Test only connects to be rejected
+	} {
+		conn, err := tls.Dial("tcp", srv.Addr().String(), cfg)
+		if err == nil {
+			// TLS 1.3 clients learn about the rejection on first read
+			_, err = conn.Read(make([]byte, 1))
+			conn.Close()
+		}
+		if err == nil {
+			t.Fatal("handshake succeeded, want it rejected")
+		}
+	}
+
+	for _, want := range []spiffehttp.HandshakeFailure{spiffehttp.FailureNoCertificate, spiffehttp.FailureProtocolVersion} {
+		select {
+		case info := <-failures:
+			if info.Failure != want {
+				t.Errorf("failure = %q, want %q (%v)", info.Failure, want, info.Err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s failure reported", want)
+		}
+	}
+
+	counts := srv.Handshakes()
+	if counts.Failures[spiffehttp.FailureNoCertificate] != 1 || counts.Failures[spiffehttp.FailureProtocolVersion] != 1 {
+		t.Errorf("Handshakes().Failures = %v, want one of each", counts.Failures)
+	}
+	t.Log("✓ Handshake failures classified and counted")
+}
+
+// TestE2E_ServerPeer verifies that clients learn which server answered.
+func TestE2E_ServerPeer(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-server-peer.yaml")
+
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "127.0.0.1:0"
+  allowed_client_trust_domain: "example.org"
+
+client:
+  expected_server_trust_domain: "example.org"
+`, socketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	srv, err := rt.Server("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	id, err := srv.Identity()
+	if err != nil {
+		t.Fatalf("failed to get identity: %v", err)
+	}
+
+	for _, attach := range []bool{false, true} {
+		client, err := rt.Client(e5s.WithServerPeerInContext(attach))
+		if err != nil {
+			t.Fatalf("failed to create client: %v", err)
+		}
+		resp, err := client.Get(fmt.Sprintf("https://%s/", srv.Addr()))
+		if err != nil {
+			t.Fatalf("client request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		server, ok := e5s.ServerPeer(resp)
+		if !ok {
+			t.Fatalf("ServerPeer() found no peer (attach=%v)", attach)
+		}
+		if server.ID != id {
+			t.Errorf("ServerPeer().ID = %s, want %s", server.ID, id)
+		}
+		wantAddr := ""
+		if attach {
+			wantAddr = srv.Addr().String()
+		}
+		if server.RemoteAddr != wantAddr {
+			t.Errorf("ServerPeer().RemoteAddr = %q, want %q (attach=%v)", server.RemoteAddr, wantAddr, attach)
+		}
+	}
+	t.Log("✓ Server identity available from client responses")
+}
+
+// TestE2E_MaxConnectionAge verifies that idle connections older than
+// server.max_connection_age are closed, so the next request handshakes again.
+func TestE2E_MaxConnectionAge(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-max-age.yaml")
+
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "127.0.0.1:0"
+  allowed_client_trust_domain: "example.org"
+  max_connection_age: "1s"
+
+client:
+  expected_server_trust_domain: "example.org"
+`, socketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	srv, err := rt.Server("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	client, err := rt.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// reused sends a request and reports whether it used a pooled connection
+	reused := func() bool {
+		var reused bool
+		ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { reused = info.Reused },
+		})
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://%s/", srv.Addr()), nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("client request failed: %v", err)
+		}
+		resp.Body.Close()
+		return reused
+	}
+
+	reused()
+	if !reused() {
+		t.Fatal("second request did not reuse the connection")
+	}
+
+	// The server checks connections every few seconds
+	time.Sleep(7 * time.Second)
+	if reused() {
+		t.Error("connection older than max_connection_age was reused")
+	}
+	t.Log("✓ Connections older than max_connection_age are closed")
+}
+
+// TestE2E_Connections verifies that servers list live connections by client
+// identity and can disconnect them.
+func TestE2E_Connections(t *testing.T) {
+	socketPath := getOrSetupSPIRE(t)
+
+	tempDir := t.TempDir()
+	cfgPath := filepath.Join(tempDir, "e5s-connections.yaml")
+
+	configContent := fmt.Sprintf(`spire:
+  workload_socket: "%s"
+  initial_fetch_timeout: "30s"
+
+server:
+  listen_addr: "127.0.0.1:0"
+  allowed_client_trust_domain: "example.org"
+
+client:
+  expected_server_trust_domain: "example.org"
+`, socketPath)
+
+	if err := os.WriteFile(cfgPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("failed to create test config: %v", err)
+	}
+
+	rt, err := e5s.New(context.Background(), cfgPath)
+	if err != nil {
+		t.Fatalf("failed to create runtime: %v", err)
+	}
+	defer rt.Close()
+
+	srv, err := rt.Server("", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	if err != nil {
+		t.Fatalf("failed to start server: %v", err)
+	}
+	client, err := rt.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	// Server and client share the runtime's SVID
+	id, err := srv.Identity()
+	if err != nil {
+		t.Fatalf("failed to get identity: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(fmt.Sprintf("https://%s/", srv.Addr()))
+		if err != nil {
+			t.Fatalf("client request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	conns := srv.Connections()[id]
+	if len(conns) != 1 {
+		t.Fatalf("Connections()[%s] has %d connections, want 1", id, len(conns))
+	}
+	if conns[0].Requests != 3 {
+		t.Errorf("Requests = %d, want 3", conns[0].Requests)
+	}
+	if conns[0].RemoteAddr == "" || conns[0].ExpiresAt.IsZero() {
+		t.Errorf("connection details missing: %+v", conns[0])
+	}
+
+	if _, err := srv.Disconnect("not-a-spiffe-id"); err == nil {
+		t.Error("Disconnect() accepted an invalid pattern")
+	}
+	n, err := srv.Disconnect(id.String())
+	if err != nil {
+		t.Fatalf("Disconnect() failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Disconnect() closed %d connections, want 1", n)
+	}
+	if len(srv.Connections()) != 0 {
+		t.Errorf("Connections() = %v after Disconnect, want none", srv.Connections())
+	}
+	t.Log("✓ Live connections are listed and disconnected by identity")
+}
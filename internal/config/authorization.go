@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// Rule is a parsed authorization rule. Package e5s converts it to a
+// spiffehttp.Rule, parsing its ID patterns.
+type Rule struct {
+	// PathPrefix selects requests whose path is the prefix or lies below it,
+	// comparing whole segments
+	PathPrefix string
+	// Methods selects requests with these methods (upper case); empty means any
+	Methods []string
+	// IDs, TrustDomains and IDPatterns are the clients the rule allows
+	IDs          []spiffeid.ID
+	TrustDomains []spiffeid.TrustDomain
+	IDPatterns   []IDPattern
+}
+
+// ParseAuthorization validates and parses the authorization rules of a server
+// section, reporting errors under prefix ("server" or "servers[<name>]").
+//
+// Besides the format of each rule, it rejects rules that can never decide a
+// request: a rule is unreachable if an earlier rule selects every request it
+// does, and overlapping if an earlier rule covering its path takes some but
+// not all of its methods.
+func ParseAuthorization(authz AuthorizationSection, prefix string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(authz.Rules))
+	for i, raw := range authz.Rules {
+		field := fmt.Sprintf("%s.authorization.rules[%d]", prefix, i)
+		rule, err := parseRule(raw, field)
+		if err != nil {
+			return nil, err
+		}
+		for j, earlier := range rules {
+			if err := checkShadowing(earlier, rule, j); err != nil {
+				return nil, fmt.Errorf("%s %w", field, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parseRule validates and parses one authorization rule.
+func parseRule(raw AuthorizationRule, field string) (Rule, error) {
+	p := strings.TrimSpace(raw.Path)
+	if !strings.HasPrefix(p, "/") {
+		return Rule{}, fmt.Errorf("%s.path must start with \"/\", got %q", field, raw.Path)
+	}
+	if clean := cleanRulePath(p); clean != p {
+		return Rule{}, fmt.Errorf("%s.path %q must be a clean path (use %q)", field, p, clean)
+	}
+	rule := Rule{PathPrefix: p}
+
+	for i, m := range raw.Methods {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m == "" || strings.ContainsAny(m, " \t/") {
+			return Rule{}, fmt.Errorf("invalid %s.methods[%d] %q", field, i, raw.Methods[i])
+		}
+		if !slices.Contains(rule.Methods, m) {
+			rule.Methods = append(rule.Methods, m)
+		}
+	}
+
+	allowed, err := validateAuthz(authzSection{
+		ids:      raw.AllowedSPIFFEIDs,
+		tds:      raw.AllowedTrustDomains,
+		patterns: raw.AllowedSPIFFEIDPatterns,
+	}, field+".allowed")
+	if err != nil {
+		return Rule{}, err
+	}
+	rule.IDs, rule.TrustDomains, rule.IDPatterns = allowed.ids, allowed.tds, allowed.patterns
+	return rule, nil
+}
+
+// cleanRulePath resolves "." and ".." segments and repeated slashes, keeping
+// a trailing slash.
+func cleanRulePath(p string) string {
+	clean := path.Clean(p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+// checkShadowing returns an error if earlier, at index i, decides requests
+// that later also selects.
+func checkShadowing(earlier, later Rule, i int) error {
+	if !pathCovers(earlier.PathPrefix, later.PathPrefix) {
+		return nil
+	}
+	switch {
+	case coversMethods(earlier.Methods, later.Methods):
+		return fmt.Errorf("is unreachable: rules[%d] (path %q) already selects all its requests", i, earlier.PathPrefix)
+	case overlapsMethods(earlier.Methods, later.Methods):
+		return fmt.Errorf("overlaps rules[%d] (path %q): some of its methods are decided by the earlier rule; split the methods between the rules", i, earlier.PathPrefix)
+	}
+	return nil
+}
+
+// pathCovers reports whether every path selected by inner is also selected by
+// outer. Prefixes match on whole segments, as in spiffehttp.Rule.
+func pathCovers(outer, inner string) bool {
+	if !strings.HasPrefix(inner, outer) {
+		return false
+	}
+	return len(inner) == len(outer) || strings.HasSuffix(outer, "/") || inner[len(outer)] == '/'
+}
+
+// coversMethods reports whether outer selects every method inner does.
+// An empty list selects all methods.
+func coversMethods(outer, inner []string) bool {
+	if len(outer) == 0 {
+		return true
+	}
+	if len(inner) == 0 {
+		return false
+	}
+	for _, m := range inner {
+		if !slices.Contains(outer, m) {
+			return false
+		}
+	}
+	return true
+}
+
+// overlapsMethods reports whether a and b select at least one common method.
+func overlapsMethods(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, m := range b {
+		if slices.Contains(a, m) {
+			return true
+		}
+	}
+	return false
+}
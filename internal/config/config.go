@@ -1,5 +1,10 @@
 package config
 
+import (
+	"fmt"
+	"reflect"
+)
+
 // SPIRESection contains SPIRE Workload API configuration.
 // This is shared between server and client processes.
 type SPIRESection struct {
@@ -14,17 +19,273 @@ type SPIRESection struct {
 	InitialFetchTimeout string `yaml:"initial_fetch_timeout"`
 }
 
+// Identity modes for IdentitySection.Mode.
+const (
+	// IdentityModeSPIRE gets the SVID and trust bundle from the Workload API
+	// configured in the spire section. This is the default.
+	IdentityModeSPIRE = "spire"
+
+	// IdentityModeFiles reads the SVID and trust bundle from PEM files
+	// written by spiffe-helper, csi-driver-spiffe or a similar agent.
+	IdentityModeFiles = "files"
+
+	// IdentityModeDev issues short-lived SVIDs from a local CA, for
+	// local development without SPIRE. It is refused unless the
+	// E5S_ALLOW_DEV_IDENTITY environment variable is set.
+	IdentityModeDev = "dev"
+)
+
+// IdentitySection selects where a process gets its X.509 SVID and trust bundle.
+// This is shared between server and client processes.
+type IdentitySection struct {
+	// Mode is "spire" (default), "files" or "dev".
+	Mode string `yaml:"mode"`
+
+	// CertFile, KeyFile and BundleFile are the PEM files of the SVID
+	// certificate chain, its private key and the trust bundle. Required in
+	// files mode, not allowed otherwise.
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	BundleFile string `yaml:"bundle_file"`
+
+	// PollInterval is how often the files are checked for rotation.
+	// Use Go duration format: "1s", "30s", etc.
+	// If not set, defaults to 2 seconds.
+	PollInterval string `yaml:"poll_interval"`
+
+	// SPIFFEID is the SPIFFE ID issued to the process. Required in dev mode,
+	// not allowed otherwise. Its trust domain names the dev CA.
+	SPIFFEID string `yaml:"spiffe_id"`
+
+	// SVIDTTL is how long each dev SVID is valid; it is renewed at half its
+	// lifetime. Use Go duration format: "10m", "1h", etc.
+	// If not set, defaults to 1 hour.
+	SVIDTTL string `yaml:"svid_ttl"`
+
+	// CAKeyFile is the dev CA key shared by the processes that must trust
+	// each other; it is created if missing. Dev mode only. If not set, each
+	// process uses its own random CA key.
+	CAKeyFile string `yaml:"ca_key_file"`
+}
+
 // ServerSection contains server-specific configuration.
 type ServerSection struct {
-	ListenAddr               string `yaml:"listen_addr"`
-	AllowedClientSPIFFEID    string `yaml:"allowed_client_spiffe_id"`
+	// ListenAddr is the address the mTLS server listens on.
+	// Example: ":8443"
+	ListenAddr string `yaml:"listen_addr"`
+
+	// AllowedClientSPIFFEID allows this exact client SPIFFE ID.
+	// A client is allowed if it matches any of the allowed IDs, trust
+	// domains or ID patterns; at least one must be set.
+	AllowedClientSPIFFEID string `yaml:"allowed_client_spiffe_id"`
+
+	// AllowedClientSPIFFEIDs allows any of these exact client SPIFFE IDs.
+	AllowedClientSPIFFEIDs []string `yaml:"allowed_client_spiffe_ids"`
+
+	// AllowedClientTrustDomain allows any client in this trust domain.
 	AllowedClientTrustDomain string `yaml:"allowed_client_trust_domain"`
+
+	// AllowedClientTrustDomains allows any client in any of these trust domains.
+	AllowedClientTrustDomains []string `yaml:"allowed_client_trust_domains"`
+
+	// AllowedClientSPIFFEIDPatterns allows any client whose SPIFFE ID matches
+	// one of these patterns. "*" matches within a path segment and a whole
+	// "{name}" segment captures its value for handlers.
+	// Example: "spiffe://prod.corp/ns/{namespace}/sa/billing-*"
+	AllowedClientSPIFFEIDPatterns []string `yaml:"allowed_client_spiffe_id_patterns"`
+
+	// ShutdownTimeout is the total time allowed for a graceful shutdown,
+	// including DrainDelay and waiting for in-flight requests.
+	// Use Go duration format: "5s", "30s", "1m", etc.
+	// If not set, defaults to 5 seconds.
+	ShutdownTimeout string `yaml:"shutdown_timeout"`
+
+	// HealthListenAddr is an optional plain-HTTP address serving /livez and
+	// /readyz for probes that cannot present an SVID (e.g. kubelet).
+	// Example: ":8080"
+	HealthListenAddr string `yaml:"health_listen_addr"`
+
+	// DrainDelay is how long the server keeps accepting connections after
+	// shutdown starts and readiness is withdrawn, giving load balancers time
+	// to stop routing new traffic to it (Kubernetes pre-stop delay).
+	// Must be shorter than ShutdownTimeout. If not set, defaults to 0.
+	DrainDelay string `yaml:"drain_delay"`
+
+	// MaxConnectionAge closes client connections once they are this old,
+	// as soon as they have no request in flight, so long-lived HTTP/2 and
+	// keep-alive connections handshake again periodically. If not set,
+	// connections are only closed when their client certificate expires or
+	// stops verifying against the trust bundle.
+	// Example: "1h"
+	MaxConnectionAge string `yaml:"max_connection_age"`
+
+	// Authorization holds per-route rules applied to every request after the
+	// handshake policy above has admitted the client.
+	Authorization AuthorizationSection `yaml:"authorization"`
+
+	// DenyListFile is an optional YAML file of SPIFFE IDs, ID patterns and
+	// SVID serial numbers to reject (see DenyListFile). Denied clients fail
+	// the handshake, and requests on connections they already hold get 403.
+	// The file is reloaded when it changes.
+	// Example: "/etc/e5s/deny.yaml"
+	DenyListFile string `yaml:"deny_list_file"`
+
+	// Audit selects where the server writes an audit event for every
+	// handshake and per-route authorization decision.
+	Audit AuditSection `yaml:"audit"`
+}
+
+// AuditSection selects the sinks of a server's audit log. Each event is a
+// JSON object with the peer, addresses, decision, rule and reason. Sinks can
+// be combined; none is enabled by default.
+type AuditSection struct {
+	// File appends JSON lines to this file, creating it with mode 0600.
+	// Example: "/var/log/e5s/audit.jsonl"
+	File string `yaml:"file"`
+
+	// Stderr writes JSON lines to standard error.
+	Stderr bool `yaml:"stderr"`
+
+	// Syslog sends events to the local syslog daemon (facility AUTH).
+	// Not available on Windows.
+	Syslog bool `yaml:"syslog"`
+
+	// SyslogTag is the syslog tag. Defaults to "e5s".
+	SyslogTag string `yaml:"syslog_tag"`
+}
+
+// AuthorizationSection contains per-route authorization rules.
+//
+// Rules are evaluated in order and the first rule whose path and methods
+// select a request decides it. Requests no rule selects are denied. If no
+// rules are set, every client admitted by the handshake policy may call any
+// route.
+type AuthorizationSection struct {
+	Rules []AuthorizationRule `yaml:"rules"`
+}
+
+// AuthorizationRule allows the listed identities to call the routes under
+// Path with one of Methods. At least one allowed ID, pattern or trust domain
+// must be set.
+type AuthorizationRule struct {
+	// Path is a path prefix matched on whole segments: "/admin" selects
+	// "/admin" and "/admin/users" but not "/administrator". Example: "/admin"
+	Path string `yaml:"path"`
+
+	// Methods restricts the rule to these HTTP methods. Empty means any.
+	Methods []string `yaml:"methods"`
+
+	// AllowedSPIFFEIDs allows these exact client SPIFFE IDs.
+	AllowedSPIFFEIDs []string `yaml:"allowed_spiffe_ids"`
+
+	// AllowedSPIFFEIDPatterns allows client SPIFFE IDs matching these patterns.
+	AllowedSPIFFEIDPatterns []string `yaml:"allowed_spiffe_id_patterns"`
+
+	// AllowedTrustDomains allows any client in these trust domains.
+	AllowedTrustDomains []string `yaml:"allowed_trust_domains"`
+}
+
+// NamedServerSection is one entry of the "servers" list: a server section
+// with a name that handlers are bound to.
+type NamedServerSection struct {
+	// Name identifies the server in e5s.ServeMulti and Runtime.Server.
+	// Must be unique within the list. Example: "admin"
+	Name string `yaml:"name"`
+
+	ServerSection `yaml:",inline"`
 }
 
 // ClientSection contains client-specific configuration.
 type ClientSection struct {
-	ExpectedServerSPIFFEID    string `yaml:"expected_server_spiffe_id"`
+	// ExpectedServerSPIFFEID accepts a server presenting this exact SPIFFE ID.
+	// A server is accepted if it matches any of the expected IDs, trust
+	// domains or ID patterns; at least one must be set unless Destinations
+	// is, in which case they apply to hosts Destinations does not list.
+	ExpectedServerSPIFFEID string `yaml:"expected_server_spiffe_id"`
+
+	// ExpectedServerSPIFFEIDs accepts a server presenting any of these exact SPIFFE IDs.
+	ExpectedServerSPIFFEIDs []string `yaml:"expected_server_spiffe_ids"`
+
+	// ExpectedServerTrustDomain accepts any server in this trust domain.
 	ExpectedServerTrustDomain string `yaml:"expected_server_trust_domain"`
+
+	// ExpectedServerTrustDomains accepts any server in any of these trust domains.
+	ExpectedServerTrustDomains []string `yaml:"expected_server_trust_domains"`
+
+	// ExpectedServerSPIFFEIDPatterns accepts a server whose SPIFFE ID matches
+	// any of these patterns. Example: "spiffe://example.org/ns/*/sa/api"
+	ExpectedServerSPIFFEIDPatterns []string `yaml:"expected_server_spiffe_id_patterns"`
+
+	// Destinations sets the expected server identity per upstream, keyed by
+	// "host" or "host:port". A request to a listed destination verifies the
+	// server against that entry only; a request to an unlisted host uses the
+	// expected_server_* fields above, and fails if none are set.
+	// Example: {"billing.internal:8443": {expected_server_spiffe_id: "spiffe://corp/billing"}}
+	Destinations map[string]DestinationSection `yaml:"destinations"`
+
+	// DenyListFile is an optional YAML file of SPIFFE IDs, ID patterns and
+	// SVID serial numbers to reject (see DenyListFile), checked for every
+	// destination. The file is reloaded when it changes.
+	// Example: "/etc/e5s/deny.yaml"
+	DenyListFile string `yaml:"deny_list_file"`
+
+	// Transport tunes the HTTP client's timeouts and connection pool.
+	Transport TransportSection `yaml:"transport"`
+}
+
+// DestinationSection is the expected server identity for one destination in
+// client.destinations. The server is accepted if it matches any of the
+// expected IDs, trust domains or ID patterns; at least one must be set.
+type DestinationSection struct {
+	ExpectedServerSPIFFEID         string   `yaml:"expected_server_spiffe_id"`
+	ExpectedServerSPIFFEIDs        []string `yaml:"expected_server_spiffe_ids"`
+	ExpectedServerTrustDomain      string   `yaml:"expected_server_trust_domain"`
+	ExpectedServerTrustDomains     []string `yaml:"expected_server_trust_domains"`
+	ExpectedServerSPIFFEIDPatterns []string `yaml:"expected_server_spiffe_id_patterns"`
+}
+
+// TransportSection contains HTTP client transport settings.
+// Durations use Go duration format: "5s", "30s", "1m", etc.
+// A duration of "0s" means no limit.
+type TransportSection struct {
+	// Timeout bounds a whole request, including reading the response body.
+	// If not set, defaults to 0 (no limit).
+	Timeout string `yaml:"timeout"`
+
+	// DialTimeout bounds establishing the TCP connection.
+	// If not set, defaults to 30 seconds.
+	DialTimeout string `yaml:"dial_timeout"`
+
+	// KeepAlive is the interval between TCP keep-alive probes.
+	// If not set, defaults to 30 seconds.
+	KeepAlive string `yaml:"keep_alive"`
+
+	// TLSHandshakeTimeout bounds the mTLS handshake.
+	// If not set, defaults to 10 seconds.
+	TLSHandshakeTimeout string `yaml:"tls_handshake_timeout"`
+
+	// ResponseHeaderTimeout bounds waiting for response headers after the
+	// request has been written. If not set, defaults to 0 (no limit).
+	ResponseHeaderTimeout string `yaml:"response_header_timeout"`
+
+	// IdleConnTimeout is how long an idle pooled connection is kept.
+	// If not set, defaults to 90 seconds.
+	IdleConnTimeout string `yaml:"idle_conn_timeout"`
+
+	// MaxIdleConns limits idle connections across all hosts.
+	// If not set, defaults to 100.
+	MaxIdleConns int `yaml:"max_idle_conns"`
+
+	// MaxIdleConnsPerHost limits idle connections per host.
+	// If not set, defaults to 2.
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+
+	// ForceHTTP2 negotiates HTTP/2 with servers that support it.
+	ForceHTTP2 bool `yaml:"force_http2"`
+
+	// ProxyFromEnvironment routes requests through the proxy named by
+	// HTTPS_PROXY / NO_PROXY. Off by default.
+	ProxyFromEnvironment bool `yaml:"proxy_from_environment"`
 }
 
 // ServerFileConfig represents an e5s server configuration file.
@@ -36,8 +297,14 @@ type ServerFileConfig struct {
 	// Future versions may add/change fields while maintaining backward compatibility.
 	Version int `yaml:"version,omitempty"`
 
-	SPIRE  SPIRESection  `yaml:"spire"`
-	Server ServerSection `yaml:"server"`
+	SPIRE    SPIRESection    `yaml:"spire"`
+	Identity IdentitySection `yaml:"identity,omitempty"`
+	Server   ServerSection   `yaml:"server"`
+
+	// Servers lists additional named listeners, each with its own policy.
+	// All of them share the SPIRE source when run with e5s.ServeMulti or
+	// e5s.Runtime. When set, the unnamed server section becomes optional.
+	Servers []NamedServerSection `yaml:"servers,omitempty"`
 }
 
 // ClientFileConfig represents an e5s client configuration file.
@@ -49,6 +316,78 @@ type ClientFileConfig struct {
 	// Future versions may add/change fields while maintaining backward compatibility.
 	Version int `yaml:"version,omitempty"`
 
-	SPIRE  SPIRESection  `yaml:"spire"`
-	Client ClientSection `yaml:"client"`
+	SPIRE    SPIRESection    `yaml:"spire"`
+	Identity IdentitySection `yaml:"identity,omitempty"`
+	Client   ClientSection   `yaml:"client"`
+}
+
+// FileConfig represents a combined e5s configuration file with both server
+// and client sections.
+// This config is used by processes that share one SPIRE source between the
+// servers they run and the clients they use (see e5s.Runtime).
+//
+// The server and client sections are optional; each is validated when a
+// server or client is built from it.
+type FileConfig struct {
+	// Version is the config file format version (optional, currently always 1)
+	// Future versions may add/change fields while maintaining backward compatibility.
+	Version int `yaml:"version,omitempty"`
+
+	SPIRE    SPIRESection         `yaml:"spire"`
+	Identity IdentitySection      `yaml:"identity,omitempty"`
+	Server   ServerSection        `yaml:"server"`
+	Servers  []NamedServerSection `yaml:"servers,omitempty"`
+	Client   ClientSection        `yaml:"client"`
+}
+
+// ServerConfig returns the server view of the combined config.
+func (c FileConfig) ServerConfig() ServerFileConfig {
+	return ServerFileConfig{Version: c.Version, SPIRE: c.SPIRE, Identity: c.Identity, Server: c.Server, Servers: c.Servers}
+}
+
+// ClientConfig returns the client view of the combined config.
+func (c FileConfig) ClientConfig() ClientFileConfig {
+	return ClientFileConfig{Version: c.Version, SPIRE: c.SPIRE, Identity: c.Identity, Client: c.Client}
+}
+
+// Section returns the server section with the given name: the unnamed
+// "server" section for "", otherwise the matching "servers" entry.
+func (c ServerFileConfig) Section(name string) (ServerSection, bool) {
+	if name == "" {
+		return c.Server, true
+	}
+	for _, s := range c.Servers {
+		if s.Name == name {
+			return s.ServerSection, true
+		}
+	}
+	return ServerSection{}, false
+}
+
+// SectionPath returns the path of the server section called name in the
+// config file, as used in error messages: "server" for "", otherwise
+// "servers[<name>]".
+func SectionPath(name string) string {
+	if name == "" {
+		return "server"
+	}
+	return fmt.Sprintf("servers[%s]", name)
+}
+
+// SectionNames returns the names of all configured servers, in file order.
+// The unnamed "server" section is reported as "" when it is set.
+func (c ServerFileConfig) SectionNames() []string {
+	var names []string
+	if !c.Server.isZero() {
+		names = append(names, "")
+	}
+	for _, s := range c.Servers {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// isZero reports whether the section was left out of the config entirely.
+func (s ServerSection) isZero() bool {
+	return reflect.ValueOf(s).IsZero()
 }
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParseDestinations validates and parses client.destinations, returning the
+// expected server identity of each destination keyed by its normalized form
+// (see DestinationKey).
+func ParseDestinations(dests map[string]DestinationSection) (map[string]ClientAuthz, error) {
+	keys := make([]string, 0, len(dests))
+	for k := range dests {
+		keys = append(keys, k)
+	}
+	// Sorted so the first error reported does not depend on map order
+	slices.Sort(keys)
+
+	out := make(map[string]ClientAuthz, len(dests))
+	for _, raw := range keys {
+		field := fmt.Sprintf("client.destinations[%q]", raw)
+		key, err := DestinationKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", field, err)
+		}
+		if _, dup := out[key]; dup {
+			return nil, fmt.Errorf("duplicate %s: another destination normalizes to %q", field, key)
+		}
+		d := dests[raw]
+		authz, err := validateAuthz(authzSection{
+			id:       d.ExpectedServerSPIFFEID,
+			ids:      d.ExpectedServerSPIFFEIDs,
+			td:       d.ExpectedServerTrustDomain,
+			tds:      d.ExpectedServerTrustDomains,
+			patterns: d.ExpectedServerSPIFFEIDPatterns,
+		}, field+".expected_server")
+		if err != nil {
+			return nil, err
+		}
+		out[key] = ClientAuthz{IDs: authz.ids, TrustDomains: authz.tds, IDPatterns: authz.patterns}
+	}
+	return out, nil
+}
+
+// DestinationKey normalizes a "host" or "host:port" destination: the host is
+// lowercased, IPv6 brackets are removed from a bare host, and a port must be
+// a number from 1 to 65535. Request hosts are normalized the same way before
+// they are looked up, so "API.internal" and "api.internal" are one destination.
+func DestinationKey(hostport string) (string, error) {
+	hostport = strings.ToLower(strings.TrimSpace(hostport))
+	if hostport == "" {
+		return "", errors.New("destination must not be empty")
+	}
+	if strings.ContainsAny(hostport, "/?#@ ") {
+		return "", fmt.Errorf("destination %q must be a host or host:port, not a URL", hostport)
+	}
+
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// No port: a hostname, an IPv4 address, or a bare or bracketed IPv6 address
+		host = strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]")
+		if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+			return "", fmt.Errorf("destination %q must be a host or host:port", hostport)
+		}
+		if host == "" {
+			return "", fmt.Errorf("destination %q has an empty host", hostport)
+		}
+		return host, nil
+	}
+	if host == "" {
+		return "", fmt.Errorf("destination %q has an empty host", hostport)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("destination %q has an invalid port", hostport)
+	}
+	return net.JoinHostPort(host, port), nil
+}
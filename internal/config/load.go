@@ -61,3 +61,27 @@ func LoadClientConfig(path string) (ClientFileConfig, error) {
 
 	return cfg, nil
 }
+
+// LoadConfig reads and parses a combined e5s configuration file.
+// Use this for processes that run servers and clients from one file.
+func LoadConfig(path string) (FileConfig, error) {
+	// Clean the path to prevent directory traversal attacks
+	cleanPath := filepath.Clean(path)
+	data, err := os.ReadFile(cleanPath) // #nosec G304 - Config file path is trusted (from admin/user)
+	if err != nil {
+		return FileConfig{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg FileConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return FileConfig{}, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	// Validate version if specified
+	// Version 0 (unspecified) is treated as version 1 for backward compatibility
+	if cfg.Version != 0 && cfg.Version != CurrentConfigVersion {
+		return FileConfig{}, fmt.Errorf("unsupported config version %d (current version: %d)", cfg.Version, CurrentConfigVersion)
+	}
+
+	return cfg, nil
+}
@@ -3,6 +3,11 @@ package config
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -13,30 +18,115 @@ const (
 	// DefaultInitialFetchTimeout is the default timeout for fetching the first SVID
 	// from the SPIRE Workload API if not specified in config.
 	DefaultInitialFetchTimeout = 30 * time.Second
+
+	// DefaultShutdownTimeout is the default total time allowed for a graceful
+	// server shutdown if server.shutdown_timeout is not specified.
+	DefaultShutdownTimeout = 5 * time.Second
+
+	// Client transport defaults, matching net/http's DefaultTransport.
+	DefaultDialTimeout         = 30 * time.Second
+	DefaultKeepAlive           = 30 * time.Second
+	DefaultTLSHandshakeTimeout = 10 * time.Second
+	DefaultIdleConnTimeout     = 90 * time.Second
+	DefaultMaxIdleConns        = 100
+	DefaultMaxIdleConnsPerHost = 2
 )
 
-// SPIREConfig contains parsed SPIRE Workload API configuration.
+// SPIREConfig contains parsed SPIRE Workload API configuration, or the
+// identity settings used instead of it.
 type SPIREConfig struct {
 	// InitialFetchTimeout is the parsed timeout for initial SVID fetch
 	InitialFetchTimeout time.Duration
+	// Mode is the identity mode: IdentityModeSPIRE, IdentityModeFiles or
+	// IdentityModeDev
+	Mode string
+	// PollInterval is the parsed identity.poll_interval (zero means the default)
+	PollInterval time.Duration
+	// SVIDTTL is the parsed identity.svid_ttl (zero means the default)
+	SVIDTTL time.Duration
+	// DevID is the parsed identity.spiffe_id in dev mode
+	DevID spiffeid.ID
+}
+
+// ServerShutdown contains the parsed graceful shutdown settings for a server.
+type ServerShutdown struct {
+	// Timeout is the total time allowed for shutdown, including DrainDelay
+	Timeout time.Duration
+	// DrainDelay is how long to keep serving after readiness is withdrawn
+	DrainDelay time.Duration
+}
+
+// ClientTransport contains the parsed HTTP transport settings for a client.
+// Zero durations mean no limit.
+type ClientTransport struct {
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	ForceHTTP2            bool
+	ProxyFromEnvironment  bool
 }
 
 // ServerAuthz contains the parsed authorization policy for a server.
-// Exactly one of ID or TrustDomain will be set (never both).
+// A client is allowed if it matches any entry; at least one is set.
 type ServerAuthz struct {
-	// ID is the specific client SPIFFE ID to allow (if using ID-based authz)
-	ID spiffeid.ID
-	// TrustDomain is the trust domain to allow (if using trust-domain-based authz)
-	TrustDomain spiffeid.TrustDomain
+	// IDs are the specific client SPIFFE IDs to allow
+	IDs []spiffeid.ID
+	// TrustDomains are the trust domains whose members are allowed
+	TrustDomains []spiffeid.TrustDomain
+	// IDPatterns are the client SPIFFE ID patterns to allow
+	IDPatterns []IDPattern
+	// Rules are the per-route authorization rules, in evaluation order
+	Rules []Rule
 }
 
 // ClientAuthz contains the parsed verification policy for a client.
-// Exactly one of ID or TrustDomain will be set (never both).
+// A server is accepted if it matches any entry; at least one is set.
 type ClientAuthz struct {
-	// ID is the expected server SPIFFE ID (if using ID-based verification)
-	ID spiffeid.ID
-	// TrustDomain is the expected server trust domain (if using trust-domain-based verification)
-	TrustDomain spiffeid.TrustDomain
+	// IDs are the expected server SPIFFE IDs
+	IDs []spiffeid.ID
+	// TrustDomains are the expected server trust domains
+	TrustDomains []spiffeid.TrustDomain
+	// IDPatterns are the expected server SPIFFE ID patterns
+	IDPatterns []IDPattern
+	// Destinations are the per-destination expected identities, keyed by
+	// DestinationKey. Their own Destinations field is always nil.
+	Destinations map[string]ClientAuthz
+}
+
+// IDPattern is a SPIFFE ID pattern as written in the config, with the field
+// that set it. Patterns are left unparsed here: package e5s parses them with
+// spiffehttp.ParseIDPattern, which internal/config must not import (see
+// docs/explanation/architecture.md).
+type IDPattern struct {
+	// Field names the config field, e.g. "server.allowed_client_spiffe_id_patterns[0]"
+	Field string
+	// Pattern is the trimmed pattern
+	Pattern string
+}
+
+// AllIDPatterns returns the ID patterns of the policy followed by those of
+// its rules.
+func (a ServerAuthz) AllIDPatterns() []IDPattern {
+	patterns := slices.Clone(a.IDPatterns)
+	for _, rule := range a.Rules {
+		patterns = append(patterns, rule.IDPatterns...)
+	}
+	return patterns
+}
+
+// AllIDPatterns returns the ID patterns of the policy followed by those of
+// each destination, in key order.
+func (a ClientAuthz) AllIDPatterns() []IDPattern {
+	patterns := slices.Clone(a.IDPatterns)
+	for _, key := range slices.Sorted(maps.Keys(a.Destinations)) {
+		patterns = append(patterns, a.Destinations[key].IDPatterns...)
+	}
+	return patterns
 }
 
 // validateSPIRESection validates and parses common SPIRE configuration from a SPIRESection.
@@ -44,72 +134,433 @@ func validateSPIRESection(spire SPIRESection) (SPIREConfig, error) {
 	if strings.TrimSpace(spire.WorkloadSocket) == "" {
 		return SPIREConfig{}, errors.New("spire.workload_socket must be set")
 	}
-	timeout := DefaultInitialFetchTimeout
-	timeoutStr := strings.TrimSpace(spire.InitialFetchTimeout)
-	if timeoutStr != "" {
-		var err error
-		if timeout, err = time.ParseDuration(timeoutStr); err != nil {
-			return SPIREConfig{}, fmt.Errorf("invalid spire.initial_fetch_timeout %q: %w", timeoutStr, err)
+	timeout, err := parseDuration(spire.InitialFetchTimeout, "spire.initial_fetch_timeout", DefaultInitialFetchTimeout, false)
+	if err != nil {
+		return SPIREConfig{}, err
+	}
+	return SPIREConfig{InitialFetchTimeout: timeout}, nil
+}
+
+// validateIdentity validates the identity section and, unless it selects
+// files or dev mode, the spire section it falls back to.
+func validateIdentity(spire SPIRESection, identity IdentitySection) (SPIREConfig, error) {
+	mode := strings.TrimSpace(identity.Mode)
+	switch mode {
+	case "":
+		mode = IdentityModeSPIRE
+	case IdentityModeSPIRE, IdentityModeFiles, IdentityModeDev:
+	default:
+		return SPIREConfig{}, fmt.Errorf("identity.mode must be %q, %q or %q, got %q", IdentityModeSPIRE, IdentityModeFiles, IdentityModeDev, mode)
+	}
+
+	// Each field belongs to one mode and is rejected in the others
+	fields := []struct{ field, value, mode string }{
+		{"identity.cert_file", identity.CertFile, IdentityModeFiles},
+		{"identity.key_file", identity.KeyFile, IdentityModeFiles},
+		{"identity.bundle_file", identity.BundleFile, IdentityModeFiles},
+		{"identity.poll_interval", identity.PollInterval, IdentityModeFiles},
+		{"identity.spiffe_id", identity.SPIFFEID, IdentityModeDev},
+		{"identity.svid_ttl", identity.SVIDTTL, IdentityModeDev},
+		{"identity.ca_key_file", identity.CAKeyFile, IdentityModeDev},
+	}
+	for _, f := range fields {
+		if f.mode != mode && strings.TrimSpace(f.value) != "" {
+			return SPIREConfig{}, fmt.Errorf("%s requires identity.mode: %s", f.field, f.mode)
+		}
+	}
+
+	switch mode {
+	case IdentityModeFiles:
+		for _, f := range fields[:3] {
+			if strings.TrimSpace(f.value) == "" {
+				return SPIREConfig{}, fmt.Errorf("%s must be set when identity.mode is %s", f.field, IdentityModeFiles)
+			}
 		}
-		if timeout <= 0 {
-			return SPIREConfig{}, fmt.Errorf("spire.initial_fetch_timeout must be positive, got %q", timeoutStr)
+		interval, err := parseDuration(identity.PollInterval, "identity.poll_interval", 0, false)
+		if err != nil {
+			return SPIREConfig{}, err
+		}
+		return SPIREConfig{Mode: mode, PollInterval: interval}, nil
+	case IdentityModeDev:
+		raw := strings.TrimSpace(identity.SPIFFEID)
+		if raw == "" {
+			return SPIREConfig{}, fmt.Errorf("identity.spiffe_id must be set when identity.mode is %s", IdentityModeDev)
+		}
+		id, err := spiffeid.FromString(raw)
+		if err != nil {
+			return SPIREConfig{}, fmt.Errorf("invalid identity.spiffe_id %q: %w", raw, err)
 		}
+		ttl, err := parseDuration(identity.SVIDTTL, "identity.svid_ttl", 0, false)
+		if err != nil {
+			return SPIREConfig{}, err
+		}
+		return SPIREConfig{Mode: mode, SVIDTTL: ttl, DevID: id}, nil
+	default:
+		spireConfig, err := validateSPIRESection(spire)
+		spireConfig.Mode = mode
+		return spireConfig, err
 	}
-	return SPIREConfig{InitialFetchTimeout: timeout}, nil
 }
 
-// validateAuthz parses and validates a SPIFFE ID or trust domain policy.
-// Ensures exactly one is set, trims whitespace, and uses SDK for validation.
-func validateAuthz(idStr, tdStr, prefix string) (spiffeid.ID, spiffeid.TrustDomain, error) {
-	idStr = strings.TrimSpace(idStr)
-	tdStr = strings.TrimSpace(tdStr)
-	hasID := idStr != ""
-	hasTD := tdStr != ""
-	if !hasID && !hasTD {
-		return spiffeid.ID{}, spiffeid.TrustDomain{}, fmt.Errorf("must set exactly one of %s_spiffe_id or %s_trust_domain", prefix, prefix)
+// parseDuration parses an optional Go duration string from the config.
+// Returns def if the value is empty. Negative values are always rejected;
+// zero is rejected unless allowZero is set.
+func parseDuration(raw, field string, def time.Duration, allowZero bool) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return def, nil
 	}
-	if hasID && hasTD {
-		return spiffeid.ID{}, spiffeid.TrustDomain{}, fmt.Errorf("cannot set both %s_spiffe_id and %s_trust_domain", prefix, prefix)
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", field, raw, err)
 	}
-	if hasID {
-		id, err := spiffeid.FromString(idStr)
+	if d < 0 || (d == 0 && !allowZero) {
+		if allowZero {
+			return 0, fmt.Errorf("%s must not be negative, got %q", field, raw)
+		}
+		return 0, fmt.Errorf("%s must be positive, got %q", field, raw)
+	}
+	return d, nil
+}
+
+// ParseServerShutdown validates and parses the graceful shutdown settings of a
+// server section, reporting errors under prefix (see SectionPath).
+func ParseServerShutdown(server ServerSection, prefix string) (ServerShutdown, error) {
+	timeout, err := parseDuration(server.ShutdownTimeout, prefix+".shutdown_timeout", DefaultShutdownTimeout, false)
+	if err != nil {
+		return ServerShutdown{}, err
+	}
+	delay, err := parseDuration(server.DrainDelay, prefix+".drain_delay", 0, true)
+	if err != nil {
+		return ServerShutdown{}, err
+	}
+	if delay >= timeout {
+		return ServerShutdown{}, fmt.Errorf("%s.drain_delay (%v) must be shorter than %s.shutdown_timeout (%v)", prefix, delay, prefix, timeout)
+	}
+	return ServerShutdown{Timeout: timeout, DrainDelay: delay}, nil
+}
+
+// ParseMaxConnectionAge validates and parses the max_connection_age of a
+// server section, reporting errors under prefix. Returns 0 if it is not set.
+func ParseMaxConnectionAge(server ServerSection, prefix string) (time.Duration, error) {
+	return parseDuration(server.MaxConnectionAge, prefix+".max_connection_age", 0, false)
+}
+
+// ParseClientTransport validates and parses the transport settings of a client section.
+func ParseClientTransport(t TransportSection) (ClientTransport, error) {
+	parsed := ClientTransport{
+		ForceHTTP2:           t.ForceHTTP2,
+		ProxyFromEnvironment: t.ProxyFromEnvironment,
+	}
+	durations := []struct {
+		raw   string
+		field string
+		def   time.Duration
+		dst   *time.Duration
+	}{
+		{t.Timeout, "client.transport.timeout", 0, &parsed.Timeout},
+		{t.DialTimeout, "client.transport.dial_timeout", DefaultDialTimeout, &parsed.DialTimeout},
+		{t.KeepAlive, "client.transport.keep_alive", DefaultKeepAlive, &parsed.KeepAlive},
+		{t.TLSHandshakeTimeout, "client.transport.tls_handshake_timeout", DefaultTLSHandshakeTimeout, &parsed.TLSHandshakeTimeout},
+		{t.ResponseHeaderTimeout, "client.transport.response_header_timeout", 0, &parsed.ResponseHeaderTimeout},
+		{t.IdleConnTimeout, "client.transport.idle_conn_timeout", DefaultIdleConnTimeout, &parsed.IdleConnTimeout},
+	}
+	for _, d := range durations {
+		v, err := parseDuration(d.raw, d.field, d.def, true)
+		if err != nil {
+			return ClientTransport{}, err
+		}
+		*d.dst = v
+	}
+
+	switch {
+	case t.MaxIdleConns < 0:
+		return ClientTransport{}, fmt.Errorf("client.transport.max_idle_conns must not be negative, got %d", t.MaxIdleConns)
+	case t.MaxIdleConnsPerHost < 0:
+		return ClientTransport{}, fmt.Errorf("client.transport.max_idle_conns_per_host must not be negative, got %d", t.MaxIdleConnsPerHost)
+	}
+	parsed.MaxIdleConns = DefaultMaxIdleConns
+	if t.MaxIdleConns > 0 {
+		parsed.MaxIdleConns = t.MaxIdleConns
+	}
+	parsed.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	if t.MaxIdleConnsPerHost > 0 {
+		parsed.MaxIdleConnsPerHost = t.MaxIdleConnsPerHost
+	}
+	return parsed, nil
+}
+
+// authzSection holds the raw policy fields shared by server and client
+// sections: exact IDs, trust domains and ID patterns.
+type authzSection struct {
+	id       string
+	ids      []string
+	td       string
+	tds      []string
+	patterns []string
+}
+
+// parsedAuthz is the result of validateAuthz.
+type parsedAuthz struct {
+	ids      []spiffeid.ID
+	tds      []spiffeid.TrustDomain
+	patterns []IDPattern
+}
+
+// validateAuthz parses and validates a SPIFFE ID, trust domain and ID pattern
+// policy. The single-value fields and their list counterparts are combined;
+// at least one entry must be set. Whitespace is trimmed and the SDK validates
+// formats; ID patterns are only collected (see IDPattern).
+func validateAuthz(a authzSection, prefix string) (parsedAuthz, error) {
+	var out parsedAuthz
+	for i, raw := range combine(a.id, a.ids) {
+		id, err := spiffeid.FromString(raw)
 		if err != nil {
-			return spiffeid.ID{}, spiffeid.TrustDomain{}, fmt.Errorf("invalid %s_spiffe_id %q: %w", prefix, idStr, err)
+			return parsedAuthz{}, fmt.Errorf("invalid %s %q: %w", authzField(prefix+"_spiffe_id", a.id, i), raw, err)
 		}
-		return id, spiffeid.TrustDomain{}, nil
+		out.ids = append(out.ids, id)
+	}
+	for i, raw := range combine(a.td, a.tds) {
+		td, err := spiffeid.TrustDomainFromString(raw)
+		if err != nil {
+			return parsedAuthz{}, fmt.Errorf("invalid %s %q: %w", authzField(prefix+"_trust_domain", a.td, i), raw, err)
+		}
+		out.tds = append(out.tds, td)
+	}
+	for i, raw := range combine("", a.patterns) {
+		out.patterns = append(out.patterns, IDPattern{Field: authzField(prefix+"_spiffe_id_pattern", "", i), Pattern: raw})
 	}
-	td, err := spiffeid.TrustDomainFromString(tdStr)
+	if len(out.ids) == 0 && len(out.tds) == 0 && len(out.patterns) == 0 {
+		return parsedAuthz{}, fmt.Errorf("must set at least one of %s_spiffe_id(s), %s_trust_domain(s) or %s_spiffe_id_patterns", prefix, prefix, prefix)
+	}
+	return out, nil
+}
+
+// validateDenyListFile checks that the deny list file, if set, can be loaded.
+func validateDenyListFile(path, prefix string) error {
+	if strings.TrimSpace(path) == "" {
+		return nil
+	}
+	if _, err := LoadDenyList(strings.TrimSpace(path)); err != nil {
+		return fmt.Errorf("invalid %s.deny_list_file: %w", prefix, err)
+	}
+	return nil
+}
+
+// validateAudit checks that the audit log file, if set, is in an existing
+// directory. The file itself is created when the server starts.
+func validateAudit(audit AuditSection, prefix string) error {
+	if path := strings.TrimSpace(audit.File); path != "" {
+		dir := filepath.Dir(filepath.Clean(path))
+		if info, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("invalid %s.audit.file: %w", prefix, err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("invalid %s.audit.file: %s is not a directory", prefix, dir)
+		}
+	}
+	if strings.TrimSpace(audit.SyslogTag) != "" && !audit.Syslog {
+		return fmt.Errorf("%s.audit.syslog_tag requires %s.audit.syslog: true", prefix, prefix)
+	}
+	return nil
+}
+
+// empty reports whether no value of the section is set.
+func (a authzSection) empty() bool {
+	return len(combine(a.id, a.ids)) == 0 && len(combine(a.td, a.tds)) == 0 && len(combine("", a.patterns)) == 0
+}
+
+// combine returns the trimmed, non-empty values of a single-value field
+// followed by those of its list counterpart.
+func combine(single string, list []string) []string {
+	var out []string
+	for _, v := range append([]string{single}, list...) {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// authzField names the config field of the i-th value returned by combine,
+// for error messages: the single field first, then "<field>s[n]".
+func authzField(field, single string, i int) string {
+	if strings.TrimSpace(single) != "" {
+		if i == 0 {
+			return field
+		}
+		i--
+	}
+	return fmt.Sprintf("%ss[%d]", field, i)
+}
+
+// validateServerSection validates one server section, reporting errors under
+// prefix ("server" or "servers[<name>]").
+func validateServerSection(server ServerSection, prefix string) (ServerAuthz, error) {
+	if strings.TrimSpace(server.ListenAddr) == "" {
+		return ServerAuthz{}, fmt.Errorf("%s.listen_addr must be set", prefix)
+	}
+	authz, err := validateAuthz(authzSection{
+		id:       server.AllowedClientSPIFFEID,
+		ids:      server.AllowedClientSPIFFEIDs,
+		td:       server.AllowedClientTrustDomain,
+		tds:      server.AllowedClientTrustDomains,
+		patterns: server.AllowedClientSPIFFEIDPatterns,
+	}, prefix+".allowed_client")
+	if err != nil {
+		return ServerAuthz{}, err
+	}
+	if _, err := ParseServerShutdown(server, prefix); err != nil {
+		return ServerAuthz{}, err
+	}
+	if _, err := ParseMaxConnectionAge(server, prefix); err != nil {
+		return ServerAuthz{}, err
+	}
+	rules, err := ParseAuthorization(server.Authorization, prefix)
 	if err != nil {
-		return spiffeid.ID{}, spiffeid.TrustDomain{}, fmt.Errorf("invalid %s_trust_domain %q: %w", prefix, tdStr, err)
+		return ServerAuthz{}, err
+	}
+	if err := validateDenyListFile(server.DenyListFile, prefix); err != nil {
+		return ServerAuthz{}, err
+	}
+	if err := validateAudit(server.Audit, prefix); err != nil {
+		return ServerAuthz{}, err
+	}
+	if health := strings.TrimSpace(server.HealthListenAddr); health != "" && health == strings.TrimSpace(server.ListenAddr) && !isEphemeral(health) {
+		return ServerAuthz{}, fmt.Errorf("%s.health_listen_addr must differ from %s.listen_addr", prefix, prefix)
+	}
+	return ServerAuthz{IDs: authz.ids, TrustDomains: authz.tds, IDPatterns: authz.patterns, Rules: rules}, nil
+}
+
+// validateServerList validates the named "servers" entries: every entry needs
+// a unique name and a listen address not used by any other server.
+func validateServerList(server ServerSection, servers []NamedServerSection) error {
+	names := make(map[string]bool, len(servers))
+	addrs := make(map[string]string, len(servers)+1)
+	if addr := strings.TrimSpace(server.ListenAddr); addr != "" {
+		addrs[addr] = "server"
+	}
+	for i, s := range servers {
+		name := strings.TrimSpace(s.Name)
+		if name == "" {
+			return fmt.Errorf("servers[%d].name must be set", i)
+		}
+		if names[name] {
+			return fmt.Errorf("duplicate server name %q in servers", name)
+		}
+		names[name] = true
+
+		prefix := SectionPath(name)
+		if _, err := validateServerSection(s.ServerSection, prefix); err != nil {
+			return err
+		}
+		addr := strings.TrimSpace(s.ListenAddr)
+		if isEphemeral(addr) {
+			// Each ":0" listener gets its own ephemeral port
+			continue
+		}
+		if other, ok := addrs[addr]; ok {
+			return fmt.Errorf("%s.listen_addr %q is already used by %s", prefix, addr, other)
+		}
+		addrs[addr] = prefix
 	}
-	return spiffeid.ID{}, td, nil
+	return nil
+}
+
+// isEphemeral reports whether addr asks the OS to pick a port (":0").
+func isEphemeral(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port == "0"
 }
 
 // ValidateServerConfig validates server configuration and returns parsed authorization policy.
+//
+// The unnamed server section is required unless a "servers" list is given;
+// the returned policy is that of the unnamed section (zero if it is absent).
 func ValidateServerConfig(cfg *ServerFileConfig) (SPIREConfig, ServerAuthz, error) {
-	spireConfig, err := validateSPIRESection(cfg.SPIRE)
+	spireConfig, err := validateIdentity(cfg.SPIRE, cfg.Identity)
 	if err != nil {
 		return SPIREConfig{}, ServerAuthz{}, err
 	}
-	if strings.TrimSpace(cfg.Server.ListenAddr) == "" {
-		return SPIREConfig{}, ServerAuthz{}, errors.New("server.listen_addr must be set")
+	var authz ServerAuthz
+	if len(cfg.Servers) == 0 || !cfg.Server.isZero() {
+		authz, err = validateServerSection(cfg.Server, "server")
+		if err != nil {
+			return SPIREConfig{}, ServerAuthz{}, err
+		}
+	}
+	if err := validateServerList(cfg.Server, cfg.Servers); err != nil {
+		return SPIREConfig{}, ServerAuthz{}, err
+	}
+	return spireConfig, authz, nil
+}
+
+// ValidateServerSection validates the identity settings of cfg and its
+// cfg.Server section, reporting section errors under prefix. Use it for a
+// "servers" entry copied into cfg.Server, with SectionPath(name) as prefix,
+// so errors name the entry in the config file. cfg.Servers is not checked.
+func ValidateServerSection(cfg *ServerFileConfig, prefix string) (SPIREConfig, ServerAuthz, error) {
+	spireConfig, err := validateIdentity(cfg.SPIRE, cfg.Identity)
+	if err != nil {
+		return SPIREConfig{}, ServerAuthz{}, err
 	}
-	id, td, err := validateAuthz(cfg.Server.AllowedClientSPIFFEID, cfg.Server.AllowedClientTrustDomain, "server.allowed_client")
+	authz, err := validateServerSection(cfg.Server, prefix)
 	if err != nil {
 		return SPIREConfig{}, ServerAuthz{}, err
 	}
-	return spireConfig, ServerAuthz{ID: id, TrustDomain: td}, nil
+	return spireConfig, authz, nil
 }
 
 // ValidateClientConfig validates client configuration and returns parsed verification policy.
 func ValidateClientConfig(cfg *ClientFileConfig) (SPIREConfig, ClientAuthz, error) {
-	spireConfig, err := validateSPIRESection(cfg.SPIRE)
+	spireConfig, err := validateIdentity(cfg.SPIRE, cfg.Identity)
 	if err != nil {
 		return SPIREConfig{}, ClientAuthz{}, err
 	}
-	id, td, err := validateAuthz(cfg.Client.ExpectedServerSPIFFEID, cfg.Client.ExpectedServerTrustDomain, "client.expected_server")
+	destinations, err := ParseDestinations(cfg.Client.Destinations)
 	if err != nil {
 		return SPIREConfig{}, ClientAuthz{}, err
 	}
-	return spireConfig, ClientAuthz{ID: id, TrustDomain: td}, nil
+	section := authzSection{
+		id:       cfg.Client.ExpectedServerSPIFFEID,
+		ids:      cfg.Client.ExpectedServerSPIFFEIDs,
+		td:       cfg.Client.ExpectedServerTrustDomain,
+		tds:      cfg.Client.ExpectedServerTrustDomains,
+		patterns: cfg.Client.ExpectedServerSPIFFEIDPatterns,
+	}
+	// With destinations, the top-level policy is only the default for
+	// unlisted hosts and may be left empty to reject them
+	var authz parsedAuthz
+	if len(destinations) == 0 || !section.empty() {
+		authz, err = validateAuthz(section, "client.expected_server")
+		if err != nil {
+			return SPIREConfig{}, ClientAuthz{}, err
+		}
+	}
+	if _, err := ParseClientTransport(cfg.Client.Transport); err != nil {
+		return SPIREConfig{}, ClientAuthz{}, err
+	}
+	if err := validateDenyListFile(cfg.Client.DenyListFile, "client"); err != nil {
+		return SPIREConfig{}, ClientAuthz{}, err
+	}
+	return spireConfig, ClientAuthz{
+		IDs:          authz.ids,
+		TrustDomains: authz.tds,
+		IDPatterns:   authz.patterns,
+		Destinations: destinations,
+	}, nil
+}
+
+// ValidateConfig validates the shared SPIRE section and the named "servers"
+// list of a combined config. The unnamed server section and the client
+// section are validated by ValidateServerConfig and ValidateClientConfig when
+// a server or client is built from them.
+func ValidateConfig(cfg *FileConfig) (SPIREConfig, error) {
+	spireConfig, err := validateIdentity(cfg.SPIRE, cfg.Identity)
+	if err != nil {
+		return SPIREConfig{}, err
+	}
+	if err := validateServerList(cfg.Server, cfg.Servers); err != nil {
+		return SPIREConfig{}, err
+	}
+	return spireConfig, nil
 }
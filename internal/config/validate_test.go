@@ -1,6 +1,7 @@
 package config
 
 import (
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -74,10 +75,10 @@ func TestValidateServer(t *testing.T) {
 				},
 			},
 			wantErr: true,
-			errMsg:  "must set exactly one",
+			errMsg:  "must set at least one",
 		},
 		{
-			name: "both client ID and trust domain set",
+			name: "client ID and trust domain combined",
 			cfg: ServerFileConfig{
 				SPIRE: SPIRESection{
 					WorkloadSocket: "/run/spire/sockets/agent.sock",
@@ -85,11 +86,52 @@ func TestValidateServer(t *testing.T) {
 				Server: ServerSection{
 					ListenAddr:               ":8443",
 					AllowedClientSPIFFEID:    "spiffe://example.org/client",
-					AllowedClientTrustDomain: "example.org",
+					AllowedClientTrustDomain: "partner.org",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "lists of client IDs and trust domains",
+			cfg: ServerFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Server: ServerSection{
+					ListenAddr:                ":8443",
+					AllowedClientSPIFFEIDs:    []string{"spiffe://example.org/a", "spiffe://example.org/b"},
+					AllowedClientTrustDomains: []string{"partner.org", "vendor.org"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid entry in client ID list",
+			cfg: ServerFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Server: ServerSection{
+					ListenAddr:             ":8443",
+					AllowedClientSPIFFEID:  "spiffe://example.org/a",
+					AllowedClientSPIFFEIDs: []string{"spiffe://example.org/b", "not-an-id"},
 				},
 			},
 			wantErr: true,
-			errMsg:  "cannot set both",
+			errMsg:  "invalid server.allowed_client_spiffe_ids[1]",
+		},
+		{
+			name: "client ID patterns only",
+			cfg: ServerFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Server: ServerSection{
+					ListenAddr:                    ":8443",
+					AllowedClientSPIFFEIDPatterns: []string{"spiffe://prod.corp/ns/{namespace}/sa/billing-*"},
+				},
+			},
+			wantErr: false,
 		},
 		{
 			name: "invalid SPIFFE ID format",
@@ -145,6 +187,51 @@ func TestValidateServer(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "audit file in missing directory",
+			cfg: ServerFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Server: ServerSection{
+					ListenAddr:               ":8443",
+					AllowedClientTrustDomain: "example.org",
+					Audit:                    AuditSection{File: "/nonexistent/audit.jsonl"},
+				},
+			},
+			wantErr: true,
+			errMsg:  "invalid server.audit.file",
+		},
+		{
+			name: "audit syslog tag without syslog",
+			cfg: ServerFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Server: ServerSection{
+					ListenAddr:               ":8443",
+					AllowedClientTrustDomain: "example.org",
+					Audit:                    AuditSection{SyslogTag: "payments"},
+				},
+			},
+			wantErr: true,
+			errMsg:  "server.audit.syslog_tag requires",
+		},
+		{
+			name: "zero max connection age",
+			cfg: ServerFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Server: ServerSection{
+					ListenAddr:               ":8443",
+					AllowedClientTrustDomain: "example.org",
+					MaxConnectionAge:         "0s",
+				},
+			},
+			wantErr: true,
+			errMsg:  "server.max_connection_age must be positive",
+		},
 	}
 
 	for _, tt := range tests {
@@ -168,14 +255,9 @@ func TestValidateServer(t *testing.T) {
 					t.Errorf("ValidateServer() returned invalid timeout: %v", spireConfig.InitialFetchTimeout)
 				}
 				// Verify we got a valid authz policy
-				hasID := authz.ID.String() != ""
-				hasTD := authz.TrustDomain.String() != ""
-				if !hasID && !hasTD {
+				if len(authz.IDs) == 0 && len(authz.TrustDomains) == 0 && len(authz.IDPatterns) == 0 {
 					t.Error("ValidateServer() returned empty authz policy")
 				}
-				if hasID && hasTD {
-					t.Error("ValidateServer() returned authz with both ID and TrustDomain set")
-				}
 			}
 		})
 	}
@@ -230,21 +312,58 @@ func TestValidateClient(t *testing.T) {
 				},
 			},
 			wantErr: true,
-			errMsg:  "must set exactly one",
+			errMsg:  "must set at least one",
 		},
 		{
-			name: "both server ID and trust domain set",
+			name: "server ID and trust domain combined",
 			cfg: ClientFileConfig{
 				SPIRE: SPIRESection{
 					WorkloadSocket: "/run/spire/sockets/agent.sock",
 				},
 				Client: ClientSection{
 					ExpectedServerSPIFFEID:    "spiffe://example.org/server",
-					ExpectedServerTrustDomain: "example.org",
+					ExpectedServerTrustDomain: "partner.org",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "lists of server IDs and trust domains",
+			cfg: ClientFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Client: ClientSection{
+					ExpectedServerSPIFFEIDs:    []string{"spiffe://example.org/a", "spiffe://example.org/b"},
+					ExpectedServerTrustDomains: []string{"partner.org"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid entry in trust domain list",
+			cfg: ClientFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Client: ClientSection{
+					ExpectedServerTrustDomains: []string{"example.org", "invalid domain!"},
 				},
 			},
 			wantErr: true,
-			errMsg:  "cannot set both",
+			errMsg:  "invalid client.expected_server_trust_domains[1]",
+		},
+		{
+			name: "server ID patterns only",
+			cfg: ClientFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Client: ClientSection{
+					ExpectedServerSPIFFEIDPatterns: []string{"spiffe://example.org/ns/*/sa/api"},
+				},
+			},
+			wantErr: false,
 		},
 		{
 			name: "invalid SPIFFE ID format",
@@ -296,6 +415,81 @@ func TestValidateClient(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "destinations without a default policy",
+			cfg: ClientFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Client: ClientSection{
+					Destinations: map[string]DestinationSection{
+						"billing.internal:8443": {ExpectedServerSPIFFEID: "spiffe://example.org/billing"},
+						"ledger.internal":       {ExpectedServerSPIFFEIDPatterns: []string{"spiffe://example.org/ledger/*"}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "destination without an expected identity",
+			cfg: ClientFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Client: ClientSection{
+					Destinations: map[string]DestinationSection{"billing.internal": {}},
+				},
+			},
+			wantErr: true,
+			errMsg:  `must set at least one of client.destinations["billing.internal"].expected_server_spiffe_id(s)`,
+		},
+		{
+			name: "destination with invalid SPIFFE ID",
+			cfg: ClientFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Client: ClientSection{
+					ExpectedServerTrustDomain: "example.org",
+					Destinations: map[string]DestinationSection{
+						"billing.internal": {ExpectedServerSPIFFEID: "billing"},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  `invalid client.destinations["billing.internal"].expected_server_spiffe_id`,
+		},
+		{
+			name: "destination given as a URL",
+			cfg: ClientFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Client: ClientSection{
+					Destinations: map[string]DestinationSection{
+						"https://billing.internal": {ExpectedServerSPIFFEID: "spiffe://example.org/billing"},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "not a URL",
+		},
+		{
+			name: "destinations differing only in case",
+			cfg: ClientFileConfig{
+				SPIRE: SPIRESection{
+					WorkloadSocket: "/run/spire/sockets/agent.sock",
+				},
+				Client: ClientSection{
+					Destinations: map[string]DestinationSection{
+						"Billing.internal": {ExpectedServerSPIFFEID: "spiffe://example.org/billing"},
+						"billing.internal": {ExpectedServerSPIFFEID: "spiffe://example.org/billing-v2"},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "another destination normalizes to",
+		},
 	}
 
 	for _, tt := range tests {
@@ -319,19 +513,42 @@ func TestValidateClient(t *testing.T) {
 					t.Errorf("ValidateClient() returned invalid timeout: %v", spireConfig.InitialFetchTimeout)
 				}
 				// Verify we got a valid authz policy
-				hasID := authz.ID.String() != ""
-				hasTD := authz.TrustDomain.String() != ""
-				if !hasID && !hasTD {
+				if len(authz.IDs) == 0 && len(authz.TrustDomains) == 0 && len(authz.IDPatterns) == 0 && len(authz.Destinations) == 0 {
 					t.Error("ValidateClient() returned empty authz policy")
 				}
-				if hasID && hasTD {
-					t.Error("ValidateClient() returned authz with both ID and TrustDomain set")
-				}
 			}
 		})
 	}
 }
 
+// TestClientAuthz_AllIDPatterns verifies that ID patterns are collected
+// unparsed, with the field that set them, for package e5s to parse.
+func TestClientAuthz_AllIDPatterns(t *testing.T) {
+	cfg := ClientFileConfig{
+		SPIRE: SPIRESection{WorkloadSocket: "/run/spire/sockets/agent.sock"},
+		Client: ClientSection{
+			ExpectedServerSPIFFEIDPatterns: []string{"spiffe://example.org/ns/{ns}/sa/{ns}"},
+			Destinations: map[string]DestinationSection{
+				"ledger.internal":  {ExpectedServerSPIFFEIDPatterns: []string{"spiffe://example.org/ledger/*"}},
+				"billing.internal": {ExpectedServerSPIFFEIDPatterns: []string{"spiffe://example.org/billing/*"}},
+			},
+		},
+	}
+	_, authz, err := ValidateClientConfig(&cfg)
+	if err != nil {
+		t.Fatalf("ValidateClientConfig() unexpected error = %v", err)
+	}
+
+	want := []IDPattern{
+		{Field: "client.expected_server_spiffe_id_patterns[0]", Pattern: "spiffe://example.org/ns/{ns}/sa/{ns}"},
+		{Field: `client.destinations["billing.internal"].expected_server_spiffe_id_patterns[0]`, Pattern: "spiffe://example.org/billing/*"},
+		{Field: `client.destinations["ledger.internal"].expected_server_spiffe_id_patterns[0]`, Pattern: "spiffe://example.org/ledger/*"},
+	}
+	if got := authz.AllIDPatterns(); !slices.Equal(got, want) {
+		t.Errorf("AllIDPatterns() = %v, want %v", got, want)
+	}
+}
+
 func TestValidateSPIREConfig_Timeout(t *testing.T) {
 	tests := []struct {
 		name            string
@@ -442,3 +659,682 @@ func TestValidateSPIREConfig_Timeout(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateIdentity(t *testing.T) {
+	socket := SPIRESection{WorkloadSocket: "/run/spire/sockets/agent.sock"}
+	files := IdentitySection{
+		Mode:       "files",
+		CertFile:   "/var/run/secrets/spiffe.io/tls.crt",
+		KeyFile:    "/var/run/secrets/spiffe.io/tls.key",
+		BundleFile: "/var/run/secrets/spiffe.io/ca.crt",
+	}
+	withPoll := files
+	withPoll.PollInterval = "10s"
+	missingKey := files
+	missingKey.KeyFile = ""
+	zeroPoll := files
+	zeroPoll.PollInterval = "0s"
+
+	tests := []struct {
+		name     string
+		spire    SPIRESection
+		identity IdentitySection
+		wantMode string
+		wantPoll time.Duration
+		wantTTL  time.Duration
+		wantID   string
+		errMsg   string
+	}{
+		{
+			name:     "default mode uses the workload API",
+			spire:    socket,
+			wantMode: "spire",
+		},
+		{
+			name:     "explicit spire mode",
+			spire:    socket,
+			identity: IdentitySection{Mode: "spire"},
+			wantMode: "spire",
+		},
+		{
+			name:     "files mode without workload socket",
+			identity: files,
+			wantMode: "files",
+		},
+		{
+			name:     "files mode with poll interval",
+			identity: withPoll,
+			wantMode: "files",
+			wantPoll: 10 * time.Second,
+		},
+		{
+			name:     "files mode missing key file",
+			identity: missingKey,
+			errMsg:   "identity.key_file must be set",
+		},
+		{
+			name:     "files mode zero poll interval",
+			identity: zeroPoll,
+			errMsg:   "identity.poll_interval must be positive",
+		},
+		{
+			name:     "cert file without files mode",
+			spire:    socket,
+			identity: IdentitySection{CertFile: "/tmp/svid.pem"},
+			errMsg:   "identity.cert_file requires identity.mode: files",
+		},
+		{
+			name:     "dev mode",
+			identity: IdentitySection{Mode: "dev", SPIFFEID: "spiffe://example.org/api", SVIDTTL: "10m", CAKeyFile: "/tmp/dev-ca.pem"},
+			wantMode: "dev",
+			wantTTL:  10 * time.Minute,
+			wantID:   "spiffe://example.org/api",
+		},
+		{
+			name:     "dev mode missing SPIFFE ID",
+			identity: IdentitySection{Mode: "dev"},
+			errMsg:   "identity.spiffe_id must be set",
+		},
+		{
+			name:     "dev mode malformed SPIFFE ID",
+			identity: IdentitySection{Mode: "dev", SPIFFEID: "example.org/api"},
+			errMsg:   "invalid identity.spiffe_id",
+		},
+		{
+			name:     "dev mode with identity files",
+			identity: IdentitySection{Mode: "dev", SPIFFEID: "spiffe://example.org/api", CertFile: "/tmp/svid.pem"},
+			errMsg:   "identity.cert_file requires identity.mode: files",
+		},
+		{
+			name:     "SVID TTL without dev mode",
+			spire:    socket,
+			identity: IdentitySection{SVIDTTL: "1h"},
+			errMsg:   "identity.svid_ttl requires identity.mode: dev",
+		},
+		{
+			name:     "CA key file without dev mode",
+			spire:    socket,
+			identity: IdentitySection{CAKeyFile: "/tmp/dev-ca.pem"},
+			errMsg:   "identity.ca_key_file requires identity.mode: dev",
+		},
+		{
+			name:     "unknown mode",
+			spire:    socket,
+			identity: IdentitySection{Mode: "vault"},
+			errMsg:   `identity.mode must be "spire", "files" or "dev"`,
+		},
+		{
+			name:   "spire mode without workload socket",
+			errMsg: "spire.workload_socket must be set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spireConfig, err := validateIdentity(tt.spire, tt.identity)
+			if tt.errMsg != "" {
+				if err == nil {
+					t.Fatalf("validateIdentity() expected error containing %q, got nil", tt.errMsg)
+				}
+				if !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("validateIdentity() error = %q, want error containing %q", err.Error(), tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateIdentity() unexpected error = %v", err)
+			}
+			if spireConfig.Mode != tt.wantMode {
+				t.Errorf("validateIdentity() Mode = %q, want %q", spireConfig.Mode, tt.wantMode)
+			}
+			if spireConfig.PollInterval != tt.wantPoll {
+				t.Errorf("validateIdentity() PollInterval = %v, want %v", spireConfig.PollInterval, tt.wantPoll)
+			}
+			if spireConfig.SVIDTTL != tt.wantTTL {
+				t.Errorf("validateIdentity() SVIDTTL = %v, want %v", spireConfig.SVIDTTL, tt.wantTTL)
+			}
+			if got := spireConfig.DevID.String(); got != tt.wantID {
+				t.Errorf("validateIdentity() DevID = %q, want %q", got, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestParseServerShutdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		server    ServerSection
+		wantErr   bool
+		errMsg    string
+		wantTotal time.Duration
+		wantDelay time.Duration
+	}{
+		{
+			name:      "defaults",
+			server:    ServerSection{},
+			wantTotal: DefaultShutdownTimeout,
+			wantDelay: 0,
+		},
+		{
+			name:      "explicit values",
+			server:    ServerSection{ShutdownTimeout: "30s", DrainDelay: " 10s "},
+			wantTotal: 30 * time.Second,
+			wantDelay: 10 * time.Second,
+		},
+		{
+			name:      "zero drain delay",
+			server:    ServerSection{ShutdownTimeout: "10s", DrainDelay: "0s"},
+			wantTotal: 10 * time.Second,
+			wantDelay: 0,
+		},
+		{
+			name:    "invalid shutdown timeout",
+			server:  ServerSection{ShutdownTimeout: "forever"},
+			wantErr: true,
+			errMsg:  "invalid server.shutdown_timeout",
+		},
+		{
+			name:    "zero shutdown timeout",
+			server:  ServerSection{ShutdownTimeout: "0s"},
+			wantErr: true,
+			errMsg:  "server.shutdown_timeout must be positive",
+		},
+		{
+			name:    "negative drain delay",
+			server:  ServerSection{DrainDelay: "-1s"},
+			wantErr: true,
+			errMsg:  "server.drain_delay must not be negative",
+		},
+		{
+			name:    "drain delay not shorter than timeout",
+			server:  ServerSection{ShutdownTimeout: "5s", DrainDelay: "5s"},
+			wantErr: true,
+			errMsg:  "must be shorter than server.shutdown_timeout",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseServerShutdown(tt.server, "server")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseServerShutdown() expected error containing %q, got nil", tt.errMsg)
+				}
+				if !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("ParseServerShutdown() error = %q, want error containing %q", err.Error(), tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseServerShutdown() unexpected error = %v", err)
+			}
+			if got.Timeout != tt.wantTotal || got.DrainDelay != tt.wantDelay {
+				t.Errorf("ParseServerShutdown() = %+v, want Timeout=%v DrainDelay=%v", got, tt.wantTotal, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestValidateServerSection(t *testing.T) {
+	cfg := ServerFileConfig{
+		SPIRE:  SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"},
+		Server: ServerSection{ListenAddr: ":8443", AllowedClientTrustDomain: "corp", MaxConnectionAge: "-1h"},
+	}
+	_, _, err := ValidateServerSection(&cfg, SectionPath("api"))
+	if err == nil || !strings.Contains(err.Error(), "servers[api].max_connection_age") {
+		t.Fatalf("ValidateServerSection() error = %v, want error under servers[api]", err)
+	}
+
+	cfg.Server.MaxConnectionAge = "1h"
+	_, authz, err := ValidateServerSection(&cfg, SectionPath("api"))
+	if err != nil {
+		t.Fatalf("ValidateServerSection() unexpected error = %v", err)
+	}
+	if len(authz.TrustDomains) != 1 {
+		t.Errorf("ValidateServerSection() trust domains = %v, want [corp]", authz.TrustDomains)
+	}
+
+	if _, err := ParseMaxConnectionAge(ServerSection{MaxConnectionAge: "soon"}, SectionPath("admin")); err == nil || !strings.Contains(err.Error(), "servers[admin].max_connection_age") {
+		t.Errorf("ParseMaxConnectionAge() error = %v, want error under servers[admin]", err)
+	}
+	if got := SectionPath(""); got != "server" {
+		t.Errorf(`SectionPath("") = %q, want "server"`, got)
+	}
+}
+
+func TestValidateServer_ServersList(t *testing.T) {
+	spire := SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"}
+	api := NamedServerSection{
+		Name:          "api",
+		ServerSection: ServerSection{ListenAddr: ":8443", AllowedClientTrustDomain: "corp"},
+	}
+	admin := NamedServerSection{
+		Name:          "admin",
+		ServerSection: ServerSection{ListenAddr: ":9443", AllowedClientSPIFFEID: "spiffe://corp/ops/admin"},
+	}
+
+	tests := []struct {
+		name    string
+		cfg     ServerFileConfig
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name: "servers list without unnamed server",
+			cfg:  ServerFileConfig{SPIRE: spire, Servers: []NamedServerSection{api, admin}},
+		},
+		{
+			name: "servers list alongside unnamed server",
+			cfg: ServerFileConfig{
+				SPIRE:   spire,
+				Server:  ServerSection{ListenAddr: ":7443", AllowedClientTrustDomain: "corp"},
+				Servers: []NamedServerSection{admin},
+			},
+		},
+		{
+			name: "missing name",
+			cfg: ServerFileConfig{SPIRE: spire, Servers: []NamedServerSection{
+				api, {ServerSection: admin.ServerSection},
+			}},
+			wantErr: true,
+			errMsg:  "servers[1].name must be set",
+		},
+		{
+			name:    "duplicate name",
+			cfg:     ServerFileConfig{SPIRE: spire, Servers: []NamedServerSection{api, {Name: "api", ServerSection: admin.ServerSection}}},
+			wantErr: true,
+			errMsg:  `duplicate server name "api"`,
+		},
+		{
+			name: "entry without policy",
+			cfg: ServerFileConfig{SPIRE: spire, Servers: []NamedServerSection{
+				{Name: "admin", ServerSection: ServerSection{ListenAddr: ":9443"}},
+			}},
+			wantErr: true,
+			errMsg:  "servers[admin].allowed_client",
+		},
+		{
+			name: "shared listen address",
+			cfg: ServerFileConfig{
+				SPIRE:   spire,
+				Server:  ServerSection{ListenAddr: ":8443", AllowedClientTrustDomain: "corp"},
+				Servers: []NamedServerSection{api},
+			},
+			wantErr: true,
+			errMsg:  `servers[api].listen_addr ":8443" is already used by server`,
+		},
+		{
+			name: "health address equals listen address",
+			cfg: ServerFileConfig{
+				SPIRE:  spire,
+				Server: ServerSection{ListenAddr: ":8443", HealthListenAddr: ":8443", AllowedClientTrustDomain: "corp"},
+			},
+			wantErr: true,
+			errMsg:  "server.health_listen_addr must differ from server.listen_addr",
+		},
+		{
+			name: "ephemeral ports may repeat",
+			cfg: ServerFileConfig{SPIRE: spire, Servers: []NamedServerSection{
+				{Name: "a", ServerSection: ServerSection{ListenAddr: "localhost:0", AllowedClientTrustDomain: "corp"}},
+				{Name: "b", ServerSection: ServerSection{ListenAddr: "localhost:0", AllowedClientTrustDomain: "corp"}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ValidateServerConfig(&tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ValidateServerConfig() expected error containing %q, got nil", tt.errMsg)
+				}
+				if !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("ValidateServerConfig() error = %q, want error containing %q", err.Error(), tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateServerConfig() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseClientTransport(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport TransportSection
+		wantErr   bool
+		errMsg    string
+		want      ClientTransport
+	}{
+		{
+			name:      "defaults",
+			transport: TransportSection{},
+			want: ClientTransport{
+				DialTimeout:         DefaultDialTimeout,
+				KeepAlive:           DefaultKeepAlive,
+				TLSHandshakeTimeout: DefaultTLSHandshakeTimeout,
+				IdleConnTimeout:     DefaultIdleConnTimeout,
+				MaxIdleConns:        DefaultMaxIdleConns,
+				MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+			},
+		},
+		{
+			name: "explicit values",
+			transport: TransportSection{
+				Timeout:               "15s",
+				DialTimeout:           "2s",
+				KeepAlive:             "0s",
+				TLSHandshakeTimeout:   "3s",
+				ResponseHeaderTimeout: "5s",
+				IdleConnTimeout:       "1m",
+				MaxIdleConns:          50,
+				MaxIdleConnsPerHost:   10,
+				ForceHTTP2:            true,
+				ProxyFromEnvironment:  true,
+			},
+			want: ClientTransport{
+				Timeout:               15 * time.Second,
+				DialTimeout:           2 * time.Second,
+				KeepAlive:             0,
+				TLSHandshakeTimeout:   3 * time.Second,
+				ResponseHeaderTimeout: 5 * time.Second,
+				IdleConnTimeout:       time.Minute,
+				MaxIdleConns:          50,
+				MaxIdleConnsPerHost:   10,
+				ForceHTTP2:            true,
+				ProxyFromEnvironment:  true,
+			},
+		},
+		{
+			name:      "invalid timeout",
+			transport: TransportSection{Timeout: "soon"},
+			wantErr:   true,
+			errMsg:    "invalid client.transport.timeout",
+		},
+		{
+			name:      "negative dial timeout",
+			transport: TransportSection{DialTimeout: "-1s"},
+			wantErr:   true,
+			errMsg:    "client.transport.dial_timeout must not be negative",
+		},
+		{
+			name:      "negative idle pool",
+			transport: TransportSection{MaxIdleConnsPerHost: -1},
+			wantErr:   true,
+			errMsg:    "client.transport.max_idle_conns_per_host must not be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClientTransport(tt.transport)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseClientTransport() expected error containing %q, got nil", tt.errMsg)
+				}
+				if !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("ParseClientTransport() error = %q, want error containing %q", err.Error(), tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseClientTransport() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseClientTransport() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAuthorization(t *testing.T) {
+	ops := []string{"spiffe://example.org/ops"}
+	corp := []string{"example.org"}
+
+	tests := []struct {
+		name      string
+		rules     []AuthorizationRule
+		wantErr   bool
+		errMsg    string
+		wantRules int
+	}{
+		{
+			name:      "no rules",
+			wantRules: 0,
+		},
+		{
+			name: "specific before general",
+			rules: []AuthorizationRule{
+				{Path: "/admin", AllowedSPIFFEIDs: ops},
+				{Path: "/api", Methods: []string{"get", "HEAD"}, AllowedTrustDomains: corp},
+				{Path: "/api", Methods: []string{"POST"}, AllowedSPIFFEIDPatterns: []string{"spiffe://example.org/ns/{ns}/writer"}},
+				{Path: "/", AllowedSPIFFEIDs: ops},
+			},
+			wantRules: 4,
+		},
+		{
+			name: "sibling prefix is not covered",
+			rules: []AuthorizationRule{
+				{Path: "/admin", AllowedSPIFFEIDs: ops},
+				{Path: "/administrator", AllowedTrustDomains: corp},
+			},
+			wantRules: 2,
+		},
+		{
+			name: "general before specific is unreachable",
+			rules: []AuthorizationRule{
+				{Path: "/api", AllowedTrustDomains: corp},
+				{Path: "/api/admin", AllowedSPIFFEIDs: ops},
+			},
+			wantErr: true,
+			errMsg:  "server.authorization.rules[1] is unreachable: rules[0]",
+		},
+		{
+			name: "duplicate rule is unreachable",
+			rules: []AuthorizationRule{
+				{Path: "/api", Methods: []string{"GET", "POST"}, AllowedTrustDomains: corp},
+				{Path: "/api", Methods: []string{"post"}, AllowedSPIFFEIDs: ops},
+			},
+			wantErr: true,
+			errMsg:  "server.authorization.rules[1] is unreachable",
+		},
+		{
+			name: "partially shadowed methods overlap",
+			rules: []AuthorizationRule{
+				{Path: "/api", Methods: []string{"GET", "POST"}, AllowedTrustDomains: corp},
+				{Path: "/api/v1", Methods: []string{"POST", "DELETE"}, AllowedSPIFFEIDs: ops},
+			},
+			wantErr: true,
+			errMsg:  "server.authorization.rules[1] overlaps rules[0]",
+		},
+		{
+			name:    "relative path",
+			rules:   []AuthorizationRule{{Path: "admin", AllowedSPIFFEIDs: ops}},
+			wantErr: true,
+			errMsg:  `server.authorization.rules[0].path must start with "/"`,
+		},
+		{
+			name:    "unclean path",
+			rules:   []AuthorizationRule{{Path: "/api/../admin", AllowedSPIFFEIDs: ops}},
+			wantErr: true,
+			errMsg:  "must be a clean path",
+		},
+		{
+			name:    "nothing allowed",
+			rules:   []AuthorizationRule{{Path: "/admin"}},
+			wantErr: true,
+			errMsg:  "must set at least one of server.authorization.rules[0].allowed",
+		},
+		{
+			name:    "invalid allowed ID",
+			rules:   []AuthorizationRule{{Path: "/admin", AllowedSPIFFEIDs: []string{"ops"}}},
+			wantErr: true,
+			errMsg:  "invalid server.authorization.rules[0].allowed_spiffe_ids[0]",
+		},
+		{
+			name:    "invalid method",
+			rules:   []AuthorizationRule{{Path: "/admin", Methods: []string{" "}, AllowedSPIFFEIDs: ops}},
+			wantErr: true,
+			errMsg:  "invalid server.authorization.rules[0].methods[0]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseAuthorization(AuthorizationSection{Rules: tt.rules}, "server")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseAuthorization() expected error containing %q, got nil", tt.errMsg)
+				}
+				if !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("ParseAuthorization() error = %q, want error containing %q", err.Error(), tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAuthorization() unexpected error = %v", err)
+			}
+			if len(rules) != tt.wantRules {
+				t.Errorf("ParseAuthorization() returned %d rules, want %d", len(rules), tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestDestinationKey(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "billing.internal", want: "billing.internal"},
+		{in: "  Billing.Internal:8443 ", want: "billing.internal:8443"},
+		{in: "10.0.0.7:443", want: "10.0.0.7:443"},
+		{in: "[::1]:8443", want: "[::1]:8443"},
+		{in: "[::1]", want: "::1"},
+		{in: "::1", want: "::1"},
+		{in: "", wantErr: true},
+		{in: "https://billing.internal", wantErr: true},
+		{in: "billing.internal/api", wantErr: true},
+		{in: "billing.internal:https", wantErr: true},
+		{in: "billing.internal:0", wantErr: true},
+		{in: ":8443", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := DestinationKey(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DestinationKey(%q) = %q, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DestinationKey(%q) unexpected error = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("DestinationKey(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDenyList(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantErr     bool
+		errMsg      string
+		wantIDs     int
+		wantPattern int
+		wantField   string
+		wantSerial  string
+	}{
+		{
+			name: "empty file",
+			data: "",
+		},
+		{
+			name: "all entry kinds",
+			data: `spiffe_ids: ["spiffe://example.org/compromised"]
+spiffe_id_patterns: ["spiffe://example.org/ns/legacy/*"]
+serial_numbers: ["5C:3F:09"]
+`,
+			wantIDs:     1,
+			wantPattern: 1,
+			wantSerial:  "5c3f09",
+		},
+		{
+			name:       "serial number with 0x prefix",
+			data:       `serial_numbers: ["0x5c3f09"]`,
+			wantSerial: "5c3f09",
+		},
+		{
+			name:    "misspelled key",
+			data:    `spiffe_id: ["spiffe://example.org/compromised"]`,
+			wantErr: true,
+			errMsg:  "field spiffe_id not found",
+		},
+		{
+			name:    "invalid SPIFFE ID",
+			data:    `spiffe_ids: ["compromised"]`,
+			wantErr: true,
+			errMsg:  "invalid spiffe_ids[0]",
+		},
+		{
+			name:    "invalid SPIFFE ID after a blank entry",
+			data:    `spiffe_ids: ["", "compromised"]`,
+			wantErr: true,
+			errMsg:  "invalid spiffe_ids[1]",
+		},
+		{
+			// Pattern syntax is checked by package e5s
+			name:        "pattern after a blank entry",
+			data:        `spiffe_id_patterns: [" ", "spiffe://example.org/{ns"]`,
+			wantPattern: 1,
+			wantField:   "spiffe_id_patterns[1]",
+		},
+		{
+			name:    "serial number that is not hex",
+			data:    `serial_numbers: ["5g"]`,
+			wantErr: true,
+			errMsg:  "invalid serial_numbers[0]",
+		},
+		{
+			name:    "invalid serial number after a blank entry",
+			data:    `serial_numbers: ["5c3f09", "  ", "5g"]`,
+			wantErr: true,
+			errMsg:  "invalid serial_numbers[2]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseDenyList([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseDenyList() expected error containing %q, got nil", tt.errMsg)
+				}
+				if !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("ParseDenyList() error = %q, want error containing %q", err.Error(), tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDenyList() unexpected error = %v", err)
+			}
+			if len(entries.IDs) != tt.wantIDs || len(entries.IDPatterns) != tt.wantPattern {
+				t.Errorf("ParseDenyList() = %d IDs, %d patterns, want %d, %d", len(entries.IDs), len(entries.IDPatterns), tt.wantIDs, tt.wantPattern)
+			}
+			if tt.wantField != "" && entries.IDPatterns[0].Field != tt.wantField {
+				t.Errorf("ParseDenyList() pattern field = %q, want %q", entries.IDPatterns[0].Field, tt.wantField)
+			}
+			if tt.wantSerial != "" && (len(entries.SerialNumbers) != 1 || entries.SerialNumbers[0].Text(16) != tt.wantSerial) {
+				t.Errorf("ParseDenyList() serial numbers = %v, want [%s]", entries.SerialNumbers, tt.wantSerial)
+			}
+		})
+	}
+}
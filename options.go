@@ -0,0 +1,329 @@
+package e5s
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sufield/e5s/audit"
+	"github.com/sufield/e5s/internal/config"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// defaultReadHeaderTimeout bounds how long a client may take to send request
+// headers. It protects against Slowloris-style attacks.
+const defaultReadHeaderTimeout = 10 * time.Second
+
+// ServerOption customizes how Start, StartWithContext, StartWithConfig, Serve,
+// ServeContext and StartSingleThread build and run the mTLS server.
+//
+// Options never weaken the mTLS policy from the config file: identity
+// verification is always configured by e5s.
+type ServerOption func(*serverOptions)
+
+// serverOptions holds the result of applying ServerOptions.
+type serverOptions struct {
+	listener        net.Listener
+	httpServerHooks []func(*http.Server)
+	shutdownTimeout time.Duration // zero means use server.shutdown_timeout
+	connContext     func(ctx context.Context, c net.Conn) context.Context
+	readiness       *atomic.Bool
+	signals         []os.Signal
+	authorizer      spiffehttp.Authorizer
+	composition     spiffehttp.Composition
+	auditSink       audit.Sink
+	onHandshakeFail func(spiffehttp.HandshakeInfo)
+}
+
+// newServerOptions applies opts on top of the defaults.
+func newServerOptions(opts []ServerOption) *serverOptions {
+	o := &serverOptions{
+		signals: []os.Signal{os.Interrupt, syscall.SIGTERM},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// WithListener serves on ln instead of binding server.listen_addr.
+//
+// ln must be a plain TCP listener; e5s wraps it with TLS. This is useful for
+// socket activation, for listeners created by a supervisor, and for tests that
+// bind to "127.0.0.1:0" up front. When ln is set, server.listen_addr may be
+// omitted from the config.
+//
+// The server takes ownership of ln and closes it on shutdown.
+func WithListener(ln net.Listener) ServerOption {
+	return func(o *serverOptions) {
+		o.listener = ln
+	}
+}
+
+// WithHTTPServer registers a hook that can modify the *http.Server before it
+// starts serving.
+//
+// Hooks run after e5s has applied its defaults, so they can set ReadTimeout,
+// WriteTimeout, IdleTimeout, MaxHeaderBytes, ErrorLog and similar fields.
+// Multiple hooks run in the order they were given.
+//
+// Hooks may turn HTTP/2 off with Protocols or an empty TLSNextProto map; the
+// server then stops offering "h2" during the TLS handshake.
+//
+// Hooks must not replace TLSConfig or Handler; doing so bypasses SPIFFE
+// identity verification or peer extraction. A hook replacing ConnState should
+// call the previous value, which closes connections whose client is no longer
+// trusted.
+//
+// Example (long-polling endpoints):
+//
+//	e5s.WithHTTPServer(func(s *http.Server) {
+//	    s.ReadTimeout = 30 * time.Second
+//	    s.WriteTimeout = 0 // no limit for streaming responses
+//	    s.IdleTimeout = 2 * time.Minute
+//	    s.MaxHeaderBytes = 64 << 10
+//	})
+func WithHTTPServer(fn func(*http.Server)) ServerOption {
+	return func(o *serverOptions) {
+		if fn != nil {
+			o.httpServerHooks = append(o.httpServerHooks, fn)
+		}
+	}
+}
+
+// WithShutdownTimeout sets the total time Serve and ServeContext allow for a graceful
+// shutdown, overriding server.shutdown_timeout from the config.
+// Server.Shutdown uses the caller's context instead.
+//
+// Defaults to server.shutdown_timeout, or 5 seconds if that is not set.
+func WithShutdownTimeout(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		if d > 0 {
+			o.shutdownTimeout = d
+		}
+	}
+}
+
+// WithConnContext sets http.Server.ConnContext, which derives the base context
+// for each new connection.
+//
+// Use it to attach per-connection values (connection IDs, loggers, tracing
+// spans) that handlers read from r.Context(). fn runs after e5s has prepared
+// the context with spiffehttp.ConnContext and must derive from ctx, or the
+// peer is extracted on every request instead of once per connection.
+func WithConnContext(fn func(ctx context.Context, c net.Conn) context.Context) ServerOption {
+	return func(o *serverOptions) {
+		o.connContext = fn
+	}
+}
+
+// WithReadinessFlag keeps ready in sync with the server's ability to take
+// new traffic.
+//
+// e5s stores true once the listener is bound and false as soon as shutdown
+// begins, before the drain delay. Point your readiness probe at the flag so
+// load balancers stop routing to the instance while it drains:
+//
+//	var ready atomic.Bool
+//	srv, err := e5s.Start("e5s.yaml", handler, e5s.WithReadinessFlag(&ready))
+//	// in the probe handler: if !ready.Load() { w.WriteHeader(503) }
+func WithReadinessFlag(ready *atomic.Bool) ServerOption {
+	return func(o *serverOptions) {
+		o.readiness = ready
+	}
+}
+
+// WithSignals sets which OS signals make Serve and ServeContext shut down.
+//
+// The default is SIGINT and SIGTERM. Call WithSignals() with no arguments to
+// disable signal handling, for example when ServeContext runs inside an
+// errgroup and the process already has its own signal handling.
+//
+// Start, StartWithContext and StartWithConfig never handle signals.
+func WithSignals(sigs ...os.Signal) ServerOption {
+	return func(o *serverOptions) {
+		o.signals = sigs
+	}
+}
+
+// WithClientAuthorizer adds a custom handshake decision for clients, on top
+// of the allowed_client_* policy from the config.
+//
+// With spiffehttp.RequireBoth a client must pass both the config policy and
+// a; use it to narrow the policy, e.g. with time-of-day rules or certificate
+// extension checks. With spiffehttp.RequireEither a client passing either is
+// accepted; use it to admit identities approved elsewhere, e.g. by an
+// allowlist service.
+//
+//	e5s.Start("e5s.yaml", handler, e5s.WithClientAuthorizer(
+//	    func(id spiffeid.ID, chains [][]*x509.Certificate) error {
+//	        if allowlist.Contains(id) {
+//	            return nil
+//	        }
+//	        return fmt.Errorf("%s is not on the allowlist", id)
+//	    },
+//	    spiffehttp.RequireBoth,
+//	))
+//
+// Use spiffehttp.AllOf and spiffehttp.AnyOf to combine several authorizers.
+func WithClientAuthorizer(a spiffehttp.Authorizer, c spiffehttp.Composition) ServerOption {
+	return func(o *serverOptions) {
+		o.authorizer = a
+		o.composition = c
+	}
+}
+
+// WithAuditSink writes the server's audit events to sink, in addition to
+// any sinks configured in server.audit. Use it to ship events to a custom
+// destination, e.g. a message queue.
+//
+// The caller owns sink: e5s does not close it on shutdown. Write errors never
+// fail a request: the event is dropped, and the failure is logged once until
+// writes succeed again.
+func WithAuditSink(sink audit.Sink) ServerOption {
+	return func(o *serverOptions) {
+		o.auditSink = sink
+	}
+}
+
+// WithHandshakeFailureHandler calls fn for every client rejected during the
+// mTLS handshake, with the classified cause (info.Failure), the client's
+// address and its SPIFFE ID if it could be parsed. Use it to feed metrics or
+// alerting; rejections are counted in Server.Handshakes either way, and
+// logged at most once per cause every 10 seconds (every one when E5S_DEBUG is
+// set).
+//
+// fn runs during the handshake, so it must be fast and safe for concurrent
+// use.
+func WithHandshakeFailureHandler(fn func(info spiffehttp.HandshakeInfo)) ServerOption {
+	return func(o *serverOptions) {
+		o.onHandshakeFail = fn
+	}
+}
+
+// ClientOption customizes the HTTP client built by Client, ClientWithContext,
+// NewClient and Runtime.Client.
+//
+// Options override the matching client.transport settings from the config.
+// They never weaken server verification: the TLS configuration is always
+// built by e5s.
+type ClientOption func(*clientOptions)
+
+// clientOptions holds the result of applying ClientOptions.
+type clientOptions struct {
+	transport           []func(*config.ClientTransport)
+	authorizer          spiffehttp.Authorizer
+	composition         spiffehttp.Composition
+	serverPeerInContext bool
+}
+
+// newClientOptions applies opts on top of the defaults.
+func newClientOptions(opts []ClientOption) *clientOptions {
+	o := &clientOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// withTransport records an override of the parsed transport settings.
+func withTransport(fn func(*config.ClientTransport)) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = append(o.transport, fn)
+	}
+}
+
+// WithRequestTimeout bounds each request, including reading the response
+// body (http.Client.Timeout). Zero means no limit.
+// Overrides client.transport.timeout.
+func WithRequestTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *config.ClientTransport) { t.Timeout = d })
+}
+
+// WithDialTimeout bounds establishing the TCP connection.
+// Overrides client.transport.dial_timeout.
+func WithDialTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *config.ClientTransport) { t.DialTimeout = d })
+}
+
+// WithKeepAlive sets the interval between TCP keep-alive probes.
+// Overrides client.transport.keep_alive.
+func WithKeepAlive(d time.Duration) ClientOption {
+	return withTransport(func(t *config.ClientTransport) { t.KeepAlive = d })
+}
+
+// WithTLSHandshakeTimeout bounds the mTLS handshake.
+// Overrides client.transport.tls_handshake_timeout.
+func WithTLSHandshakeTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *config.ClientTransport) { t.TLSHandshakeTimeout = d })
+}
+
+// WithResponseHeaderTimeout bounds waiting for response headers after the
+// request has been written. Use it to fail fast on a stalled upstream
+// without limiting how long a streaming body may take.
+// Overrides client.transport.response_header_timeout.
+func WithResponseHeaderTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *config.ClientTransport) { t.ResponseHeaderTimeout = d })
+}
+
+// WithIdleConnTimeout sets how long an idle pooled connection is kept.
+// Overrides client.transport.idle_conn_timeout.
+func WithIdleConnTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *config.ClientTransport) { t.IdleConnTimeout = d })
+}
+
+// WithMaxIdleConnsPerHost limits idle pooled connections per host.
+// Overrides client.transport.max_idle_conns_per_host.
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return withTransport(func(t *config.ClientTransport) {
+		if n > 0 {
+			t.MaxIdleConnsPerHost = n
+		}
+	})
+}
+
+// WithForceHTTP2 negotiates HTTP/2 with servers that support it.
+// Overrides client.transport.force_http2.
+func WithForceHTTP2(enabled bool) ClientOption {
+	return withTransport(func(t *config.ClientTransport) { t.ForceHTTP2 = enabled })
+}
+
+// WithProxyFromEnvironment routes requests through the proxy named by the
+// HTTPS_PROXY and NO_PROXY environment variables.
+// Overrides client.transport.proxy_from_environment.
+func WithProxyFromEnvironment(enabled bool) ClientOption {
+	return withTransport(func(t *config.ClientTransport) { t.ProxyFromEnvironment = enabled })
+}
+
+// WithServerAuthorizer adds a custom handshake decision for servers, on top
+// of the expected_server_* policy from the config. c selects whether the
+// server must pass both (spiffehttp.RequireBoth) or either
+// (spiffehttp.RequireEither). See WithClientAuthorizer for the server-side
+// counterpart.
+func WithServerAuthorizer(a spiffehttp.Authorizer, c spiffehttp.Composition) ClientOption {
+	return func(o *clientOptions) {
+		o.authorizer = a
+		o.composition = c
+	}
+}
+
+// WithServerPeerInContext attaches the verified identity of the server that
+// answered each request, including its address, to the context of the
+// response's request (resp.Request), where e5s.ServerPeer finds it. Use it
+// for tracing and audit code that only sees the response.
+//
+// Without it, ServerPeer still reads the identity from resp.TLS, but cannot
+// report the server's address.
+func WithServerPeerInContext(enabled bool) ClientOption {
+	return func(o *clientOptions) {
+		o.serverPeerInContext = enabled
+	}
+}
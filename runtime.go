@@ -0,0 +1,302 @@
+package e5s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/sufield/e5s/internal/config"
+)
+
+// errRuntimeClosed is returned when a server or client is requested from a
+// Runtime that has already been closed.
+var errRuntimeClosed = errors.New("e5s runtime is closed")
+
+// Runtime owns a single SPIRE identity source and hands out mTLS servers and
+// clients that share it.
+//
+// Start() and Client() each open their own Workload API stream and keep their
+// own copy of every SVID and bundle. A process that serves mTLS and also calls
+// several upstreams should create one Runtime instead, so all of them rotate
+// from the same source.
+//
+// A Runtime reads the combined config format, with both a server and a client
+// section and optionally a list of named servers (see Config):
+//
+//	spire:
+//	  workload_socket: unix:///tmp/spire-agent/public/api.sock
+//	server:
+//	  listen_addr: ":8443"
+//	  allowed_client_trust_domain: "example.org"
+//	client:
+//	  expected_server_trust_domain: "example.org"
+//
+// Usage:
+//
+//	rt, err := e5s.New(ctx, "e5s.yaml")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer rt.Close()
+//
+//	srv, err := rt.Server("", handler)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	client, err := rt.Client()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// All methods are safe for concurrent use.
+type Runtime struct {
+	cfg            config.FileConfig
+	source         identitySource
+	sourceShutdown func() error
+
+	mu      sync.Mutex
+	closed  bool
+	servers []*Server
+	clients []*http.Client
+	// stops ends the background work of each client in clients
+	stops []func()
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// New loads a combined config file and connects to the SPIRE Workload API.
+//
+// Only the spire section and the "servers" list are validated here. The
+// unnamed server section and the client section are validated by
+// Runtime.Server() and Runtime.Client(), so a process that only runs clients
+// may omit the server section and vice versa.
+//
+// ctx is used for SPIRE initialization, like StartWithContext().
+func New(ctx context.Context, configPath string) (*Runtime, error) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	debugf("runtime config_path=%q", configPath)
+
+	return NewWithConfig(ctx, cfg)
+}
+
+// NewWithConfig is like New() but takes an in-memory configuration instead of
+// reading a YAML file.
+func NewWithConfig(ctx context.Context, cfg Config) (*Runtime, error) {
+	spireConfig, err := config.ValidateConfig(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	x509Source, sourceShutdown, err := newIdentitySource(ctx, cfg.SPIRE, cfg.Identity, spireConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runtime{
+		cfg:            cfg,
+		source:         x509Source,
+		sourceShutdown: sourceShutdown,
+	}, nil
+}
+
+// Server builds the mTLS server called name and starts it, like
+// StartWithConfig().
+//
+// name selects an entry of the "servers" list; "" selects the unnamed
+// "server" section. Each server enforces its own client policy.
+//
+// The server uses the runtime's SPIRE source. Shutting the server down does
+// not close the source; Runtime.Close() does that after all servers stop.
+func (r *Runtime) Server(name string, handler http.Handler, opts ...ServerOption) (*Server, error) {
+	o := newServerOptions(opts)
+
+	section, ok := r.cfg.ServerConfig().Section(name)
+	if !ok {
+		return nil, fmt.Errorf("no server named %q in config", name)
+	}
+	cfg := config.ServerFileConfig{Version: r.cfg.Version, SPIRE: r.cfg.SPIRE, Identity: r.cfg.Identity, Server: section}
+	if _, err := validateServerSection(&cfg, name, o); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, errRuntimeClosed
+	}
+
+	srv, err := newServer(context.Background(), cfg, config.SectionPath(name), r.source, func() error { return nil }, handler, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := srv.start(); err != nil {
+		return nil, err
+	}
+
+	debugf("runtime server name=%q addr=%q", name, srv.Addr().String())
+
+	r.servers = append(r.servers, srv)
+	return srv, nil
+}
+
+// Client builds an mTLS HTTP client from the client section, like NewClient().
+//
+// The client uses the runtime's SPIRE source and has no cleanup function of
+// its own; Runtime.Close() closes its idle connections.
+func (r *Runtime) Client(opts ...ClientOption) (*http.Client, error) {
+	cfg := r.cfg.ClientConfig()
+	if _, err := validateClientConfig(&cfg); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, errRuntimeClosed
+	}
+
+	client, stop, err := newClient(context.Background(), cfg, r.source, newClientOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	r.clients = append(r.clients, client)
+	r.stops = append(r.stops, stop)
+	return client, nil
+}
+
+// Close tears down everything the runtime handed out, in dependency order:
+//  1. All servers are drained concurrently, each bounded by its shutdown
+//     timeout (see Server.Shutdown)
+//  2. Idle connections of all clients are closed
+//  3. The SPIRE source is closed, once nothing uses it any more
+//
+// Servers that were already shut down are skipped. After Close, Server() and
+// Client() return an error.
+//
+// Close is idempotent: subsequent calls return the result of the first one.
+func (r *Runtime) Close() error {
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		servers, clients, stops := r.servers, r.clients, r.stops
+		r.servers, r.clients, r.stops = nil, nil, nil
+		r.mu.Unlock()
+
+		errs := make([]error, len(servers))
+		var wg sync.WaitGroup
+		for i, srv := range servers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = srv.shutdownWithTimeout()
+			}()
+		}
+		wg.Wait()
+
+		for i, client := range clients {
+			stops[i]()
+			client.CloseIdleConnections()
+		}
+
+		r.closeErr = firstErr(append(errs, r.sourceShutdown())...)
+	})
+	return r.closeErr
+}
+
+// ServeMulti runs every server of a config file from one SPIRE source and
+// blocks until ctx is done, a handled signal arrives, or any server fails.
+//
+// The file uses the combined format read by New(). Each configured server
+// (the unnamed "server" section as "", plus every "servers" entry by name)
+// is bound to the handler with the same key in handlers. Every server needs
+// a handler, and every handler must name a configured server.
+//
+// Example config with a public port and an admin-only port:
+//
+//	spire:
+//	  workload_socket: unix:///tmp/spire-agent/public/api.sock
+//	servers:
+//	  - name: api
+//	    listen_addr: ":8443"
+//	    allowed_client_trust_domain: "corp"
+//	  - name: admin
+//	    listen_addr: ":9443"
+//	    allowed_client_spiffe_id: "spiffe://corp/ops/admin"
+//
+// Usage:
+//
+//	err := e5s.ServeMulti(ctx, "e5s.yaml", map[string]http.Handler{
+//	    "api":   apiRouter,
+//	    "admin": adminRouter,
+//	})
+//
+// opts apply to every server, so WithListener cannot be used. Signals are
+// handled as in ServeContext(). On stop, all servers drain concurrently and
+// the SPIRE source is closed once they are done.
+func ServeMulti(ctx context.Context, configPath string, handlers map[string]http.Handler, opts ...ServerOption) error {
+	o := newServerOptions(opts)
+	if o.listener != nil {
+		return errors.New("WithListener cannot be used with ServeMulti")
+	}
+
+	rt, err := New(ctx, configPath)
+	if err != nil {
+		return err
+	}
+
+	names := rt.cfg.ServerConfig().SectionNames()
+	if err := checkHandlers(names, handlers); err != nil {
+		return errors.Join(err, rt.Close())
+	}
+
+	exited := make(chan error, len(names))
+	for _, name := range names {
+		srv, err := rt.Server(name, handlers[name], opts...)
+		if err != nil {
+			return errors.Join(fmt.Errorf("server %q: %w", name, err), rt.Close())
+		}
+		go func() {
+			if err := <-srv.Done(); err != nil {
+				exited <- fmt.Errorf("server %q exited with error: %w", name, err)
+			}
+		}()
+	}
+
+	serveErr := waitForStop(ctx, o, exited)
+
+	if closeErr := rt.Close(); closeErr != nil {
+		if serveErr != nil {
+			return fmt.Errorf("%w (shutdown error: %v)", serveErr, closeErr)
+		}
+		return fmt.Errorf("shutdown failed: %w", closeErr)
+	}
+	return serveErr
+}
+
+// checkHandlers verifies that handlers binds exactly the configured servers.
+func checkHandlers(names []string, handlers map[string]http.Handler) error {
+	if len(names) == 0 {
+		return errors.New("invalid server config: no servers configured")
+	}
+	configured := make(map[string]bool, len(names))
+	for _, name := range names {
+		configured[name] = true
+		if handlers[name] == nil {
+			return fmt.Errorf("no handler for server %q", name)
+		}
+	}
+	for name := range handlers {
+		if !configured[name] {
+			return fmt.Errorf("handler for unknown server %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package e5s
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sufield/e5s/internal/config"
+)
+
+func TestRuntimeServer_ReportsSectionPath(t *testing.T) {
+	valid := config.ServerSection{ListenAddr: "127.0.0.1:0", AllowedClientTrustDomain: "example.org"}
+	withMaxAge := func(s config.ServerSection, age string) config.ServerSection {
+		s.MaxConnectionAge = age
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		server  string
+		cfg     config.FileConfig
+		wantErr string
+	}{
+		{
+			name:   "named section",
+			server: "api",
+			cfg: config.FileConfig{Servers: []config.NamedServerSection{
+				{Name: "admin", ServerSection: valid},
+				{Name: "api", ServerSection: withMaxAge(valid, "-1h")},
+			}},
+			wantErr: "servers[api].max_connection_age",
+		},
+		{
+			name:   "named section without listen address",
+			server: "admin",
+			cfg: config.FileConfig{Servers: []config.NamedServerSection{
+				{Name: "admin", ServerSection: config.ServerSection{AllowedClientTrustDomain: "example.org"}},
+			}},
+			wantErr: "servers[admin].listen_addr must be set",
+		},
+		{
+			name:    "unnamed section",
+			server:  "",
+			cfg:     config.FileConfig{Server: withMaxAge(valid, "soon")},
+			wantErr: "server.max_connection_age",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.SPIRE = config.SPIRESection{WorkloadSocket: "unix:///tmp/agent.sock"}
+			r := &Runtime{cfg: tt.cfg, source: &fakeSource{}}
+
+			_, err := r.Server(tt.server, http.NotFoundHandler())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Server(%q) error = %v, want error containing %q", tt.server, err, tt.wantErr)
+			}
+			if tt.server == "" && strings.Contains(err.Error(), "servers[") {
+				t.Errorf("Server(%q) error = %v, names a servers entry", tt.server, err)
+			}
+		})
+	}
+}
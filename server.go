@@ -0,0 +1,215 @@
+package e5s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/sufield/e5s/internal/config"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// Server is a running e5s mTLS server.
+//
+// A Server is returned by Start, StartWithContext and StartWithConfig once
+// its listener is bound and it is accepting connections. Use it to learn the
+// bound address, wait for the server to exit, and shut it down.
+//
+// All methods are safe for concurrent use.
+type Server struct {
+	httpServer       *http.Server
+	source           identitySource
+	identityShutdown func() error
+	opts             *serverOptions
+	shutdown         config.ServerShutdown
+	requests         *requestTracker
+	healthAddr       string
+	handshakes       *spiffehttp.HandshakeStats
+	conns            *connTracker
+	denyList         *denyListWatcher
+
+	listener       net.Listener
+	healthListener net.Listener
+	healthServer   *http.Server
+	done           chan error
+	draining       atomic.Bool
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// listen binds the server's listener, or adopts the one given via WithListener,
+// and starts the health endpoints if server.health_listen_addr is set.
+//
+// On failure the SPIRE source is released, since the server can never run.
+func (s *Server) listen() error {
+	ln := s.opts.listener
+	if ln == nil {
+		var err error
+		ln, err = net.Listen("tcp", s.httpServer.Addr)
+		if err != nil {
+			return s.startupFailed(err)
+		}
+	}
+	s.listener = ln
+	if err := s.listenHealth(); err != nil {
+		_ = ln.Close()
+		return s.startupFailed(err)
+	}
+	s.done = make(chan error, 1)
+	if s.opts.readiness != nil {
+		s.opts.readiness.Store(true)
+	}
+
+	debugf("server bound addr=%q", ln.Addr().String())
+	return nil
+}
+
+// startupFailed releases the SPIRE source after a failed bind and wraps err.
+func (s *Server) startupFailed(err error) error {
+	if shutdownErr := s.identityShutdown(); shutdownErr != nil {
+		return fmt.Errorf("server startup failed: %w (cleanup error: %v)", err, shutdownErr)
+	}
+	return fmt.Errorf("server startup failed: %w", err)
+}
+
+// serve runs the HTTP server on the bound listener until it stops.
+//
+// It returns nil when the server was stopped by Shutdown, otherwise the
+// error that made it exit. The result is also delivered on Done().
+func (s *Server) serve() error {
+	err := s.httpServer.ServeTLS(s.listener, "", "")
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	s.done <- err
+	close(s.done)
+	return err
+}
+
+// start binds the listener synchronously and serves in the background.
+func (s *Server) start() error {
+	if err := s.listen(); err != nil {
+		return err
+	}
+	go func() {
+		_ = s.serve()
+	}()
+	return nil
+}
+
+// Addr returns the address the server is listening on.
+//
+// When listen_addr uses port 0 (for example "127.0.0.1:0"), Addr reports the
+// port chosen by the operating system.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Done returns a channel that receives the server's exit error and is then closed.
+//
+// The value is nil if the server was stopped by Shutdown, or the error that
+// made it stop serving otherwise (for example, the listener failed). Only the
+// first receive gets the value; later receives see the closed channel.
+//
+// Usage:
+//
+//	select {
+//	case err := <-srv.Done():
+//	    log.Printf("server exited: %v", err)
+//	case <-ctx.Done():
+//	    srv.Shutdown(context.Background())
+//	}
+func (s *Server) Done() <-chan error {
+	return s.done
+}
+
+// Handshakes returns how many clients the server accepted and rejected
+// during the mTLS handshake, with rejections counted by cause.
+//
+// Usage:
+//
+//	counts := srv.Handshakes()
+//	expired := counts.Failures[spiffehttp.FailureExpired]
+func (s *Server) Handshakes() spiffehttp.HandshakeCounts {
+	return s.handshakes.Counts()
+}
+
+// Identity returns the server's own SPIFFE ID from its current X.509 SVID.
+//
+// Returns an error once the server has been shut down, because the SPIRE
+// source is closed at that point.
+func (s *Server) Identity() (spiffeid.ID, error) {
+	svid, err := s.source.GetX509SVID()
+	if err != nil {
+		return spiffeid.ID{}, fmt.Errorf("failed to get server SVID: %w", err)
+	}
+	return svid.ID, nil
+}
+
+// Shutdown gracefully drains the server and releases its SPIRE resources.
+//
+// The drain runs in this order:
+//  1. Readiness is withdrawn (see WithReadinessFlag, Ready and /readyz)
+//  2. The server keeps serving for server.drain_delay, so load balancers and
+//     Kubernetes endpoints can stop routing new traffic to it
+//  3. The listener is closed and idle connections are shut down
+//  4. Shutdown waits for in-flight requests to finish, including handlers
+//     running on hijacked or streaming connections
+//  5. The health endpoints stop, then the SPIRE identity source is closed
+//     last, so in-flight requests keep a valid identity until they are done
+//
+// ctx bounds the whole drain, including the drain delay. If ctx is done
+// before in-flight requests finish, remaining connections are closed
+// forcibly and ctx's error is returned.
+//
+// Shutdown is idempotent: subsequent calls return the result of the first one.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.drain(ctx)
+	})
+	return s.shutdownErr
+}
+
+// drain implements the Shutdown sequence.
+func (s *Server) drain(ctx context.Context) error {
+	s.draining.Store(true)
+	if s.opts.readiness != nil {
+		s.opts.readiness.Store(false)
+	}
+	debugf("server draining drain_delay=%v", s.shutdown.DrainDelay)
+
+	if delay := s.shutdown.DrainDelay; delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
+	err := s.httpServer.Shutdown(ctx)
+	if err == nil {
+		err = s.requests.wait(ctx)
+	}
+	if err != nil {
+		// Deadline reached with requests still running: stop waiting for them
+		_ = s.httpServer.Close()
+	}
+
+	return firstErr(err, s.closeHealth(), s.identityShutdown())
+}
+
+// shutdownWithTimeout calls Shutdown bounded by server.shutdown_timeout
+// (or the WithShutdownTimeout override).
+func (s *Server) shutdownWithTimeout() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdown.Timeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
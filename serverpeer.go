@@ -0,0 +1,65 @@
+package e5s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptrace"
+
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// context key type (unexported) to avoid collisions with keys from other packages.
+type serverPeerCtxKey struct{}
+
+var serverPeerKey = serverPeerCtxKey{}
+
+// ServerPeer returns the verified identity of the server that answered a
+// request sent by an e5s client.
+//
+// If the client was built with WithServerPeerInContext, the peer attached to
+// resp.Request's context is returned, including the server's address.
+// Otherwise it is read from resp.TLS, without RemoteAddr. Returns false for a
+// response that did not come over mTLS.
+//
+// Usage:
+//
+//	resp, err := client.Get("https://billing.internal:8443/invoices")
+//	if err != nil {
+//	    return err
+//	}
+//	defer resp.Body.Close()
+//	if server, ok := e5s.ServerPeer(resp); ok {
+//	    log.Printf("answered by %s at %s", server.ID, server.RemoteAddr)
+//	}
+func ServerPeer(resp *http.Response) (spiffehttp.Peer, bool) {
+	if resp == nil {
+		return spiffehttp.Peer{}, false
+	}
+	if resp.Request != nil {
+		if peer, ok := resp.Request.Context().Value(serverPeerKey).(spiffehttp.Peer); ok {
+			return peer, true
+		}
+	}
+	return spiffehttp.PeerFromResponse(resp)
+}
+
+// roundTripWithPeer sends req over rt and attaches the server's peer, with
+// its address, to the context of the response's request.
+func roundTripWithPeer(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+	// GotConn runs before RoundTrip returns, so remoteAddr needs no locking
+	var remoteAddr string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			remoteAddr = info.Conn.RemoteAddr().String()
+		},
+	}
+	resp, err := rt.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return resp, err
+	}
+	if peer, ok := spiffehttp.PeerFromResponse(resp); ok {
+		peer.RemoteAddr = remoteAddr
+		resp.Request = req.WithContext(context.WithValue(req.Context(), serverPeerKey, peer))
+	}
+	return resp, nil
+}
@@ -0,0 +1,103 @@
+package spiffehttp
+
+import (
+	"crypto/x509"
+	"errors"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+)
+
+// Authorizer decides whether a peer may complete the mTLS handshake.
+//
+// It receives the peer's SPIFFE ID and the certificate chains that were
+// already verified against the trust bundle, and returns nil to accept the
+// peer. Use it for decisions the string policies cannot express: consulting
+// an allowlist, checking certificate extensions, time-of-day rules.
+//
+// Authorizer is the go-spiffe tlsconfig.Authorizer type, so SDK helpers such
+// as tlsconfig.AuthorizeID can be used directly.
+//
+// Authorizers run on every handshake and must be safe for concurrent use.
+// Keep them fast: a slow Authorizer delays every new connection.
+type Authorizer = tlsconfig.Authorizer
+
+// Composition selects how a custom Authorizer is combined with the ID, trust
+// domain and pattern policy of a ServerConfig or ClientConfig.
+type Composition int
+
+const (
+	// RequireBoth accepts a peer only if both the policy and the Authorizer
+	// accept it. This is the default: a custom Authorizer can only narrow
+	// the configured policy.
+	RequireBoth Composition = iota
+
+	// RequireEither accepts a peer if the policy or the Authorizer accepts
+	// it. Use it to admit peers the static policy does not list, for
+	// example identities approved by an allowlist service.
+	RequireEither
+)
+
+// AllOf returns an Authorizer that accepts a peer only if every non-nil
+// authorizer accepts it. Authorizers run in order and the first rejection is
+// returned. With no non-nil authorizers, every peer is rejected.
+func AllOf(authorizers ...Authorizer) Authorizer {
+	authorizers = nonNil(authorizers)
+	return func(id spiffeid.ID, verifiedChains [][]*x509.Certificate) error {
+		if len(authorizers) == 0 {
+			return errors.New("no authorizers configured")
+		}
+		for _, a := range authorizers {
+			if err := a(id, verifiedChains); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AnyOf returns an Authorizer that accepts a peer if any non-nil authorizer
+// accepts it. Authorizers run in order until one accepts; if none does, all
+// rejections are returned joined. With no non-nil authorizers, every peer is
+// rejected.
+func AnyOf(authorizers ...Authorizer) Authorizer {
+	authorizers = nonNil(authorizers)
+	return func(id spiffeid.ID, verifiedChains [][]*x509.Certificate) error {
+		if len(authorizers) == 0 {
+			return errors.New("no authorizers configured")
+		}
+		errs := make([]error, 0, len(authorizers))
+		for _, a := range authorizers {
+			err := a(id, verifiedChains)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// nonNil returns the non-nil authorizers, in order.
+func nonNil(authorizers []Authorizer) []Authorizer {
+	out := make([]Authorizer, 0, len(authorizers))
+	for _, a := range authorizers {
+		if a != nil {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// compose combines the policy authorizer with a custom one. A nil custom
+// authorizer leaves the policy unchanged.
+func compose(policy, custom Authorizer, c Composition) Authorizer {
+	switch {
+	case custom == nil:
+		return policy
+	case c == RequireEither:
+		return AnyOf(policy, custom)
+	default:
+		return AllOf(policy, custom)
+	}
+}
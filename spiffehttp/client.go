@@ -4,29 +4,60 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
-	"fmt"
 
 	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
-	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
 	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 )
 
 // ClientConfig configures an mTLS client's server verification policy.
 //
-// Exactly one of ExpectedServerID or ExpectedServerTrustDomain must be set.
+// At least one expected server ID, trust domain or ID pattern, or an
+// Authorizer, must be set. The server is accepted if it matches any of the
+// policy entries, combined with Authorizer as AuthorizerComposition says.
 type ClientConfig struct {
 	// ExpectedServerID is the exact SPIFFE ID the client expects from the server.
 	// Example: "spiffe://example.org/api"
-	//
-	// Mutually exclusive with ExpectedServerTrustDomain.
 	ExpectedServerID string
 
+	// ExpectedServerIDs accepts servers presenting any of these exact SPIFFE IDs.
+	// Combined with ExpectedServerID.
+	ExpectedServerIDs []string
+
 	// ExpectedServerTrustDomain accepts any server in the specified trust domain.
 	// Example: "example.org"
-	//
-	// Mutually exclusive with ExpectedServerID.
 	ExpectedServerTrustDomain string
+
+	// ExpectedServerTrustDomains accepts any server in any of these trust domains.
+	// Combined with ExpectedServerTrustDomain.
+	ExpectedServerTrustDomains []string
+
+	// ExpectedServerIDPatterns accepts servers whose SPIFFE ID matches any of
+	// these patterns (see IDPattern).
+	// Example: "spiffe://example.org/ns/*/sa/api"
+	ExpectedServerIDPatterns []string
+
+	// Authorizer is an optional custom decision, combined with the policy
+	// above as AuthorizerComposition says. If no policy entry is set, it is
+	// the only check.
+	Authorizer Authorizer
+
+	// AuthorizerComposition selects how Authorizer is combined with the
+	// policy. Defaults to RequireBoth.
+	AuthorizerComposition Composition
+
+	// DenyList optionally rejects servers before any other check. A denied
+	// server is rejected even if the policy or Authorizer would accept it.
+	DenyList *DenyList
+}
+
+// policy parses the expected server settings into a peer policy.
+func (cfg ClientConfig) policy() (*peerPolicy, error) {
+	return newPeerPolicy(
+		policyEntries(cfg.ExpectedServerID, "ExpectedServerID", cfg.ExpectedServerIDs, "ExpectedServerIDs"),
+		policyEntries(cfg.ExpectedServerTrustDomain, "ExpectedServerTrustDomain", cfg.ExpectedServerTrustDomains, "ExpectedServerTrustDomains"),
+		policyEntries("", "", cfg.ExpectedServerIDPatterns, "ExpectedServerIDPatterns"),
+	)
 }
 
 // NewClientTLSConfig creates a TLS configuration for an mTLS client.
@@ -40,9 +71,20 @@ type ClientConfig struct {
 //   - Verifies server identity according to cfg policy
 //   - Supports automatic certificate rotation via the source
 //
-// Server verification policy (exactly one must be configured):
-//  1. cfg.ExpectedServerID: require exact SPIFFE ID match
-//  2. cfg.ExpectedServerTrustDomain: require server's SPIFFE ID to be in that trust domain
+// Server verification policy (at least one entry, or cfg.Authorizer, must be
+// configured; the server is accepted if it matches any entry):
+//  1. cfg.ExpectedServerID / ExpectedServerIDs: exact SPIFFE ID match
+//  2. cfg.ExpectedServerTrustDomain / ExpectedServerTrustDomains: server's
+//     SPIFFE ID is in one of those trust domains
+//  3. cfg.ExpectedServerIDPatterns: server's SPIFFE ID matches one of the
+//     patterns
+//
+// If cfg.Authorizer is set, it is combined with the policy: with RequireBoth
+// the server must also pass the Authorizer, with RequireEither passing the
+// Authorizer alone is enough. Without policy entries the Authorizer decides
+// on its own.
+//
+// If cfg.DenyList is set, a server it denies is rejected in every case.
 //
 // The svidSource and bundleSource parameters must not be nil. They provide:
 //   - Client's identity certificate (fetched dynamically at dial time)
@@ -75,20 +117,24 @@ type ClientConfig struct {
 //
 // Returns error if:
 //   - svidSource or bundleSource is nil
-//   - Neither ExpectedServerID nor ExpectedServerTrustDomain is set
-//   - Both ExpectedServerID and ExpectedServerTrustDomain are set
-//   - ExpectedServerID is invalid SPIFFE ID format
+//   - No expected server ID, trust domain, ID pattern or Authorizer is set
+//   - An expected server ID, trust domain or ID pattern is malformed
 func NewClientTLSConfig(ctx context.Context, svidSource x509svid.Source, bundleSource x509bundle.Source, cfg ClientConfig) (*tls.Config, error) {
 	if err := validateClientInputs(ctx, svidSource, bundleSource, cfg); err != nil {
 		return nil, err
 	}
 
-	authorizer, err := buildClientAuthorizer(cfg)
+	policy, err := cfg.policy()
 	if err != nil {
 		return nil, err
 	}
 
-	tlsCfg := tlsconfig.MTLSClientConfig(svidSource, bundleSource, authorizer)
+	authorizer := cfg.Authorizer
+	if !policy.empty() {
+		authorizer = compose(policy.authorizer(), cfg.Authorizer, cfg.AuthorizerComposition)
+	}
+
+	tlsCfg := tlsconfig.MTLSClientConfig(svidSource, bundleSource, withDenyList(cfg.DenyList, authorizer))
 	tlsCfg.MinVersion = tls.VersionTLS13
 
 	return tlsCfg, nil
@@ -102,49 +148,16 @@ func validateClientInputs(ctx context.Context, svidSource x509svid.Source, bundl
 		return errors.New("svidSource cannot be nil")
 	case bundleSource == nil:
 		return errors.New("bundleSource cannot be nil")
-	case cfg.ExpectedServerID == "" && cfg.ExpectedServerTrustDomain == "":
-		return errors.New("either ExpectedServerID or ExpectedServerTrustDomain must be set")
-	case cfg.ExpectedServerID != "" && cfg.ExpectedServerTrustDomain != "":
-		return errors.New("ExpectedServerID and ExpectedServerTrustDomain are mutually exclusive")
 	}
 
-	// Validate SPIFFE ID format
-	if cfg.ExpectedServerID != "" {
-		if _, err := spiffeid.FromString(cfg.ExpectedServerID); err != nil {
-			return fmt.Errorf("invalid ExpectedServerID: %w", err)
-		}
+	// Validate SPIFFE ID and trust domain formats
+	policy, err := cfg.policy()
+	if err != nil {
+		return err
 	}
-
-	// Validate trust domain format
-	if cfg.ExpectedServerTrustDomain != "" {
-		if _, err := spiffeid.TrustDomainFromString(cfg.ExpectedServerTrustDomain); err != nil {
-			return fmt.Errorf("invalid ExpectedServerTrustDomain: %w", err)
-		}
+	if policy.empty() && cfg.Authorizer == nil {
+		return errors.New("at least one expected server ID, trust domain or ID pattern, or an Authorizer, must be set")
 	}
 
 	return nil
 }
-
-func buildClientAuthorizer(cfg ClientConfig) (tlsconfig.Authorizer, error) {
-	switch {
-	case cfg.ExpectedServerID != "":
-		// Policy 1: Exact SPIFFE ID match
-		id, err := spiffeid.FromString(cfg.ExpectedServerID)
-		if err != nil {
-			return nil, fmt.Errorf("invalid ExpectedServerID: %w", err)
-		}
-		return tlsconfig.AuthorizeID(id), nil
-
-	case cfg.ExpectedServerTrustDomain != "":
-		// Policy 2: Trust domain match
-		td, err := spiffeid.TrustDomainFromString(cfg.ExpectedServerTrustDomain)
-		if err != nil {
-			return nil, fmt.Errorf("invalid ExpectedServerTrustDomain: %w", err)
-		}
-		return tlsconfig.AuthorizeMemberOf(td), nil
-
-	default:
-		// Should never reach here due to config validation
-		return nil, errors.New("no server verification policy configured (internal misconfiguration)")
-	}
-}
@@ -0,0 +1,124 @@
+package spiffehttp
+
+import (
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// DenyEntries is the content of a DenyList.
+type DenyEntries struct {
+	// IDs rejects peers with these exact SPIFFE IDs.
+	IDs []spiffeid.ID
+
+	// IDPatterns rejects peers whose SPIFFE ID matches any of these patterns.
+	IDPatterns []*IDPattern
+
+	// SerialNumbers rejects peers whose leaf certificate (the X.509 SVID)
+	// has one of these serial numbers, e.g. a single leaked SVID while the
+	// workload's re-issued SVIDs stay trusted.
+	SerialNumbers []*big.Int
+}
+
+// DenyList rejects peers by SPIFFE ID, ID pattern or SVID serial number,
+// regardless of any policy that would allow them.
+//
+// SPIFFE has no certificate revocation: a compromised workload stays trusted
+// until its SVID expires. A DenyList cuts it off at the next handshake. Set it
+// on ServerConfig.DenyList or ClientConfig.DenyList, and call Set to change
+// its entries while servers and clients keep running.
+//
+// The zero value is not usable; create one with NewDenyList. A DenyList is
+// safe for concurrent use.
+type DenyList struct {
+	entries atomic.Pointer[denyIndex]
+}
+
+// denyIndex is an immutable, indexed snapshot of DenyEntries.
+type denyIndex struct {
+	ids      map[spiffeid.ID]struct{}
+	patterns []*IDPattern
+	serials  map[string]struct{}
+	count    DenyCounts
+}
+
+// DenyCounts is the number of entries of each kind in a DenyList.
+type DenyCounts struct {
+	IDs           int
+	IDPatterns    int
+	SerialNumbers int
+}
+
+// NewDenyList returns a DenyList with the given entries.
+func NewDenyList(entries DenyEntries) *DenyList {
+	d := &DenyList{}
+	d.Set(entries)
+	return d
+}
+
+// Set atomically replaces the entries. Handshakes and checks that start after
+// Set returns use the new entries.
+func (d *DenyList) Set(entries DenyEntries) {
+	idx := &denyIndex{
+		ids:      make(map[spiffeid.ID]struct{}, len(entries.IDs)),
+		patterns: append([]*IDPattern(nil), entries.IDPatterns...),
+		serials:  make(map[string]struct{}, len(entries.SerialNumbers)),
+	}
+	for _, id := range entries.IDs {
+		idx.ids[id] = struct{}{}
+	}
+	for _, serial := range entries.SerialNumbers {
+		if serial != nil {
+			idx.serials[serial.String()] = struct{}{}
+		}
+	}
+	idx.count = DenyCounts{IDs: len(idx.ids), IDPatterns: len(idx.patterns), SerialNumbers: len(idx.serials)}
+	d.entries.Store(idx)
+}
+
+// Counts returns the number of entries of each kind.
+func (d *DenyList) Counts() DenyCounts {
+	return d.entries.Load().count
+}
+
+// Authorize returns an error if the peer is denied. It has the Authorizer
+// signature, so d.Authorize can be used wherever an Authorizer is expected.
+//
+// The serial number is checked on the leaf certificate of each verified
+// chain. Serial numbers are only unique per issuer, so list the serial
+// numbers of SVIDs issued by your own trust domains.
+func (d *DenyList) Authorize(id spiffeid.ID, verifiedChains [][]*x509.Certificate) error {
+	idx := d.entries.Load()
+	if _, ok := idx.ids[id]; ok {
+		return fmt.Errorf("SPIFFE ID %q is denied", id)
+	}
+	for _, p := range idx.patterns {
+		if _, ok := p.Match(id); ok {
+			return fmt.Errorf("SPIFFE ID %q is denied by pattern %q", id, p)
+		}
+	}
+	if len(idx.serials) > 0 {
+		for _, chain := range verifiedChains {
+			if len(chain) == 0 || chain[0].SerialNumber == nil {
+				continue
+			}
+			if _, ok := idx.serials[chain[0].SerialNumber.String()]; ok {
+				return fmt.Errorf("certificate serial number %x of %q is denied", chain[0].SerialNumber, id)
+			}
+		}
+	}
+	return nil
+}
+
+// withDenyList puts d in front of authorizer, so a denied peer is rejected
+// whatever the policy and its composition allow. A nil d leaves authorizer
+// unchanged.
+func withDenyList(d *DenyList, authorizer Authorizer) Authorizer {
+	if d == nil {
+		return authorizer
+	}
+	return AllOf(d.Authorize, authorizer)
+}
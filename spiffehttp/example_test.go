@@ -3,11 +3,17 @@ package spiffehttp_test
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
 	"github.com/spiffe/go-spiffe/v2/workloadapi"
 	"github.com/sufield/e5s/spiffehttp"
 )
@@ -112,6 +118,44 @@ func ExampleNewServerTLSConfig_trustDomain() {
 	_ = server // Use server
 }
 
+// ExampleNewServerTLSConfig_multipleClients demonstrates allowing several
+// callers: a client is accepted if it matches any listed ID or trust domain.
+//
+// This example requires a running SPIRE agent.
+func ExampleNewServerTLSConfig_multipleClients() {
+	ctx := context.Background()
+
+	source, err := workloadapi.NewX509Source(ctx)
+	if err != nil {
+		log.Fatalf("Unable to create X509Source: %v", err)
+	}
+
+	// Accept two specific callers plus anyone from the partner trust domain
+	tlsConfig, err := spiffehttp.NewServerTLSConfig(
+		ctx,
+		source,
+		source,
+		spiffehttp.ServerConfig{
+			AllowedClientIDs: []string{
+				"spiffe://example.org/frontend",
+				"spiffe://example.org/batch",
+			},
+			AllowedClientTrustDomains: []string{"partner.example.org"},
+		},
+	)
+	if err != nil {
+		source.Close() // Clean up before exiting
+		log.Fatalf("Unable to create TLS config: %v", err)
+	}
+	defer source.Close()
+
+	server := &http.Server{
+		Addr:      ":8443",
+		TLSConfig: tlsConfig,
+	}
+	_ = server // Use server
+}
+
 // ExampleNewClientTLSConfig demonstrates creating a client TLS configuration
 // that verifies the server's SPIFFE identity.
 //
@@ -216,6 +260,97 @@ func ExamplePeerFromRequest() {
 	_ = handler // Use handler in server
 }
 
+// ExamplePeerFromRequest_connectionDetails shows the certificate and
+// connection details available for audit logs and policy.
+func ExamplePeerFromRequest_connectionDetails() {
+	// Normally set by the TLS handshake
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.org/", nil)
+	r.TLS = &tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		NegotiatedProtocol: "h2",
+		PeerCertificates: []*x509.Certificate{{
+			URIs:               []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/api-client"}},
+			SerialNumber:       big.NewInt(0x5c3f),
+			PublicKeyAlgorithm: x509.ECDSA,
+		}},
+	}
+
+	peer, ok := spiffehttp.PeerFromRequest(r)
+	if !ok {
+		return
+	}
+	fmt.Println("id:", peer.ID)
+	fmt.Printf("serial: %x\n", peer.SerialNumber)
+	fmt.Println("key:", peer.PublicKeyAlgorithm)
+	fmt.Println("tls:", tls.VersionName(peer.TLSVersion), tls.CipherSuiteName(peer.CipherSuite), peer.NegotiatedProtocol)
+	fmt.Println("from:", peer.RemoteAddr)
+	// Output:
+	// id: spiffe://example.org/api-client
+	// serial: 5c3f
+	// key: ECDSA
+	// tls: TLS 1.3 TLS_AES_128_GCM_SHA256 h2
+	// from: 192.0.2.1:1234
+}
+
+// ExamplePeerFromResponse shows logging which server answered a request.
+func ExamplePeerFromResponse() {
+	// Normally returned by an mTLS client's Do
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		TLS: &tls.ConnectionState{
+			Version: tls.VersionTLS13,
+			PeerCertificates: []*x509.Certificate{{
+				URIs: []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/billing"}},
+			}},
+		},
+	}
+
+	if server, ok := spiffehttp.PeerFromResponse(resp); ok {
+		fmt.Println("answered by", server.ID, "over", tls.VersionName(server.TLSVersion))
+	}
+	// Output:
+	// answered by spiffe://example.org/billing over TLS 1.3
+}
+
+// ExampleMiddleware shows attaching the peer to every request, extracting it
+// once per connection.
+func ExampleMiddleware() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := spiffehttp.PeerFromContext(r.Context())
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, "hello %s", peer.ID)
+	})
+
+	// In production:
+	//
+	//	srv := &http.Server{
+	//	    Handler:     spiffehttp.Middleware(mux),
+	//	    TLSConfig:   tlsCfg, // from NewServerTLSConfig
+	//	    ConnContext: spiffehttp.ConnContext,
+	//	}
+	handler := spiffehttp.Middleware(mux)
+
+	// Two requests on one connection, as the TLS handshake would set them up
+	connCtx := spiffehttp.ConnContext(context.Background(), nil)
+	for range 2 {
+		r := httptest.NewRequest(http.MethodGet, "https://api.example.org/hello", nil).WithContext(connCtx)
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{
+			URIs: []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/api-client"}},
+		}}}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		fmt.Println(w.Body.String())
+	}
+	// Output:
+	// hello spiffe://example.org/api-client
+	// hello spiffe://example.org/api-client
+}
+
 // ExampleWithPeer demonstrates attaching peer information to a request context
 // for use in middleware chains.
 func ExampleWithPeer() {
@@ -249,6 +384,188 @@ func ExampleWithPeer() {
 	_ = authMiddleware(handler)
 }
 
+// ExampleRequire demonstrates per-route authorization: ops identities may
+// change the admin route, other members of the trust domain may only read it.
+func ExampleRequire() {
+	corp := spiffeid.RequireTrustDomainFromString("corp")
+	ops := spiffehttp.Require(spiffehttp.Policy{
+		IDs: []spiffeid.ID{spiffeid.RequireFromString("spiffe://corp/ops/admin")},
+	})
+	readOnly := spiffehttp.Require(spiffehttp.Policy{
+		TrustDomains: []spiffeid.TrustDomain{corp},
+		Methods:      []string{http.MethodGet},
+	})
+
+	admin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux := http.NewServeMux()
+	mux.Handle("POST /admin", ops(admin))
+	mux.Handle("GET /admin", readOnly(admin))
+
+	call := func(method, id string) {
+		req := httptest.NewRequest(method, "/admin", nil)
+		if id != "" {
+			// In a real server the peer comes from the verified TLS connection
+			peer := spiffehttp.Peer{ID: spiffeid.RequireFromString(id)}
+			req = req.WithContext(spiffehttp.WithPeer(req.Context(), peer))
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if id == "" {
+			id = "(no peer)"
+		}
+		fmt.Println(method, id, rec.Code)
+	}
+
+	call(http.MethodGet, "spiffe://corp/web")
+	call(http.MethodPost, "spiffe://corp/web")
+	call(http.MethodPost, "spiffe://corp/ops/admin")
+	call(http.MethodGet, "")
+	// Output:
+	// GET spiffe://corp/web 200
+	// POST spiffe://corp/web 403
+	// POST spiffe://corp/ops/admin 200
+	// GET (no peer) 401
+}
+
+// ExampleRequireRules demonstrates ordered route rules with deny by default.
+func ExampleRequireRules() {
+	corp := spiffeid.RequireTrustDomainFromString("corp")
+	ops, err := spiffehttp.ParseIDPattern("spiffe://corp/ops/*")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	authz := spiffehttp.RequireRules(spiffehttp.ErrorFormatPlain,
+		spiffehttp.Rule{PathPrefix: "/admin", IDPatterns: []*spiffehttp.IDPattern{ops}},
+		spiffehttp.Rule{PathPrefix: "/api", TrustDomains: []spiffeid.TrustDomain{corp}},
+	)
+	handler := authz(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	}))
+
+	call := func(path, id string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		peer := spiffehttp.Peer{ID: spiffeid.RequireFromString(id)}
+		req = req.WithContext(spiffehttp.WithPeer(req.Context(), peer))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		fmt.Println(path, id, rec.Code)
+	}
+
+	call("/api/users", "spiffe://corp/web")
+	call("/admin/reload", "spiffe://corp/web")
+	call("/admin/reload", "spiffe://corp/ops/alice")
+	call("/api/../admin", "spiffe://corp/web")
+	call("/metrics", "spiffe://corp/ops/alice")
+	// Output:
+	// /api/users spiffe://corp/web 200
+	// /admin/reload spiffe://corp/web 403
+	// /admin/reload spiffe://corp/ops/alice 200
+	// /api/../admin spiffe://corp/web 403
+	// /metrics spiffe://corp/ops/alice 403
+}
+
+// ExampleWithDecisionHook records every decision of RequireRules, e.g. for an
+// audit log.
+func ExampleWithDecisionHook() {
+	authz := spiffehttp.RequireRules(spiffehttp.ErrorFormatPlain,
+		spiffehttp.Rule{PathPrefix: "/admin", IDs: []spiffeid.ID{spiffeid.RequireFromString("spiffe://corp/ops")}},
+		spiffehttp.Rule{PathPrefix: "/api"},
+	)
+	handler := authz(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, path := range []string{"/api/users", "/admin/reload"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		ctx := spiffehttp.WithPeer(req.Context(), spiffehttp.Peer{ID: spiffeid.RequireFromString("spiffe://corp/web")})
+		ctx = spiffehttp.WithDecisionHook(ctx, func(d spiffehttp.Decision) {
+			fmt.Printf("%s allowed=%t rule=%s status=%d\n", path, d.Allowed, d.Rule, d.Status)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+	}
+	// Output:
+	// /api/users allowed=true rule=rules[1] status=0
+	// /admin/reload allowed=false rule=rules[0] status=403
+}
+
+// ExampleAnyOf demonstrates composing custom authorizers with SDK ones.
+func ExampleAnyOf() {
+	ops := spiffeid.RequireFromString("spiffe://corp/ops/admin")
+	approved := map[string]bool{"spiffe://partner.org/billing": true}
+
+	// A stand-in for an allowlist service
+	allowlist := func(id spiffeid.ID, _ [][]*x509.Certificate) error {
+		if !approved[id.String()] {
+			return errors.New("not on the allowlist")
+		}
+		return nil
+	}
+	authorize := spiffehttp.AnyOf(tlsconfig.AuthorizeID(ops), allowlist)
+
+	for _, raw := range []string{
+		"spiffe://corp/ops/admin",
+		"spiffe://partner.org/billing",
+		"spiffe://partner.org/shipping",
+	} {
+		err := authorize(spiffeid.RequireFromString(raw), nil)
+		fmt.Println(raw, err == nil)
+	}
+	// Output:
+	// spiffe://corp/ops/admin true
+	// spiffe://partner.org/billing true
+	// spiffe://partner.org/shipping false
+}
+
+// ExampleDenyList shows cutting off a compromised identity and a leaked SVID
+// while servers keep running.
+func ExampleDenyList() {
+	deny := spiffehttp.NewDenyList(spiffehttp.DenyEntries{})
+
+	billing := spiffeid.RequireFromString("spiffe://corp/billing")
+	leaked := &x509.Certificate{SerialNumber: big.NewInt(0x5c3f)}
+	fmt.Println("before:", deny.Authorize(billing, [][]*x509.Certificate{{leaked}}))
+
+	deny.Set(spiffehttp.DenyEntries{
+		IDs:           []spiffeid.ID{spiffeid.RequireFromString("spiffe://corp/legacy-batch")},
+		SerialNumbers: []*big.Int{big.NewInt(0x5c3f)},
+	})
+	fmt.Println("after:", deny.Authorize(billing, [][]*x509.Certificate{{leaked}}))
+	fmt.Println("after:", deny.Authorize(spiffeid.RequireFromString("spiffe://corp/legacy-batch"), nil))
+	// Output:
+	// before: <nil>
+	// after: certificate serial number 5c3f of "spiffe://corp/billing" is denied
+	// after: SPIFFE ID "spiffe://corp/legacy-batch" is denied
+}
+
+// ExampleHandshakeStats shows an OnHandshake hook that counts client
+// handshakes and reports each rejection with its cause.
+func ExampleHandshakeStats() {
+	var stats spiffehttp.HandshakeStats
+	onHandshake := func(info spiffehttp.HandshakeInfo) {
+		stats.Observe(info)
+		if info.Err != nil {
+			fmt.Printf("rejected %s: %s\n", info.PeerID, info.Failure)
+		}
+	}
+	// Usually passed as spiffehttp.ServerConfig{OnHandshake: onHandshake}
+
+	onHandshake(spiffehttp.HandshakeInfo{PeerID: spiffeid.RequireFromString("spiffe://corp/api")})
+	onHandshake(spiffehttp.HandshakeInfo{
+		PeerID:  spiffeid.RequireFromString("spiffe://corp/batch"),
+		Failure: spiffehttp.FailureExpired,
+		Err:     errors.New("client certificate is expired or not yet valid"),
+	})
+
+	counts := stats.Counts()
+	fmt.Println("accepted:", counts.Accepted)
+	fmt.Println("expired:", counts.Failures[spiffehttp.FailureExpired])
+	// Output:
+	// rejected spiffe://corp/batch: expired_certificate
+	// accepted: 1
+	// expired: 1
+}
+
 // ExamplePeerFromContext demonstrates retrieving peer information from
 // a request context (typically set by middleware).
 func ExamplePeerFromContext() {
@@ -273,6 +590,32 @@ func ExamplePeerFromContext() {
 	_ = handler // Use handler
 }
 
+// ExampleIDPattern_Match demonstrates matching SPIFFE IDs against a pattern
+// and reading the captured path segment.
+func ExampleIDPattern_Match() {
+	pattern, err := spiffehttp.ParseIDPattern("spiffe://prod.corp/ns/{namespace}/sa/billing-*")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, raw := range []string{
+		"spiffe://prod.corp/ns/acme/sa/billing-api",
+		"spiffe://prod.corp/ns/acme/sa/payments",
+		"spiffe://dev.corp/ns/acme/sa/billing-api",
+	} {
+		vars, ok := pattern.Match(spiffeid.RequireFromString(raw))
+		if !ok {
+			fmt.Println("no match")
+			continue
+		}
+		fmt.Println("namespace:", vars["namespace"])
+	}
+	// Output:
+	// namespace: acme
+	// no match
+	// no match
+}
+
 // Example_tlsVersionCheck demonstrates verifying the TLS version
 // enforced by the library.
 func Example_tlsVersionCheck() {
@@ -0,0 +1,233 @@
+package spiffehttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// HandshakeFailure classifies why a client was rejected during the TLS
+// handshake.
+type HandshakeFailure string
+
+const (
+	// FailureNoCertificate means the client sent no certificate.
+	FailureNoCertificate HandshakeFailure = "no_client_certificate"
+
+	// FailureUntrustedCA means the client certificate was not signed by the
+	// bundle of its trust domain, or no bundle is known for that trust
+	// domain.
+	FailureUntrustedCA HandshakeFailure = "untrusted_ca"
+
+	// FailureUnauthorized means the certificate was valid but the client's
+	// SPIFFE ID was rejected by the policy, Authorizer or DenyList.
+	FailureUnauthorized HandshakeFailure = "unauthorized_id"
+
+	// FailureExpired means the client certificate was expired or not yet
+	// valid.
+	FailureExpired HandshakeFailure = "expired_certificate"
+
+	// FailureProtocolVersion means the client does not support TLS 1.3.
+	FailureProtocolVersion HandshakeFailure = "protocol_version"
+
+	// FailureInvalidCertificate means the client certificate is not a valid
+	// X.509 SVID, e.g. it has no SPIFFE ID or is a CA certificate.
+	FailureInvalidCertificate HandshakeFailure = "invalid_certificate"
+)
+
+// description is a readable sentence for the failure.
+func (f HandshakeFailure) description() string {
+	switch f {
+	case FailureNoCertificate:
+		return "client did not provide a certificate"
+	case FailureUntrustedCA:
+		return "client certificate is not signed by a trusted bundle"
+	case FailureUnauthorized:
+		return "client SPIFFE ID is not authorized"
+	case FailureExpired:
+		return "client certificate is expired or not yet valid"
+	case FailureProtocolVersion:
+		return "client does not support TLS 1.3"
+	default:
+		return "client certificate is not a valid X.509 SVID"
+	}
+}
+
+// HandshakeInfo describes how a server verified a client during the TLS
+// handshake. It is passed to ServerConfig.OnHandshake.
+type HandshakeInfo struct {
+	// LocalAddr is the server address the client connected to.
+	LocalAddr net.Addr
+
+	// RemoteAddr is the client's address.
+	RemoteAddr net.Addr
+
+	// PeerID is the SPIFFE ID from the client certificate. It is the zero ID
+	// if the client sent no certificate or its SPIFFE ID could not be parsed.
+	PeerID spiffeid.ID
+
+	// Failure is empty if the client was accepted, otherwise why it was
+	// rejected.
+	Failure HandshakeFailure
+
+	// Err is nil if the client was accepted, otherwise the error that
+	// rejected it. Its message names the Failure and the PeerID, if known.
+	Err error
+}
+
+// handshakeError is a classified client verification error. It is what the
+// TLS handshake fails with, so http.Server's "TLS handshake error" log line
+// carries the classification too.
+type handshakeError struct {
+	failure HandshakeFailure
+	id      spiffeid.ID
+	err     error
+}
+
+func (e *handshakeError) Error() string {
+	msg := e.failure.description()
+	if !e.id.IsZero() {
+		msg += fmt.Sprintf(" (%s)", e.id)
+	}
+	if e.err != nil {
+		msg += ": " + e.err.Error()
+	}
+	return msg
+}
+
+func (e *handshakeError) Unwrap() error {
+	return e.err
+}
+
+// observeHandshakes makes base report every client verification to observe.
+//
+// Each handshake gets a copy of base whose VerifyPeerCertificate performs the
+// same SPIFFE verification and authorization as go-spiffe, so the outcome can
+// be reported with the connection's addresses. Client certificates are
+// requested rather than required, so a client without one is reported too
+// before it is rejected.
+func observeHandshakes(base *tls.Config, bundleSource x509bundle.Source, authorizer Authorizer, observe func(HandshakeInfo)) {
+	report := func(info HandshakeInfo, err *handshakeError) error {
+		if err == nil {
+			observe(info)
+			return nil
+		}
+		info.PeerID, info.Failure, info.Err = err.id, err.failure, err
+		observe(info)
+		return err
+	}
+
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		var info HandshakeInfo
+		if hello.Conn != nil {
+			info.LocalAddr = hello.Conn.LocalAddr()
+			info.RemoteAddr = hello.Conn.RemoteAddr()
+		}
+		if !slices.Contains(hello.SupportedVersions, tls.VersionTLS13) {
+			return nil, report(info, &handshakeError{failure: FailureProtocolVersion})
+		}
+
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientAuth = tls.RequestClientCert
+		cfg.VerifyPeerCertificate = func(raw [][]byte, _ [][]*x509.Certificate) error {
+			id, err := verifyClient(raw, bundleSource, authorizer)
+			if err != nil {
+				return report(info, err)
+			}
+			info.PeerID = id
+			return report(info, nil)
+		}
+		return cfg, nil
+	}
+}
+
+// verifyClient verifies and authorizes a client certificate chain, returning
+// the client's SPIFFE ID or a classified error.
+func verifyClient(raw [][]byte, bundleSource x509bundle.Source, authorizer Authorizer) (spiffeid.ID, *handshakeError) {
+	if len(raw) == 0 {
+		return spiffeid.ID{}, &handshakeError{failure: FailureNoCertificate}
+	}
+	leaf, err := x509.ParseCertificate(raw[0])
+	if err != nil {
+		return spiffeid.ID{}, &handshakeError{failure: FailureInvalidCertificate, err: err}
+	}
+	id, err := x509svid.IDFromCert(leaf)
+	if err != nil {
+		return spiffeid.ID{}, &handshakeError{failure: FailureInvalidCertificate, err: err}
+	}
+	if _, err := bundleSource.GetX509BundleForTrustDomain(id.TrustDomain()); err != nil {
+		return id, &handshakeError{failure: FailureUntrustedCA, id: id, err: err}
+	}
+
+	_, chains, err := x509svid.ParseAndVerify(raw, bundleSource)
+	if err != nil {
+		return id, &handshakeError{failure: classifyVerifyError(err), id: id, err: err}
+	}
+	if err := authorizer(id, chains); err != nil {
+		return id, &handshakeError{failure: FailureUnauthorized, id: id, err: err}
+	}
+	return id, nil
+}
+
+// classifyVerifyError classifies an X.509 SVID verification error.
+func classifyVerifyError(err error) HandshakeFailure {
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		return FailureExpired
+	}
+	var unknown x509.UnknownAuthorityError
+	if errors.As(err, &unknown) {
+		return FailureUntrustedCA
+	}
+	return FailureInvalidCertificate
+}
+
+// HandshakeStats counts client handshakes by outcome. Its Observe method can
+// be used as ServerConfig.OnHandshake, alone or from a wider hook. The zero
+// value is ready to use and it is safe for concurrent use.
+type HandshakeStats struct {
+	mu       sync.Mutex
+	accepted uint64
+	failures map[HandshakeFailure]uint64
+}
+
+// HandshakeCounts is a snapshot of HandshakeStats.
+type HandshakeCounts struct {
+	// Accepted is the number of clients accepted.
+	Accepted uint64
+
+	// Failures is the number of clients rejected, by cause. Causes that
+	// never occurred are absent.
+	Failures map[HandshakeFailure]uint64
+}
+
+// Observe counts one handshake.
+func (s *HandshakeStats) Observe(info HandshakeInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info.Err == nil {
+		s.accepted++
+		return
+	}
+	if s.failures == nil {
+		s.failures = make(map[HandshakeFailure]uint64)
+	}
+	s.failures[info.Failure]++
+}
+
+// Counts returns the current counts.
+func (s *HandshakeStats) Counts() HandshakeCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return HandshakeCounts{Accepted: s.accepted, Failures: maps.Clone(s.failures)}
+}
@@ -0,0 +1,226 @@
+package spiffehttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+)
+
+// testCA signs certificates for the handshake tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, td string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate CA key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		URIs:                  []*url.URL{{Scheme: "spiffe", Host: td}},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse CA certificate: %v", err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// leaf issues a DER leaf certificate for id (no URI SAN if id is empty)
+// valid until notAfter.
+func (ca *testCA) leaf(t *testing.T, id string, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if id != "" {
+		tmpl.URIs = []*url.URL{spiffeid.RequireFromString(id).URL()}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return der
+}
+
+func TestVerifyClient(t *testing.T) {
+	td := spiffeid.RequireTrustDomainFromString("example.org")
+	ca := newTestCA(t, "example.org")
+	otherCA := newTestCA(t, "example.org")
+	foreignCA := newTestCA(t, "other.org")
+	bundles := x509bundle.NewSet(x509bundle.FromX509Authorities(td, []*x509.Certificate{ca.cert}))
+
+	client := "spiffe://example.org/client"
+	valid := time.Now().Add(time.Hour)
+	denyBatch := func(id spiffeid.ID, _ [][]*x509.Certificate) error {
+		if id.Path() == "/batch" {
+			return fmt.Errorf("unexpected ID %q", id)
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		raw         [][]byte
+		wantFailure HandshakeFailure // empty means accepted
+		wantID      string
+	}{
+		{
+			name:   "valid",
+			raw:    [][]byte{ca.leaf(t, client, valid)},
+			wantID: client,
+		},
+		{
+			name:        "no certificate",
+			raw:         nil,
+			wantFailure: FailureNoCertificate,
+		},
+		{
+			name:        "not a certificate",
+			raw:         [][]byte{[]byte("garbage")},
+			wantFailure: FailureInvalidCertificate,
+		},
+		{
+			name:        "no SPIFFE ID",
+			raw:         [][]byte{ca.leaf(t, "", valid)},
+			wantFailure: FailureInvalidCertificate,
+		},
+		{
+			name:        "signed by an untrusted CA",
+			raw:         [][]byte{otherCA.leaf(t, client, valid)},
+			wantFailure: FailureUntrustedCA,
+			wantID:      client,
+		},
+		{
+			name:        "no bundle for the trust domain",
+			raw:         [][]byte{foreignCA.leaf(t, "spiffe://other.org/client", valid)},
+			wantFailure: FailureUntrustedCA,
+			wantID:      "spiffe://other.org/client",
+		},
+		{
+			name:        "expired",
+			raw:         [][]byte{ca.leaf(t, client, time.Now().Add(-time.Minute))},
+			wantFailure: FailureExpired,
+			wantID:      client,
+		},
+		{
+			name:        "unauthorized ID",
+			raw:         [][]byte{ca.leaf(t, "spiffe://example.org/batch", valid)},
+			wantFailure: FailureUnauthorized,
+			wantID:      "spiffe://example.org/batch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := verifyClient(tt.raw, bundles, denyBatch)
+			if tt.wantFailure == "" {
+				if err != nil {
+					t.Fatalf("verifyClient() error = %v", err)
+				}
+			} else {
+				if err == nil {
+					t.Fatalf("verifyClient() accepted the client, want %s", tt.wantFailure)
+				}
+				if err.failure != tt.wantFailure {
+					t.Fatalf("verifyClient() failure = %s (%v), want %s", err.failure, err, tt.wantFailure)
+				}
+			}
+			var wantID spiffeid.ID
+			if tt.wantID != "" {
+				wantID = spiffeid.RequireFromString(tt.wantID)
+			}
+			if id != wantID {
+				t.Errorf("verifyClient() ID = %q, want %q", id, wantID)
+			}
+			if err != nil && err.id != wantID {
+				t.Errorf("error ID = %q, want %q", err.id, wantID)
+			}
+		})
+	}
+}
+
+func TestClassifyVerifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want HandshakeFailure
+	}{
+		{"expired", x509.CertificateInvalidError{Reason: x509.Expired}, FailureExpired},
+		{"wrapped expired", fmt.Errorf("x509svid: %w", x509.CertificateInvalidError{Reason: x509.Expired}), FailureExpired},
+		{"unknown authority", x509.UnknownAuthorityError{}, FailureUntrustedCA},
+		{"wrapped unknown authority", fmt.Errorf("x509svid: %w", x509.UnknownAuthorityError{}), FailureUntrustedCA},
+		{"other invalid reason", x509.CertificateInvalidError{Reason: x509.NotAuthorizedToSign}, FailureInvalidCertificate},
+		{"other error", errors.New("leaf certificate must not have CA flag set"), FailureInvalidCertificate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyVerifyError(tt.err); got != tt.want {
+				t.Errorf("classifyVerifyError() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveHandshakes_ProtocolVersion(t *testing.T) {
+	var observed []HandshakeInfo
+	base := &tls.Config{MinVersion: tls.VersionTLS13}
+	observeHandshakes(base, x509bundle.NewSet(), tlsconfig.AuthorizeAny(), func(info HandshakeInfo) {
+		observed = append(observed, info)
+	})
+
+	_, err := base.GetConfigForClient(&tls.ClientHelloInfo{SupportedVersions: []uint16{tls.VersionTLS12}})
+	if err == nil {
+		t.Fatal("GetConfigForClient() accepted a TLS 1.2 client")
+	}
+	if len(observed) != 1 || observed[0].Failure != FailureProtocolVersion || observed[0].Err == nil {
+		t.Fatalf("observed %+v, want one %s rejection", observed, FailureProtocolVersion)
+	}
+
+	// TLS 1.3 clients get a config that reports their certificate
+	observed = nil
+	cfg, err := base.GetConfigForClient(&tls.ClientHelloInfo{SupportedVersions: []uint16{tls.VersionTLS13, tls.VersionTLS12}})
+	if err != nil {
+		t.Fatalf("GetConfigForClient() error = %v", err)
+	}
+	if cfg.ClientAuth != tls.RequestClientCert || cfg.VerifyPeerCertificate == nil || cfg.GetConfigForClient != nil {
+		t.Fatal("per-handshake config does not verify client certificates itself")
+	}
+	if err := cfg.VerifyPeerCertificate(nil, nil); err == nil {
+		t.Error("VerifyPeerCertificate() accepted a client without a certificate")
+	}
+	if len(observed) != 1 || observed[0].Failure != FailureNoCertificate {
+		t.Errorf("observed %+v, want one %s rejection", observed, FailureNoCertificate)
+	}
+}
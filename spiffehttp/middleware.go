@@ -0,0 +1,71 @@
+package spiffehttp
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// connPeer caches the peer of one connection. The handshake has not happened
+// yet when ConnContext runs, so the peer is computed by the first request.
+type connPeer struct {
+	once sync.Once
+	peer Peer
+	ok   bool
+}
+
+// context key type (unexported) to avoid collisions with keys from other packages.
+type connPeerCtxKey struct{}
+
+var connPeerKey = connPeerCtxKey{}
+
+// ConnContext prepares a connection's context so that Middleware extracts
+// the peer once per TLS connection instead of once per request. Use it as
+// http.Server.ConnContext, or call it from your own ConnContext:
+//
+//	srv := &http.Server{
+//	    Handler:     spiffehttp.Middleware(mux),
+//	    TLSConfig:   tlsCfg,
+//	    ConnContext: spiffehttp.ConnContext,
+//	}
+//
+// Without it Middleware still works, parsing the peer certificate on every
+// request.
+func ConnContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connPeerKey, &connPeer{})
+}
+
+// Middleware attaches the authenticated peer to each request's context with
+// WithPeer, so handlers can call PeerFromContext.
+//
+// With ConnContext installed on the server, the peer is computed on the first
+// request of each connection and reused by the rest, including concurrent
+// HTTP/2 streams. A TLS connection's certificates cannot change, so the
+// cached peer stays accurate for the connection's lifetime.
+//
+// Requests without a verified SPIFFE identity are passed on unchanged; wrap
+// handlers with Require to reject them. The same security note as
+// PeerFromRequest applies: only use Middleware behind a server that verifies
+// client certificates with NewServerTLSConfig.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if peer, ok := connectionPeer(r); ok {
+			r = r.WithContext(WithPeer(r.Context(), peer))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// connectionPeer returns the peer of r's connection, computing it once per
+// connection if ConnContext is installed.
+func connectionPeer(r *http.Request) (Peer, bool) {
+	cache, ok := r.Context().Value(connPeerKey).(*connPeer)
+	if !ok {
+		return PeerFromRequest(r)
+	}
+	cache.once.Do(func() {
+		cache.peer, cache.ok = PeerFromRequest(r)
+	})
+	return cache.peer, cache.ok
+}
@@ -0,0 +1,212 @@
+package spiffehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// IDPattern matches SPIFFE IDs against a template such as
+//
+//	spiffe://prod.corp/ns/{namespace}/sa/billing-*
+//
+// The trust domain is matched literally. The path is matched segment by
+// segment, and an ID matches only if it has the same number of segments:
+//   - A plain segment ("ns") must be equal
+//   - A segment containing "*" is a wildcard: "*" matches any run of
+//     characters within the segment, so "billing-*" matches "billing-api"
+//     and "*" matches any single segment
+//   - A whole segment "{name}" matches any single segment and captures its
+//     value under name
+//
+// Wildcards and captures never span "/". Capture names must be unique within
+// a pattern and use letters, digits and "_", starting with a letter or "_".
+//
+// An IDPattern is immutable and safe for concurrent use.
+type IDPattern struct {
+	raw          string
+	trustDomain  spiffeid.TrustDomain
+	segments     []patternSegment
+	captureCount int
+}
+
+// patternSegment is one path segment of an IDPattern. Exactly one of
+// capture and parts is meaningful: capture names a "{name}" segment, and
+// parts holds the literal pieces of a segment split around "*".
+type patternSegment struct {
+	capture string
+	parts   []string
+}
+
+// ParseIDPattern parses a SPIFFE ID pattern. See IDPattern for the syntax.
+//
+// Returns an error if the pattern is not of the form spiffe://<trust
+// domain>/<path>, the trust domain is invalid, a segment is empty or uses
+// characters not allowed in SPIFFE IDs, or a capture is malformed or repeated.
+func ParseIDPattern(pattern string) (*IDPattern, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(pattern), "spiffe://")
+	if !ok {
+		return nil, errors.New(`pattern must start with "spiffe://"`)
+	}
+	tdName, path, ok := strings.Cut(rest, "/")
+	if !ok || path == "" {
+		return nil, errors.New("pattern must have a path")
+	}
+	td, err := spiffeid.TrustDomainFromString(tdName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trust domain: %w", err)
+	}
+
+	p := &IDPattern{raw: strings.TrimSpace(pattern), trustDomain: td}
+	captures := make(map[string]bool)
+	for _, seg := range strings.Split(path, "/") {
+		if strings.ContainsAny(seg, "{}") {
+			name, ok := captureName(seg)
+			if !ok {
+				return nil, fmt.Errorf("invalid capture %q: must be a whole segment of the form {name}", seg)
+			}
+			if captures[name] {
+				return nil, fmt.Errorf("duplicate capture %q", name)
+			}
+			captures[name] = true
+			p.segments = append(p.segments, patternSegment{capture: name})
+			continue
+		}
+		// Validate the literal characters; each "*" stands in for at least
+		// a valid character so "*" and "*.*" are accepted as segments.
+		if err := spiffeid.ValidatePathSegment(strings.ReplaceAll(seg, "*", "x")); err != nil {
+			return nil, fmt.Errorf("invalid segment %q: %w", seg, err)
+		}
+		p.segments = append(p.segments, patternSegment{parts: strings.Split(seg, "*")})
+	}
+	p.captureCount = len(captures)
+	return p, nil
+}
+
+// captureName returns name if seg is a "{name}" capture with a valid name.
+func captureName(seg string) (string, bool) {
+	name, ok := strings.CutPrefix(seg, "{")
+	if !ok {
+		return "", false
+	}
+	name, ok = strings.CutSuffix(name, "}")
+	if !ok || !validCaptureName(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// validCaptureName reports whether name is an identifier.
+func validCaptureName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the pattern as it was parsed.
+func (p *IDPattern) String() string {
+	return p.raw
+}
+
+// Match reports whether id matches the pattern and returns the captured
+// values by name. The map is non-nil on a match, and empty if the pattern
+// has no captures.
+func (p *IDPattern) Match(id spiffeid.ID) (map[string]string, bool) {
+	if id.TrustDomain() != p.trustDomain {
+		return nil, false
+	}
+	segments := strings.Split(strings.TrimPrefix(id.Path(), "/"), "/")
+	if id.Path() == "" || len(segments) != len(p.segments) {
+		return nil, false
+	}
+	vars := make(map[string]string, p.captureCount)
+	for i, seg := range segments {
+		ps := p.segments[i]
+		if ps.capture != "" {
+			vars[ps.capture] = seg
+			continue
+		}
+		if !matchParts(ps.parts, seg) {
+			return nil, false
+		}
+	}
+	return vars, true
+}
+
+// matchParts reports whether s matches the literal pieces of a segment split
+// around "*": the first piece is a prefix, the last a suffix, and the pieces
+// in between appear in order.
+func matchParts(parts []string, s string) bool {
+	if len(parts) == 1 {
+		return s == parts[0]
+	}
+	first, last := parts[0], parts[len(parts)-1]
+	if len(s) < len(first)+len(last) || !strings.HasPrefix(s, first) || !strings.HasSuffix(s, last) {
+		return false
+	}
+	s = s[len(first) : len(s)-len(last)]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return true
+}
+
+// context key type (unexported) to avoid collisions with keys from other packages.
+type idVarsCtxKey struct{}
+
+var idVarsKey = idVarsCtxKey{}
+
+// WithIDVars attaches the values captured from the peer's SPIFFE ID by an
+// IDPattern to the context, next to the Peer stored by WithPeer.
+func WithIDVars(ctx context.Context, vars map[string]string) context.Context {
+	return context.WithValue(ctx, idVarsKey, vars)
+}
+
+// IDVarsFromContext retrieves the values captured from the peer's SPIFFE ID.
+//
+// Returns (nil, false) if the context has none, for example because the peer
+// was allowed by an exact ID or trust domain rather than a pattern.
+//
+// Example handler enforcing tenant isolation:
+//
+//	// allowed_client_spiffe_id_patterns: ["spiffe://prod.corp/ns/{namespace}/sa/*"]
+//	func myHandler(w http.ResponseWriter, r *http.Request) {
+//	    vars, _ := spiffehttp.IDVarsFromContext(r.Context())
+//	    if vars["namespace"] != r.PathValue("tenant") {
+//	        http.Error(w, "forbidden", http.StatusForbidden)
+//	        return
+//	    }
+//	}
+func IDVarsFromContext(ctx context.Context) (map[string]string, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	vars, ok := ctx.Value(idVarsKey).(map[string]string)
+	return vars, ok
+}
+
+// MatchIDPatterns returns the captures of the first pattern that matches id.
+func MatchIDPatterns(patterns []*IDPattern, id spiffeid.ID) (map[string]string, bool) {
+	for _, p := range patterns {
+		if vars, ok := p.Match(id); ok {
+			return vars, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,218 @@
+package spiffehttp_test
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+func TestParseIDPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr string
+	}{
+		{name: "exact ID", pattern: "spiffe://example.org/ns/prod/sa/api"},
+		{name: "capture", pattern: "spiffe://example.org/ns/{namespace}/sa/api"},
+		{name: "several captures", pattern: "spiffe://example.org/ns/{namespace}/sa/{service_account}"},
+		{name: "whole-segment wildcard", pattern: "spiffe://example.org/ns/*/sa/api"},
+		{name: "partial wildcard", pattern: "spiffe://example.org/ns/prod/sa/billing-*"},
+		{name: "several wildcards in one segment", pattern: "spiffe://example.org/ns/prod/sa/*-billing-*"},
+		{name: "several wildcard segments", pattern: "spiffe://example.org/ns/*/sa/*"},
+		{name: "capture name with digits and underscore", pattern: "spiffe://example.org/ns/{_ns2}"},
+		{name: "surrounding spaces", pattern: "  spiffe://example.org/ns/{namespace}  "},
+
+		{name: "empty", pattern: "", wantErr: `must start with "spiffe://"`},
+		{name: "missing scheme", pattern: "example.org/ns/prod", wantErr: `must start with "spiffe://"`},
+		{name: "missing path", pattern: "spiffe://example.org", wantErr: "must have a path"},
+		{name: "root path", pattern: "spiffe://example.org/", wantErr: "must have a path"},
+		{name: "wildcard in trust domain", pattern: "spiffe://*.example.org/ns/prod", wantErr: "invalid trust domain"},
+		{name: "capture in trust domain", pattern: "spiffe://{td}/ns/prod", wantErr: "invalid trust domain"},
+		{name: "empty segment", pattern: "spiffe://example.org/ns//sa/api", wantErr: `invalid segment ""`},
+		{name: "trailing slash", pattern: "spiffe://example.org/ns/prod/", wantErr: `invalid segment ""`},
+		{name: "dot segment", pattern: "spiffe://example.org/ns/../sa", wantErr: `invalid segment ".."`},
+		{name: "invalid character", pattern: "spiffe://example.org/ns/pr@d", wantErr: `invalid segment "pr@d"`},
+		{name: "partial capture", pattern: "spiffe://example.org/ns/api-{name}", wantErr: "invalid capture"},
+		{name: "unclosed capture", pattern: "spiffe://example.org/ns/{name", wantErr: "invalid capture"},
+		{name: "empty capture name", pattern: "spiffe://example.org/ns/{}", wantErr: "invalid capture"},
+		{name: "capture name starting with a digit", pattern: "spiffe://example.org/ns/{1ns}", wantErr: "invalid capture"},
+		{name: "capture name with a dash", pattern: "spiffe://example.org/ns/{name-space}", wantErr: "invalid capture"},
+		{name: "wildcard capture", pattern: "spiffe://example.org/ns/{*}", wantErr: "invalid capture"},
+		{name: "duplicate capture", pattern: "spiffe://example.org/ns/{name}/sa/{name}", wantErr: `duplicate capture "name"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := spiffehttp.ParseIDPattern(tt.pattern)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("ParseIDPattern(%q) succeeded, want error containing %q", tt.pattern, tt.wantErr)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseIDPattern(%q) error = %q, want it to contain %q", tt.pattern, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseIDPattern(%q) error = %v", tt.pattern, err)
+			}
+			if got, want := p.String(), strings.TrimSpace(tt.pattern); got != want {
+				t.Errorf("String() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestIDPattern_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		id       string
+		wantVars map[string]string // nil means no match
+	}{
+		{
+			name:     "exact ID",
+			pattern:  "spiffe://example.org/ns/prod/sa/api",
+			id:       "spiffe://example.org/ns/prod/sa/api",
+			wantVars: map[string]string{},
+		},
+		{
+			name:    "different literal segment",
+			pattern: "spiffe://example.org/ns/prod/sa/api",
+			id:      "spiffe://example.org/ns/dev/sa/api",
+		},
+		{
+			name:     "captures",
+			pattern:  "spiffe://example.org/ns/{namespace}/sa/{sa}",
+			id:       "spiffe://example.org/ns/prod/sa/api",
+			wantVars: map[string]string{"namespace": "prod", "sa": "api"},
+		},
+		{
+			name:     "whole-segment wildcard",
+			pattern:  "spiffe://example.org/ns/*/sa/api",
+			id:       "spiffe://example.org/ns/prod/sa/api",
+			wantVars: map[string]string{},
+		},
+		{
+			name:     "prefix wildcard",
+			pattern:  "spiffe://example.org/sa/billing-*",
+			id:       "spiffe://example.org/sa/billing-api",
+			wantVars: map[string]string{},
+		},
+		{
+			name:     "prefix wildcard matching an empty run",
+			pattern:  "spiffe://example.org/sa/billing-*",
+			id:       "spiffe://example.org/sa/billing-",
+			wantVars: map[string]string{},
+		},
+		{
+			name:    "prefix wildcard with another prefix",
+			pattern: "spiffe://example.org/sa/billing-*",
+			id:      "spiffe://example.org/sa/payments-api",
+		},
+		{
+			name:     "several wildcards in one segment",
+			pattern:  "spiffe://example.org/sa/*-billing-*",
+			id:       "spiffe://example.org/sa/eu-billing-api",
+			wantVars: map[string]string{},
+		},
+		{
+			name:    "several wildcards with the middle piece missing",
+			pattern: "spiffe://example.org/sa/*-billing-*",
+			id:      "spiffe://example.org/sa/eu-payments-api",
+		},
+		{
+			name:    "pieces overlapping",
+			pattern: "spiffe://example.org/sa/ab*ba",
+			id:      "spiffe://example.org/sa/aba",
+		},
+		{
+			name:     "wildcards and captures together",
+			pattern:  "spiffe://example.org/ns/{namespace}/sa/*",
+			id:       "spiffe://example.org/ns/prod/sa/api",
+			wantVars: map[string]string{"namespace": "prod"},
+		},
+		{
+			name:    "wildcard does not span segments",
+			pattern: "spiffe://example.org/ns/*",
+			id:      "spiffe://example.org/ns/prod/sa/api",
+		},
+		{
+			name:    "fewer path segments",
+			pattern: "spiffe://example.org/ns/{namespace}/sa/{sa}",
+			id:      "spiffe://example.org/ns/prod",
+		},
+		{
+			name:    "more path segments",
+			pattern: "spiffe://example.org/ns/{namespace}",
+			id:      "spiffe://example.org/ns/prod/sa/api",
+		},
+		{
+			name:    "no path",
+			pattern: "spiffe://example.org/*",
+			id:      "spiffe://example.org",
+		},
+		{
+			name:    "different trust domain",
+			pattern: "spiffe://example.org/ns/{namespace}",
+			id:      "spiffe://other.org/ns/prod",
+		},
+		{
+			name:    "trust domain is not a suffix match",
+			pattern: "spiffe://example.org/ns/{namespace}",
+			id:      "spiffe://evil-example.org/ns/prod",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := spiffehttp.ParseIDPattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("ParseIDPattern(%q) error = %v", tt.pattern, err)
+			}
+			vars, ok := p.Match(spiffeid.RequireFromString(tt.id))
+			if want := tt.wantVars != nil; ok != want {
+				t.Fatalf("Match(%s) = %t, want %t", tt.id, ok, want)
+			}
+			if !maps.Equal(vars, tt.wantVars) {
+				t.Errorf("Match(%s) vars = %v, want %v", tt.id, vars, tt.wantVars)
+			}
+			if ok && vars == nil {
+				t.Errorf("Match(%s) returned nil vars on a match", tt.id)
+			}
+		})
+	}
+}
+
+func TestMatchIDPatterns(t *testing.T) {
+	var patterns []*spiffehttp.IDPattern
+	for _, s := range []string{
+		"spiffe://example.org/ns/prod/sa/{sa}",
+		"spiffe://example.org/ns/{namespace}/sa/{sa}",
+	} {
+		p, err := spiffehttp.ParseIDPattern(s)
+		if err != nil {
+			t.Fatalf("ParseIDPattern(%q) error = %v", s, err)
+		}
+		patterns = append(patterns, p)
+	}
+
+	// The first matching pattern wins
+	vars, ok := spiffehttp.MatchIDPatterns(patterns, spiffeid.RequireFromString("spiffe://example.org/ns/prod/sa/api"))
+	if !ok || !maps.Equal(vars, map[string]string{"sa": "api"}) {
+		t.Errorf("MatchIDPatterns() = %v, %t, want first pattern's captures", vars, ok)
+	}
+	vars, ok = spiffehttp.MatchIDPatterns(patterns, spiffeid.RequireFromString("spiffe://example.org/ns/dev/sa/api"))
+	if !ok || !maps.Equal(vars, map[string]string{"namespace": "dev", "sa": "api"}) {
+		t.Errorf("MatchIDPatterns() = %v, %t, want second pattern's captures", vars, ok)
+	}
+	if _, ok := spiffehttp.MatchIDPatterns(patterns, spiffeid.RequireFromString("spiffe://example.org/ns/dev")); ok {
+		t.Error("MatchIDPatterns() matched an ID no pattern matches")
+	}
+	if _, ok := spiffehttp.MatchIDPatterns(nil, spiffeid.RequireFromString("spiffe://example.org/ns/dev")); ok {
+		t.Error("MatchIDPatterns(nil) matched")
+	}
+}
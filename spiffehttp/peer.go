@@ -2,6 +2,9 @@ package spiffehttp
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
 	"net/http"
 	"time"
 
@@ -12,10 +15,10 @@ import (
 // Peer represents the authenticated identity extracted from an mTLS connection.
 //
 // This contains only safe, non-sensitive identity information suitable for
-// authorization decisions.
+// authorization decisions and audit logs.
 //
-// Security: Peer does NOT contain private keys or raw certificate data.
-// It only exposes the verified SPIFFE ID and metadata.
+// Security: Peer does NOT contain private keys. Certificates are public data
+// that the peer sent during the handshake.
 type Peer struct {
 	// ID is the verified SPIFFE ID from the peer's certificate.
 	// This provides strongly-typed access to both the full SPIFFE ID
@@ -31,6 +34,41 @@ type Peer struct {
 	// ExpiresAt is when the peer's certificate expires.
 	// After this time, the peer must re-authenticate with a fresh certificate.
 	ExpiresAt time.Time
+
+	// NotBefore is when the peer's certificate became valid.
+	NotBefore time.Time
+
+	// SerialNumber is the serial number of the peer's certificate, as listed
+	// in a deny list's serial_numbers.
+	SerialNumber *big.Int
+
+	// DNSNames are the DNS SANs of the peer's certificate, if any.
+	DNSNames []string
+
+	// PublicKeyAlgorithm is the algorithm of the peer certificate's key,
+	// e.g. x509.ECDSA.
+	PublicKeyAlgorithm x509.PublicKeyAlgorithm
+
+	// Chain is the peer's certificate chain, leaf first. It is the chain
+	// verified during the handshake: with go-spiffe verification, which does
+	// not report the chain it built, it is the certificates the peer sent,
+	// which were verified against the trust bundle.
+	Chain []*x509.Certificate
+
+	// TLSVersion is the negotiated TLS version, e.g. tls.VersionTLS13.
+	TLSVersion uint16
+
+	// CipherSuite is the negotiated cipher suite, e.g.
+	// tls.TLS_AES_128_GCM_SHA256. Use tls.CipherSuiteName for its name.
+	CipherSuite uint16
+
+	// NegotiatedProtocol is the ALPN protocol, e.g. "h2", or empty if none
+	// was negotiated.
+	NegotiatedProtocol string
+
+	// RemoteAddr is the peer's network address, from http.Request.RemoteAddr.
+	// PeerFromResponse leaves it empty.
+	RemoteAddr string
 }
 
 // PeerFromRequest extracts the authenticated caller's identity from an mTLS HTTP request.
@@ -87,23 +125,77 @@ func PeerFromRequest(r *http.Request) (Peer, bool) {
 	if r == nil || r.TLS == nil {
 		return Peer{}, false
 	}
+	return peerFromState(r.TLS, r.RemoteAddr)
+}
 
+// PeerFromResponse extracts the server's identity from the response to an
+// mTLS request, so clients can log or trace which workload actually answered.
+//
+// RemoteAddr is empty: a response does not record the server's address. The
+// e5s client can attach the full peer, address included, to the response's
+// request context (see e5s.WithServerPeerInContext).
+//
+// The same caveat as PeerFromRequest applies: the Peer is only verified if
+// the client's tls.Config came from NewClientTLSConfig (or SDK's
+// tlsconfig.MTLSClientConfig), so the handshake checked the server's SVID.
+//
+// Usage:
+//
+//	resp, err := client.Get("https://billing.internal:8443/invoices")
+//	if err != nil {
+//	    return err
+//	}
+//	defer resp.Body.Close()
+//	if server, ok := spiffehttp.PeerFromResponse(resp); ok {
+//	    log.Printf("answered by %s", server.ID)
+//	}
+func PeerFromResponse(resp *http.Response) (Peer, bool) {
+	if resp == nil || resp.TLS == nil {
+		return Peer{}, false
+	}
+	return peerFromState(resp.TLS, "")
+}
+
+// peerFromState extracts the peer from a TLS connection state.
+func peerFromState(state *tls.ConnectionState, remoteAddr string) (Peer, bool) {
 	// Use SDK to extract peer SPIFFE ID from TLS connection state.
 	// PeerIDFromConnectionState will fail if there are no peer certs or the ID
 	// can't be parsed as a SPIFFE ID.
-	id, err := spiffetls.PeerIDFromConnectionState(*r.TLS)
+	id, err := spiffetls.PeerIDFromConnectionState(*state)
 	if err != nil {
 		return Peer{}, false
 	}
 
+	peer := Peer{
+		ID:                 id,
+		Chain:              peerChain(state),
+		TLSVersion:         state.Version,
+		CipherSuite:        state.CipherSuite,
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		RemoteAddr:         remoteAddr,
+	}
+
 	// Defensive: PeerIDFromConnectionState already guarantees at least one
 	// peer certificate, but check to avoid panics if assumptions change.
-	var expiresAt time.Time
-	if len(r.TLS.PeerCertificates) > 0 && r.TLS.PeerCertificates[0] != nil {
-		expiresAt = r.TLS.PeerCertificates[0].NotAfter
+	if len(peer.Chain) > 0 && peer.Chain[0] != nil {
+		leaf := peer.Chain[0]
+		peer.ExpiresAt = leaf.NotAfter
+		peer.NotBefore = leaf.NotBefore
+		peer.SerialNumber = leaf.SerialNumber
+		peer.DNSNames = leaf.DNSNames
+		peer.PublicKeyAlgorithm = leaf.PublicKeyAlgorithm
 	}
 
-	return Peer{ID: id, ExpiresAt: expiresAt}, true
+	return peer, true
+}
+
+// peerChain returns the chain Go verified, if it verified one, otherwise the
+// certificates the peer sent.
+func peerChain(state *tls.ConnectionState) []*x509.Certificate {
+	if len(state.VerifiedChains) > 0 {
+		return state.VerifiedChains[0]
+	}
+	return state.PeerCertificates
 }
 
 // context key type (unexported) to avoid collisions with keys from other packages.
@@ -0,0 +1,94 @@
+package spiffehttp
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
+)
+
+// peerPolicy is a set of accepted peer identities. A peer is accepted if it
+// matches any entry: one of the exact SPIFFE IDs, membership in one of the
+// trust domains, or one of the ID patterns.
+type peerPolicy struct {
+	ids          map[spiffeid.ID]struct{}
+	trustDomains map[spiffeid.TrustDomain]struct{}
+	patterns     []*IDPattern
+}
+
+// policyEntry is one configured policy value and the field it came from,
+// used in error messages.
+type policyEntry struct {
+	value string
+	field string
+}
+
+// policyEntries flattens a single-value field and its list counterpart into
+// entries, skipping blanks. Whitespace is trimmed.
+func policyEntries(single, singleField string, list []string, listField string) []policyEntry {
+	var entries []policyEntry
+	if v := strings.TrimSpace(single); v != "" {
+		entries = append(entries, policyEntry{value: v, field: singleField})
+	}
+	for i, v := range list {
+		if v = strings.TrimSpace(v); v != "" {
+			entries = append(entries, policyEntry{value: v, field: fmt.Sprintf("%s[%d]", listField, i)})
+		}
+	}
+	return entries
+}
+
+// newPeerPolicy parses ID, trust domain and ID pattern entries into a policy.
+func newPeerPolicy(ids, trustDomains, patterns []policyEntry) (*peerPolicy, error) {
+	p := &peerPolicy{
+		ids:          make(map[spiffeid.ID]struct{}, len(ids)),
+		trustDomains: make(map[spiffeid.TrustDomain]struct{}, len(trustDomains)),
+	}
+	for _, e := range ids {
+		id, err := spiffeid.FromString(e.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", e.field, err)
+		}
+		p.ids[id] = struct{}{}
+	}
+	for _, e := range trustDomains {
+		td, err := spiffeid.TrustDomainFromString(e.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", e.field, err)
+		}
+		p.trustDomains[td] = struct{}{}
+	}
+	for _, e := range patterns {
+		pattern, err := ParseIDPattern(e.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", e.field, err)
+		}
+		p.patterns = append(p.patterns, pattern)
+	}
+	return p, nil
+}
+
+// empty reports whether the policy has no entries.
+func (p *peerPolicy) empty() bool {
+	return len(p.ids) == 0 && len(p.trustDomains) == 0 && len(p.patterns) == 0
+}
+
+// match returns nil if id is accepted by any entry of the policy.
+func (p *peerPolicy) match(id spiffeid.ID) error {
+	if _, ok := p.ids[id]; ok {
+		return nil
+	}
+	if _, ok := p.trustDomains[id.TrustDomain()]; ok {
+		return nil
+	}
+	if _, ok := MatchIDPatterns(p.patterns, id); ok {
+		return nil
+	}
+	return fmt.Errorf("unexpected ID %q", id)
+}
+
+// authorizer adapts the policy for use in a TLS handshake.
+func (p *peerPolicy) authorizer() tlsconfig.Authorizer {
+	return tlsconfig.AdaptMatcher(p.match)
+}
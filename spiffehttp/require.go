@@ -0,0 +1,336 @@
+package spiffehttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	pathpkg "path"
+	"slices"
+	"strings"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// Policy describes which authenticated peers may use a route.
+//
+// A peer is allowed if its SPIFFE ID equals one of IDs, is a member of one of
+// TrustDomains, or matches one of IDPatterns. If all three are empty, any
+// authenticated peer is allowed; the listener's handshake policy still
+// applies first.
+//
+// If Methods is set, only those HTTP methods are allowed, so one route can
+// grant read access to many callers and write access to few:
+//
+//	read := spiffehttp.Policy{TrustDomains: []spiffeid.TrustDomain{corp}, Methods: []string{"GET", "HEAD"}}
+//	write := spiffehttp.Policy{IDs: []spiffeid.ID{deployer}}
+type Policy struct {
+	// IDs allows peers with these exact SPIFFE IDs.
+	IDs []spiffeid.ID
+
+	// TrustDomains allows any peer in these trust domains.
+	TrustDomains []spiffeid.TrustDomain
+
+	// IDPatterns allows peers whose SPIFFE ID matches any of these patterns.
+	// Values captured by the first matching pattern are attached to the
+	// request context (see IDVarsFromContext).
+	IDPatterns []*IDPattern
+
+	// Methods restricts the allowed HTTP methods, e.g. "GET". Matching is
+	// case-sensitive, as in net/http. Empty means any method.
+	Methods []string
+
+	// ErrorFormat selects the body of 401 and 403 responses.
+	// Defaults to ErrorFormatAuto.
+	ErrorFormat ErrorFormat
+
+	// rule names the RequireRules rule the policy was built from, for
+	// Decision.Rule.
+	rule string
+}
+
+// ErrorFormat selects how Require writes 401 and 403 responses.
+type ErrorFormat int
+
+const (
+	// ErrorFormatAuto writes RFC 9457 problem details when the request's
+	// Accept header mentions JSON, and plain text otherwise.
+	ErrorFormatAuto ErrorFormat = iota
+
+	// ErrorFormatPlain always writes a plain-text body, like http.Error.
+	ErrorFormatPlain
+
+	// ErrorFormatProblemJSON always writes an RFC 9457 problem details
+	// body with Content-Type application/problem+json.
+	ErrorFormatProblemJSON
+)
+
+// Require returns middleware that only lets peers allowed by p reach the
+// wrapped handler.
+//
+// Requests without a verified SPIFFE identity get 401 Unauthorized. Requests
+// from a peer that p does not allow, or with a method not in p.Methods, get
+// 403 Forbidden. The peer is attached to the request context with WithPeer,
+// so handlers can call PeerFromContext.
+//
+// The middleware has the standard func(http.Handler) http.Handler shape, so
+// it works with net/http's ServeMux, chi, and most other routers:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/admin/", spiffehttp.Require(spiffehttp.Policy{
+//	    IDs: []spiffeid.ID{spiffeid.RequireFromString("spiffe://corp/ops/admin")},
+//	})(adminHandler))
+//	mux.Handle("/api/", spiffehttp.Require(spiffehttp.Policy{
+//	    TrustDomains: []spiffeid.TrustDomain{spiffeid.RequireTrustDomainFromString("corp")},
+//	})(apiHandler))
+//
+//	r := chi.NewRouter()
+//	r.With(spiffehttp.Require(adminPolicy)).Post("/admin/reload", reloadHandler)
+//
+// The same security note as PeerFromRequest applies: Require is only
+// meaningful behind a server that verifies client certificates with
+// NewServerTLSConfig. It narrows the handshake policy per route; it never
+// widens it.
+func Require(p Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, ok := PeerFromContext(r.Context())
+			if !ok {
+				peer, ok = PeerFromRequest(r)
+			}
+			if !ok {
+				p.deny(w, r, spiffeid.ID{}, http.StatusUnauthorized, "no verified SPIFFE identity")
+				return
+			}
+
+			vars, ok := p.allows(peer.ID)
+			if !ok {
+				p.deny(w, r, peer.ID, http.StatusForbidden, fmt.Sprintf("SPIFFE ID %q is not allowed", peer.ID))
+				return
+			}
+			if len(p.Methods) > 0 && !slices.Contains(p.Methods, r.Method) {
+				p.deny(w, r, peer.ID, http.StatusForbidden, fmt.Sprintf("method %s is not allowed for SPIFFE ID %q", r.Method, peer.ID))
+				return
+			}
+			reportDecision(r, Decision{Allowed: true, PeerID: peer.ID, Rule: p.rule})
+
+			ctx := WithPeer(r.Context(), peer)
+			if vars != nil {
+				ctx = WithIDVars(ctx, vars)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// allows reports whether id is allowed by p, returning the values captured
+// if it was allowed by an ID pattern.
+func (p Policy) allows(id spiffeid.ID) (map[string]string, bool) {
+	if len(p.IDs) == 0 && len(p.TrustDomains) == 0 && len(p.IDPatterns) == 0 {
+		return nil, true
+	}
+	if slices.Contains(p.IDs, id) || slices.Contains(p.TrustDomains, id.TrustDomain()) {
+		return nil, true
+	}
+	return MatchIDPatterns(p.IDPatterns, id)
+}
+
+// deny reports a denial and writes the error response.
+func (p Policy) deny(w http.ResponseWriter, r *http.Request, id spiffeid.ID, status int, reason string) {
+	reportDecision(r, Decision{Status: status, PeerID: id, Rule: p.rule, Reason: reason})
+	p.writeError(w, r, status, reason)
+}
+
+// problem is an RFC 9457 problem details body.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// writeError writes a 401 or 403 response in p's error format.
+func (p Policy) writeError(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	format := p.ErrorFormat
+	if format == ErrorFormatAuto {
+		format = ErrorFormatPlain
+		if strings.Contains(r.Header.Get("Accept"), "json") {
+			format = ErrorFormatProblemJSON
+		}
+	}
+
+	if format != ErrorFormatProblemJSON {
+		http.Error(w, http.StatusText(status)+": "+detail, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// Rule grants access to requests under PathPrefix with one of Methods.
+//
+// PathPrefix matches whole path segments: "/admin" matches "/admin" and
+// "/admin/users" but not "/administrator"; "/" matches every path. An empty
+// Methods list matches any method.
+//
+// A request selected by the rule is allowed if the peer's SPIFFE ID equals
+// one of IDs, is a member of one of TrustDomains, or matches one of
+// IDPatterns. If all three are empty, any authenticated peer is allowed.
+type Rule struct {
+	PathPrefix   string
+	Methods      []string
+	IDs          []spiffeid.ID
+	TrustDomains []spiffeid.TrustDomain
+	IDPatterns   []*IDPattern
+}
+
+// matches reports whether the rule selects a request for path and method.
+func (rule Rule) matches(path, method string) bool {
+	if len(rule.Methods) > 0 && !slices.Contains(rule.Methods, method) {
+		return false
+	}
+	return pathHasPrefix(path, rule.PathPrefix)
+}
+
+// pathHasPrefix reports whether path is prefix or lies below it, comparing
+// whole segments. A prefix ending in "/" matches anything below it.
+func pathHasPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// RequireRules returns middleware that authorizes each request by the first
+// rule selecting its path and method, and denies requests no rule selects.
+//
+// Responses follow Require: 401 Unauthorized without a verified SPIFFE
+// identity, 403 Forbidden if the selected rule does not allow the peer or no
+// rule selects the request. format selects the body of those responses.
+//
+// Paths are cleaned before matching ("." and ".." segments resolved), and the
+// wrapped handler receives the cleaned path, so "/api/../admin" is both
+// authorized and routed as "/admin".
+//
+// Example:
+//
+//	authz := spiffehttp.RequireRules(spiffehttp.ErrorFormatAuto,
+//	    spiffehttp.Rule{PathPrefix: "/admin", IDPatterns: []*spiffehttp.IDPattern{opsPattern}},
+//	    spiffehttp.Rule{PathPrefix: "/api", Methods: []string{"GET"}, TrustDomains: []spiffeid.TrustDomain{corp}},
+//	)
+//	handler := authz(mux)
+func RequireRules(format ErrorFormat, rules ...Rule) func(http.Handler) http.Handler {
+	rules = slices.Clone(rules)
+	deny := Policy{ErrorFormat: format}
+	return func(next http.Handler) http.Handler {
+		// One Require handler per rule, so requests only select one
+		handlers := make([]http.Handler, len(rules))
+		for i, rule := range rules {
+			handlers[i] = Require(Policy{
+				IDs:          rule.IDs,
+				TrustDomains: rule.TrustDomains,
+				IDPatterns:   rule.IDPatterns,
+				ErrorFormat:  format,
+				rule:         fmt.Sprintf("rules[%d]", i),
+			})(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := cleanPath(r.URL.Path)
+			if path != r.URL.Path {
+				r = r.Clone(r.Context())
+				r.URL.Path, r.URL.RawPath = path, ""
+			}
+			for i, rule := range rules {
+				if rule.matches(path, r.Method) {
+					handlers[i].ServeHTTP(w, r)
+					return
+				}
+			}
+
+			peer, ok := PeerFromContext(r.Context())
+			if !ok {
+				peer, ok = PeerFromRequest(r)
+			}
+			if !ok {
+				deny.deny(w, r, spiffeid.ID{}, http.StatusUnauthorized, "no verified SPIFFE identity")
+				return
+			}
+			deny.deny(w, r, peer.ID, http.StatusForbidden, fmt.Sprintf("no authorization rule allows %s %s", r.Method, path))
+		})
+	}
+}
+
+// cleanPath resolves "." and ".." segments like path.Clean, keeping a
+// trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	cleaned := pathpkg.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// Decision is the outcome of an authorization check by Require or
+// RequireRules, reported to the hook set with WithDecisionHook.
+type Decision struct {
+	// Allowed reports whether the request was passed to the handler.
+	Allowed bool
+
+	// Status is the response status of a denied request: 401 Unauthorized
+	// or 403 Forbidden. It is 0 for allowed requests.
+	Status int
+
+	// PeerID is the client's SPIFFE ID, or the zero ID if it has none.
+	PeerID spiffeid.ID
+
+	// Rule names the RequireRules rule that decided the request, such as
+	// "rules[2]". It is empty for Require and when no rule selected the
+	// request.
+	Rule string
+
+	// Reason explains a denial.
+	Reason string
+}
+
+// context key type (unexported) to avoid collisions with keys from other packages.
+type decisionHookCtxKey struct{}
+
+var decisionHookKey = decisionHookCtxKey{}
+
+// WithDecisionHook returns a context that makes Require and RequireRules call
+// hook with every decision they make for a request carrying it. Use it to
+// audit authorization from a middleware in front of them:
+//
+//	func audit(next http.Handler) http.Handler {
+//	    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//	        ctx := spiffehttp.WithDecisionHook(r.Context(), func(d spiffehttp.Decision) {
+//	            log.Printf("%s %s peer=%s allowed=%t reason=%q", r.Method, r.URL.Path, d.PeerID, d.Allowed, d.Reason)
+//	        })
+//	        next.ServeHTTP(w, r.WithContext(ctx))
+//	    })
+//	}
+func WithDecisionHook(ctx context.Context, hook func(Decision)) context.Context {
+	return context.WithValue(ctx, decisionHookKey, hook)
+}
+
+// reportDecision passes d to the hook in r's context, if any.
+func reportDecision(r *http.Request, d Decision) {
+	if hook, ok := r.Context().Value(decisionHookKey).(func(Decision)); ok && hook != nil {
+		hook(d)
+	}
+}
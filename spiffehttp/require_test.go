@@ -0,0 +1,360 @@
+package spiffehttp_test
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+// requestFrom returns a request from peer, or from an unauthenticated client
+// if peer is empty.
+func requestFrom(method, target, peer string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	if peer != "" {
+		r = r.WithContext(spiffehttp.WithPeer(r.Context(), spiffehttp.Peer{ID: spiffeid.RequireFromString(peer)}))
+	}
+	return r
+}
+
+// echoPath answers 200 with the path the handler received and any captured
+// ID values.
+var echoPath = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if _, ok := spiffehttp.PeerFromContext(r.Context()); !ok {
+		http.Error(w, "no peer in context", http.StatusInternalServerError)
+		return
+	}
+	vars, _ := spiffehttp.IDVarsFromContext(r.Context())
+	w.Header().Set("X-Namespace", vars["namespace"])
+	_, _ = w.Write([]byte(r.URL.Path))
+})
+
+func mustPattern(t *testing.T, s string) *spiffehttp.IDPattern {
+	t.Helper()
+	p, err := spiffehttp.ParseIDPattern(s)
+	if err != nil {
+		t.Fatalf("ParseIDPattern(%q) error = %v", s, err)
+	}
+	return p
+}
+
+func TestRequire(t *testing.T) {
+	admin := spiffeid.RequireFromString("spiffe://example.org/ops/admin")
+	partner := spiffeid.RequireTrustDomainFromString("partner.org")
+	workloads := mustPattern(t, "spiffe://example.org/ns/{namespace}/sa/*")
+
+	tests := []struct {
+		name       string
+		policy     spiffehttp.Policy
+		method     string
+		peer       string
+		wantStatus int
+		wantBody   string
+		wantNS     string
+	}{
+		{
+			name:       "no identity",
+			policy:     spiffehttp.Policy{IDs: []spiffeid.ID{admin}},
+			peer:       "",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "no verified SPIFFE identity",
+		},
+		{
+			name:       "empty policy allows any peer",
+			policy:     spiffehttp.Policy{},
+			peer:       "spiffe://other.org/anyone",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "exact ID",
+			policy:     spiffehttp.Policy{IDs: []spiffeid.ID{admin}},
+			peer:       admin.String(),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "ID not allowed",
+			policy:     spiffehttp.Policy{IDs: []spiffeid.ID{admin}},
+			peer:       "spiffe://example.org/ops/viewer",
+			wantStatus: http.StatusForbidden,
+			wantBody:   `SPIFFE ID "spiffe://example.org/ops/viewer" is not allowed`,
+		},
+		{
+			name:       "trust domain",
+			policy:     spiffehttp.Policy{TrustDomains: []spiffeid.TrustDomain{partner}},
+			peer:       "spiffe://partner.org/billing",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "pattern with capture",
+			policy:     spiffehttp.Policy{IDPatterns: []*spiffehttp.IDPattern{workloads}},
+			peer:       "spiffe://example.org/ns/prod/sa/api",
+			wantStatus: http.StatusOK,
+			wantNS:     "prod",
+		},
+		{
+			name:       "pattern not matching",
+			policy:     spiffehttp.Policy{IDPatterns: []*spiffehttp.IDPattern{workloads}},
+			peer:       "spiffe://example.org/ns/prod",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "allowed method",
+			policy:     spiffehttp.Policy{Methods: []string{"GET", "HEAD"}},
+			method:     http.MethodHead,
+			peer:       admin.String(),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "method not allowed",
+			policy:     spiffehttp.Policy{Methods: []string{"GET"}},
+			method:     http.MethodPost,
+			peer:       admin.String(),
+			wantStatus: http.StatusForbidden,
+			wantBody:   "method POST is not allowed",
+		},
+		{
+			name:       "methods are case-sensitive",
+			policy:     spiffehttp.Policy{Methods: []string{"get"}},
+			method:     http.MethodGet,
+			peer:       admin.String(),
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := httptest.NewRecorder()
+			spiffehttp.Require(tt.policy)(echoPath).ServeHTTP(rec, requestFrom(method, "/admin", tt.peer))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body, tt.wantBody)
+			}
+			if got := rec.Header().Get("X-Namespace"); got != tt.wantNS {
+				t.Errorf("captured namespace = %q, want %q", got, tt.wantNS)
+			}
+		})
+	}
+}
+
+func TestRequire_ErrorFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      spiffehttp.ErrorFormat
+		accept      string
+		wantProblem bool
+	}{
+		{"auto without Accept", spiffehttp.ErrorFormatAuto, "", false},
+		{"auto with JSON Accept", spiffehttp.ErrorFormatAuto, "application/json", true},
+		{"auto with problem+json Accept", spiffehttp.ErrorFormatAuto, "application/problem+json, */*", true},
+		{"auto with HTML Accept", spiffehttp.ErrorFormatAuto, "text/html", false},
+		{"plain despite JSON Accept", spiffehttp.ErrorFormatPlain, "application/json", false},
+		{"problem+json without Accept", spiffehttp.ErrorFormatProblemJSON, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := spiffehttp.Policy{
+				IDs:         []spiffeid.ID{spiffeid.RequireFromString("spiffe://example.org/admin")},
+				ErrorFormat: tt.format,
+			}
+			req := requestFrom(http.MethodGet, "/admin", "spiffe://example.org/viewer")
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			spiffehttp.Require(policy)(echoPath).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want 403", rec.Code)
+			}
+			if !tt.wantProblem {
+				if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+					t.Errorf("Content-Type = %q, want text/plain", ct)
+				}
+				if want := "Forbidden: SPIFFE ID"; !strings.HasPrefix(rec.Body.String(), want) {
+					t.Errorf("body = %q, want it to start with %q", rec.Body, want)
+				}
+				return
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", ct)
+			}
+			if got := rec.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+			}
+			var problem map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+			}
+			want := map[string]any{
+				"type":   "about:blank",
+				"title":  "Forbidden",
+				"status": float64(http.StatusForbidden),
+				"detail": `SPIFFE ID "spiffe://example.org/viewer" is not allowed`,
+			}
+			if !maps.Equal(problem, want) {
+				t.Errorf("problem = %v, want %v", problem, want)
+			}
+		})
+	}
+}
+
+func TestRequireRules(t *testing.T) {
+	ops := spiffeid.RequireFromString("spiffe://example.org/ops")
+	corp := spiffeid.RequireTrustDomainFromString("example.org")
+	authz := spiffehttp.RequireRules(spiffehttp.ErrorFormatPlain,
+		spiffehttp.Rule{PathPrefix: "/admin", IDs: []spiffeid.ID{ops}},
+		spiffehttp.Rule{PathPrefix: "/api/", Methods: []string{"GET"}, TrustDomains: []spiffeid.TrustDomain{corp}},
+		spiffehttp.Rule{PathPrefix: "/api/", Methods: []string{"POST"}, IDs: []spiffeid.ID{ops}},
+		spiffehttp.Rule{PathPrefix: "/public"},
+	)(echoPath)
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		peer       string
+		wantStatus int
+		wantPath   string
+		wantRule   string
+		wantBody   string
+	}{
+		{
+			name:   "no identity",
+			method: "GET", target: "/public", peer: "",
+			wantStatus: http.StatusUnauthorized, wantRule: "rules[3]",
+		},
+		{
+			name:   "no identity and no rule",
+			method: "GET", target: "/other", peer: "",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "exact prefix",
+			method: "GET", target: "/admin", peer: ops.String(),
+			wantStatus: http.StatusOK, wantPath: "/admin", wantRule: "rules[0]",
+		},
+		{
+			name:   "below the prefix",
+			method: "DELETE", target: "/admin/users/1", peer: ops.String(),
+			wantStatus: http.StatusOK, wantPath: "/admin/users/1", wantRule: "rules[0]",
+		},
+		{
+			name:   "prefix matches whole segments only",
+			method: "GET", target: "/administrator", peer: ops.String(),
+			wantStatus: http.StatusForbidden, wantBody: "no authorization rule allows GET /administrator",
+		},
+		{
+			name:   "selected rule denies the peer",
+			method: "GET", target: "/admin", peer: "spiffe://example.org/viewer",
+			wantStatus: http.StatusForbidden, wantRule: "rules[0]",
+		},
+		{
+			name:   "method selects the rule",
+			method: "GET", target: "/api/orders", peer: "spiffe://example.org/viewer",
+			wantStatus: http.StatusOK, wantPath: "/api/orders", wantRule: "rules[1]",
+		},
+		{
+			name:   "method selects a stricter rule",
+			method: "POST", target: "/api/orders", peer: "spiffe://example.org/viewer",
+			wantStatus: http.StatusForbidden, wantRule: "rules[2]",
+		},
+		{
+			name:   "no rule for the method",
+			method: "PUT", target: "/api/orders", peer: ops.String(),
+			wantStatus: http.StatusForbidden, wantBody: "no authorization rule allows PUT /api/orders",
+		},
+		{
+			name:   "trailing slash prefix does not match the bare path",
+			method: "GET", target: "/api", peer: ops.String(),
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:   "dot-dot is resolved before matching",
+			method: "GET", target: "/public/../admin", peer: "spiffe://example.org/viewer",
+			wantStatus: http.StatusForbidden, wantRule: "rules[0]",
+		},
+		{
+			name:   "handler receives the cleaned path",
+			method: "GET", target: "/public/./a/../b/", peer: "spiffe://example.org/viewer",
+			wantStatus: http.StatusOK, wantPath: "/public/b/", wantRule: "rules[3]",
+		},
+		{
+			name:   "encoded dot-dot is resolved too",
+			method: "GET", target: "/public/%2e%2e/admin", peer: "spiffe://example.org/viewer",
+			wantStatus: http.StatusForbidden, wantRule: "rules[0]",
+		},
+		{
+			name:   "default deny",
+			method: "GET", target: "/", peer: ops.String(),
+			wantStatus: http.StatusForbidden, wantBody: "no authorization rule allows GET /",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decisions []spiffehttp.Decision
+			req := requestFrom(tt.method, tt.target, tt.peer)
+			req = req.WithContext(spiffehttp.WithDecisionHook(req.Context(), func(d spiffehttp.Decision) {
+				decisions = append(decisions, d)
+			}))
+			rec := httptest.NewRecorder()
+			authz.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantPath != "" && rec.Body.String() != tt.wantPath {
+				t.Errorf("handler path = %q, want %q", rec.Body, tt.wantPath)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", rec.Body, tt.wantBody)
+			}
+
+			if len(decisions) != 1 {
+				t.Fatalf("decisions = %+v, want exactly one", decisions)
+			}
+			d := decisions[0]
+			if d.Allowed != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("Decision.Allowed = %t for status %d", d.Allowed, tt.wantStatus)
+			}
+			if !d.Allowed && d.Status != tt.wantStatus {
+				t.Errorf("Decision.Status = %d, want %d", d.Status, tt.wantStatus)
+			}
+			if d.Rule != tt.wantRule {
+				t.Errorf("Decision.Rule = %q, want %q", d.Rule, tt.wantRule)
+			}
+			if !d.Allowed && d.Reason == "" {
+				t.Error("Decision.Reason is empty for a denial")
+			}
+			if tt.peer != "" && d.PeerID.String() != tt.peer {
+				t.Errorf("Decision.PeerID = %q, want %q", d.PeerID, tt.peer)
+			}
+		})
+	}
+}
+
+func TestRequireRules_CopiesRules(t *testing.T) {
+	rules := []spiffehttp.Rule{{PathPrefix: "/public"}}
+	authz := spiffehttp.RequireRules(spiffehttp.ErrorFormatPlain, rules...)(echoPath)
+	rules[0].PathPrefix = "/other"
+
+	rec := httptest.NewRecorder()
+	authz.ServeHTTP(rec, requestFrom(http.MethodGet, "/public", "spiffe://example.org/a"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200: changing the caller's slice must not change the rules", rec.Code)
+	}
+}
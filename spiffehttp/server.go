@@ -5,31 +5,75 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
-	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
 	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 )
 
 // ServerConfig configures an mTLS server's identity verification policy.
 //
+// A client is allowed if it matches any configured ID, trust domain or ID
+// pattern.
 // The zero value is valid and enforces: any client in the same trust domain
 // as the server is allowed.
 type ServerConfig struct {
-	// AllowedClientID restricts connections to clients with this exact SPIFFE ID.
+	// AllowedClientID allows clients with this exact SPIFFE ID.
 	// Example: "spiffe://example.org/client"
-	//
-	// Mutually exclusive with AllowedClientTrustDomain.
-	// If both are empty, any client in the server's trust domain is allowed.
 	AllowedClientID string
 
+	// AllowedClientIDs allows clients with any of these exact SPIFFE IDs.
+	// Combined with AllowedClientID.
+	AllowedClientIDs []string
+
 	// AllowedClientTrustDomain allows any client in the specified trust domain.
 	// Example: "example.org"
-	//
-	// Mutually exclusive with AllowedClientID.
-	// If both are empty, any client in the server's trust domain is allowed.
 	AllowedClientTrustDomain string
+
+	// AllowedClientTrustDomains allows any client in any of these trust domains.
+	// Combined with AllowedClientTrustDomain.
+	AllowedClientTrustDomains []string
+
+	// AllowedClientIDPatterns allows clients whose SPIFFE ID matches any of
+	// these patterns (see IDPattern). Use IDVarsFromContext to read the values
+	// captured by the pattern.
+	// Example: "spiffe://prod.corp/ns/{namespace}/sa/billing-*"
+	AllowedClientIDPatterns []string
+
+	// Authorizer is an optional custom decision, combined with the policy
+	// above (or the same-trust-domain default) as AuthorizerComposition says.
+	Authorizer Authorizer
+
+	// AuthorizerComposition selects how Authorizer is combined with the
+	// policy. Defaults to RequireBoth.
+	AuthorizerComposition Composition
+
+	// DenyList optionally rejects clients before any other check. A denied
+	// client is rejected even if the policy or Authorizer would accept it.
+	DenyList *DenyList
+
+	// OnHandshake, if set, is called after every client verification with
+	// the outcome, for audit logs and diagnostics. It runs during the
+	// handshake, so it must be fast and safe for concurrent use.
+	//
+	// Setting it makes the returned config advertise the ALPN protocols
+	// "h2" and "http/1.1" itself. If the http.Server does not speak HTTP/2,
+	// set NextProtos on the returned config to ServerNextProtos(server)
+	// before serving, or HTTP/2 clients fail.
+	OnHandshake func(HandshakeInfo)
+}
+
+// policy parses the allowed client settings into a peer policy.
+func (cfg ServerConfig) policy() (*peerPolicy, error) {
+	return newPeerPolicy(
+		policyEntries(cfg.AllowedClientID, "AllowedClientID", cfg.AllowedClientIDs, "AllowedClientIDs"),
+		policyEntries(cfg.AllowedClientTrustDomain, "AllowedClientTrustDomain", cfg.AllowedClientTrustDomains, "AllowedClientTrustDomains"),
+		policyEntries("", "", cfg.AllowedClientIDPatterns, "AllowedClientIDPatterns"),
+	)
 }
 
 // NewServerTLSConfig creates a TLS configuration for an mTLS server.
@@ -43,10 +87,22 @@ type ServerConfig struct {
 //
 // The returned *tls.Config is safe to use directly in net/http Server.
 //
-// Client verification policy (evaluated in order):
-//  1. If cfg.AllowedClientID is set: only that exact SPIFFE ID is accepted
-//  2. If cfg.AllowedClientTrustDomain is set: any SPIFFE ID in that trust domain is accepted
-//  3. If both are empty: any client in the same trust domain as the server is accepted
+// Client verification policy:
+//  1. A client whose SPIFFE ID equals AllowedClientID or any of
+//     AllowedClientIDs is accepted
+//  2. A client in AllowedClientTrustDomain or any of
+//     AllowedClientTrustDomains is accepted
+//  3. A client whose SPIFFE ID matches any of AllowedClientIDPatterns is
+//     accepted
+//  4. If nothing is configured: any client in the same trust domain as the
+//     server is accepted
+//
+// If cfg.Authorizer is set, it is combined with the result of the rules
+// above: with RequireBoth the client must also pass the Authorizer, with
+// RequireEither passing the Authorizer alone is enough. The Authorizer only
+// sees clients whose certificates chain to the trust bundle.
+//
+// If cfg.DenyList is set, a client it denies is rejected in every case.
 //
 // The svidSource and bundleSource parameters must not be nil. They provide:
 //   - Server's identity certificate (fetched dynamically at handshake time)
@@ -81,7 +137,7 @@ type ServerConfig struct {
 //
 // Returns error if:
 //   - svidSource or bundleSource is nil
-//   - Both AllowedClientID and AllowedClientTrustDomain are set
+//   - An allowed client ID, trust domain or ID pattern is malformed
 //   - Initial certificate fetch fails
 //   - Server certificate has no SPIFFE ID
 func NewServerTLSConfig(ctx context.Context, svidSource x509svid.Source, bundleSource x509bundle.Source, cfg ServerConfig) (*tls.Config, error) {
@@ -96,10 +152,52 @@ func NewServerTLSConfig(ctx context.Context, svidSource x509svid.Source, bundleS
 
 	tlsCfg := tlsconfig.MTLSServerConfig(svidSource, bundleSource, authorizer)
 	tlsCfg.MinVersion = tls.VersionTLS13
+	if cfg.OnHandshake != nil {
+		// Handshakes use per-connection copies of tlsCfg, which do not see
+		// the ALPN protocols http.Server adds to its own copy
+		tlsCfg.NextProtos = []string{"h2", "http/1.1"}
+		observeHandshakes(tlsCfg, bundleSource, authorizer, cfg.OnHandshake)
+	}
 
 	return tlsCfg, nil
 }
 
+// ServerNextProtos returns the ALPN protocols srv negotiates over TLS, as
+// ServeTLS adds them to its own copy of TLSConfig: "h2" if HTTP/2 is enabled,
+// then "http/1.1", after any other protocols already in
+// srv.TLSConfig.NextProtos.
+//
+// HTTP/2 is disabled by srv.Protocols without HTTP/2, by a non-nil
+// srv.TLSNextProto without an "h2" entry, or by GODEBUG=http2server=0.
+func ServerNextProtos(srv *http.Server) []string {
+	var http1, http2 bool
+	if p := srv.Protocols; p != nil {
+		http2 = p.HTTP2()
+		// Like net/http, an empty set means HTTP/1 only
+		http1 = p.HTTP1() || (!p.HTTP2() && !p.UnencryptedHTTP2())
+	} else {
+		_, hasH2 := srv.TLSNextProto["h2"]
+		http1 = true
+		http2 = hasH2 || (srv.TLSNextProto == nil && !slices.Contains(strings.Split(os.Getenv("GODEBUG"), ","), "http2server=0"))
+	}
+
+	var protos []string
+	if http2 {
+		protos = append(protos, "h2")
+	}
+	if srv.TLSConfig != nil {
+		for _, p := range srv.TLSConfig.NextProtos {
+			if p != "h2" && p != "http/1.1" {
+				protos = append(protos, p)
+			}
+		}
+	}
+	if http1 {
+		protos = append(protos, "http/1.1")
+	}
+	return protos
+}
+
 func validateServerInputs(ctx context.Context, svidSource x509svid.Source, bundleSource x509bundle.Source, cfg ServerConfig) error {
 	switch {
 	case ctx == nil:
@@ -108,51 +206,26 @@ func validateServerInputs(ctx context.Context, svidSource x509svid.Source, bundl
 		return errors.New("svidSource cannot be nil")
 	case bundleSource == nil:
 		return errors.New("bundleSource cannot be nil")
-	case cfg.AllowedClientID != "" && cfg.AllowedClientTrustDomain != "":
-		return errors.New("AllowedClientID and AllowedClientTrustDomain are mutually exclusive")
-	}
-
-	// Validate SPIFFE ID format
-	if cfg.AllowedClientID != "" {
-		if _, err := spiffeid.FromString(cfg.AllowedClientID); err != nil {
-			return fmt.Errorf("invalid AllowedClientID: %w", err)
-		}
-	}
-
-	// Validate trust domain format
-	if cfg.AllowedClientTrustDomain != "" {
-		if _, err := spiffeid.TrustDomainFromString(cfg.AllowedClientTrustDomain); err != nil {
-			return fmt.Errorf("invalid AllowedClientTrustDomain: %w", err)
-		}
 	}
 
-	return nil
+	// Validate SPIFFE ID and trust domain formats
+	_, err := cfg.policy()
+	return err
 }
 
 func buildServerAuthorizer(svidSource x509svid.Source, cfg ServerConfig) (tlsconfig.Authorizer, error) {
-	switch {
-	case cfg.AllowedClientID != "":
-		// Policy 1: Exact SPIFFE ID match
-		id, err := spiffeid.FromString(cfg.AllowedClientID)
-		if err != nil {
-			return nil, fmt.Errorf("invalid AllowedClientID: %w", err)
-		}
-		return tlsconfig.AuthorizeID(id), nil
-
-	case cfg.AllowedClientTrustDomain != "":
-		// Policy 2: Trust domain match (explicit)
-		td, err := spiffeid.TrustDomainFromString(cfg.AllowedClientTrustDomain)
-		if err != nil {
-			return nil, fmt.Errorf("invalid AllowedClientTrustDomain: %w", err)
-		}
-		return tlsconfig.AuthorizeMemberOf(td), nil
+	policy, err := cfg.policy()
+	if err != nil {
+		return nil, err
+	}
+	if !policy.empty() {
+		return withDenyList(cfg.DenyList, compose(policy.authorizer(), cfg.Authorizer, cfg.AuthorizerComposition)), nil
+	}
 
-	default:
-		// Policy 3: Same trust domain as server (default)
-		svid, err := svidSource.GetX509SVID()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get server SVID: %w", err)
-		}
-		return tlsconfig.AuthorizeMemberOf(svid.ID.TrustDomain()), nil
+	// Default: same trust domain as server
+	svid, err := svidSource.GetX509SVID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server SVID: %w", err)
 	}
+	return withDenyList(cfg.DenyList, compose(tlsconfig.AuthorizeMemberOf(svid.ID.TrustDomain()), cfg.Authorizer, cfg.AuthorizerComposition)), nil
 }
@@ -0,0 +1,61 @@
+package spiffehttp_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/sufield/e5s/spiffehttp"
+)
+
+func TestServerNextProtos(t *testing.T) {
+	noHTTP2 := new(http.Protocols)
+	noHTTP2.SetHTTP1(true)
+
+	tests := []struct {
+		name  string
+		setup func(s *http.Server)
+		want  []string
+	}{
+		{
+			name:  "defaults",
+			setup: func(*http.Server) {},
+			want:  []string{"h2", "http/1.1"},
+		},
+		{
+			name: "HTTP/2 disabled by an empty TLSNextProto",
+			setup: func(s *http.Server) {
+				s.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+			},
+			want: []string{"http/1.1"},
+		},
+		{
+			name:  "HTTP/2 disabled by Protocols",
+			setup: func(s *http.Server) { s.Protocols = noHTTP2 },
+			want:  []string{"http/1.1"},
+		},
+		{
+			name:  "empty Protocols means HTTP/1 only",
+			setup: func(s *http.Server) { s.Protocols = new(http.Protocols) },
+			want:  []string{"http/1.1"},
+		},
+		{
+			name: "other protocols are kept",
+			setup: func(s *http.Server) {
+				s.TLSConfig = &tls.Config{NextProtos: []string{"http/1.1", "acme-tls/1", "h2"}}
+			},
+			want: []string{"h2", "acme-tls/1", "http/1.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &http.Server{}
+			tt.setup(srv)
+			if got := spiffehttp.ServerNextProtos(srv); !slices.Equal(got, tt.want) {
+				t.Errorf("ServerNextProtos() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package spire
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// DevIdentityEnv is the environment variable that must be set to "1" or
+// "true" for NewDevSource to run. It keeps dev identities out of production.
+const DevIdentityEnv = "E5S_ALLOW_DEV_IDENTITY"
+
+// DefaultDevSVIDTTL is how long dev SVIDs are valid if DevConfig.SVIDTTL is zero.
+const DefaultDevSVIDTTL = time.Hour
+
+// devCAValidity is how long the dev CA certificate of a process is valid.
+const devCAValidity = 365 * 24 * time.Hour
+
+// DevSource issues short-lived X.509 SVIDs from a local CA, so servers and
+// clients run locally without SPIRE.
+//
+// DevSource implements x509svid.Source and x509bundle.Source, like
+// FileSource.
+//
+// CA key:
+//
+//	By default the CA key is generated randomly and kept in memory. All
+//	DevSources of a process for the same trust domain share it, so a server
+//	and a client in one process trust each other; other processes do not.
+//	For several processes to trust each other, point them at the same
+//	DevConfig.CAKeyFile: the first one creates it, with permissions 0600.
+//	Anyone able to read that file can issue SVIDs the processes trust.
+//
+// The CA has none of SPIRE's attestation or key protection: DevSource must
+// never be used outside local development, and NewDevSource refuses to run
+// unless DevIdentityEnv is set.
+//
+// Rotation:
+//
+//	A new SVID, with a new key, is issued at half the lifetime of the
+//	current one.
+//
+// Thread-safety: All methods are safe for concurrent use.
+type DevSource struct {
+	identityStore
+	id     spiffeid.ID
+	ttl    time.Duration
+	caKey  ed25519.PrivateKey
+	caCert *x509.Certificate
+	logf   func(format string, args ...any)
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// DevConfig configures a dev identity source.
+type DevConfig struct {
+	// ID is the SPIFFE ID issued to the process. Its trust domain names the CA.
+	ID spiffeid.ID
+
+	// SVIDTTL is how long each SVID is valid. If zero, DefaultDevSVIDTTL is used.
+	SVIDTTL time.Duration
+
+	// CAKeyFile is the PEM file holding the CA key, shared by the processes
+	// that must trust each other. It is created if it does not exist.
+	// If empty, the process uses its own random CA key.
+	CAKeyFile string
+
+	// Logf, if set, receives a warning when the source is created and a
+	// message when an SVID fails to rotate. If nil, nothing is logged.
+	Logf func(format string, args ...any)
+}
+
+// NewDevSource creates the dev CA for cfg.ID's trust domain, issues a first
+// SVID and starts rotating it.
+//
+// Returns error if:
+//   - Context is nil
+//   - DevIdentityEnv is not set to "1" or "true"
+//   - cfg.ID is zero
+//   - cfg.CAKeyFile cannot be read, created or parsed
+//
+// ctx controls the lifetime of the background rotation, like for
+// NewIdentitySource: it runs until ctx is canceled or Close is called.
+func NewDevSource(ctx context.Context, cfg DevConfig) (*DevSource, error) {
+	if ctx == nil {
+		return nil, errors.New("context cannot be nil")
+	}
+	if v := os.Getenv(DevIdentityEnv); v != "1" && !strings.EqualFold(v, "true") {
+		return nil, fmt.Errorf("dev identities are insecure and only for local development; set %s=1 to allow them", DevIdentityEnv)
+	}
+	if cfg.ID.IsZero() {
+		return nil, errors.New("SPIFFE ID must be set")
+	}
+	if cfg.SVIDTTL == 0 {
+		cfg.SVIDTTL = DefaultDevSVIDTTL
+	}
+
+	caKey, caCert, err := devCA(cfg.ID.TrustDomain(), cfg.CAKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &DevSource{
+		identityStore: identityStore{
+			bundle: x509bundle.FromX509Authorities(cfg.ID.TrustDomain(), []*x509.Certificate{caCert}),
+		},
+		id:     cfg.ID,
+		ttl:    cfg.SVIDTTL,
+		caKey:  caKey,
+		caCert: caCert,
+		logf:   cfg.Logf,
+		done:   make(chan struct{}),
+	}
+	svid, err := s.issue(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	s.svid = svid
+
+	logf(cfg.Logf, "WARNING: using dev identity %s from an insecure local CA; never use it in production", cfg.ID)
+
+	rotateCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	go s.rotate(rotateCtx)
+	return s, nil
+}
+
+// Close stops rotating the SVID. After Close, GetX509SVID and
+// GetX509BundleForTrustDomain return an error.
+//
+// Idempotent: safe to call multiple times.
+func (s *DevSource) Close() error {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		<-s.done
+		s.close()
+	})
+	return nil
+}
+
+// rotate issues a new SVID at half the lifetime of the current one until ctx
+// is done.
+func (s *DevSource) rotate(ctx context.Context) {
+	defer close(s.done)
+	timer := time.NewTimer(s.ttl / 2)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-timer.C:
+			svid, err := s.issue(now)
+			if err != nil {
+				// Signing with an in-memory key does not fail in practice;
+				// keep the current SVID and try again shortly
+				logf(s.logf, "failed to rotate dev SVID: %v", err)
+				timer.Reset(time.Second)
+				continue
+			}
+			// The bundle never changes after NewDevSource
+			s.set(svid, s.bundle)
+			timer.Reset(s.ttl / 2)
+		}
+	}
+}
+
+// issue creates an SVID for s.id valid from now for s.ttl.
+func (s *DevSource) issue(now time.Time) (*x509svid.SVID, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate dev SVID key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate dev SVID serial number: %w", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"e5s dev"}},
+		URIs:         []*url.URL{s.id.URL()},
+		// Tolerate small clock differences between local processes
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(s.ttl),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.caCert, &key.PublicKey, s.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue dev SVID: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue dev SVID: %w", err)
+	}
+	return &x509svid.SVID{
+		ID:           s.id,
+		Certificates: []*x509.Certificate{cert},
+		PrivateKey:   key,
+	}, nil
+}
+
+// devCAs holds the random CA of each trust domain used by the process
+// without a CA key file.
+var devCAs = struct {
+	sync.Mutex
+	m map[spiffeid.TrustDomain]processDevCA
+}{m: make(map[spiffeid.TrustDomain]processDevCA)}
+
+// processDevCA is a CA in devCAs.
+type processDevCA struct {
+	key  ed25519.PrivateKey
+	cert *x509.Certificate
+}
+
+// devCA returns the CA key of td and a certificate for it: the key in
+// keyFile if set, otherwise the process's random key for td.
+func devCA(td spiffeid.TrustDomain, keyFile string) (ed25519.PrivateKey, *x509.Certificate, error) {
+	if keyFile != "" {
+		key, err := loadDevCAKey(filepath.Clean(keyFile))
+		if err != nil {
+			return nil, nil, err
+		}
+		cert, err := newDevCACert(td, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, cert, nil
+	}
+
+	devCAs.Lock()
+	defer devCAs.Unlock()
+	if ca, ok := devCAs.m[td]; ok {
+		return ca.key, ca.cert, nil
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate dev CA key: %w", err)
+	}
+	cert, err := newDevCACert(td, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	devCAs.m[td] = processDevCA{key: key, cert: cert}
+	return key, cert, nil
+}
+
+// loadDevCAKey reads the CA key in path, creating it if the file does not
+// exist.
+func loadDevCAKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - CA key path is trusted (from admin/user)
+	if errors.Is(err, fs.ErrNotExist) {
+		return createDevCAKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dev CA key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("invalid dev CA key %s: no PEM PRIVATE KEY block", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dev CA key %s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid dev CA key %s: want an Ed25519 key, got %T", path, key)
+	}
+	return edKey, nil
+}
+
+// createDevCAKey writes a new random CA key to path. The key is written to a
+// temporary file and then linked into place, so processes starting together
+// never read a partial file; the ones losing the race use the winner's key.
+func createDevCAKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate dev CA key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode dev CA key: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".e5s-dev-ca-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dev CA key: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dev CA key: %w", err)
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return loadDevCAKey(path)
+		}
+		return nil, fmt.Errorf("failed to create dev CA key: %w", err)
+	}
+	return key, nil
+}
+
+// newDevCACert returns a self-signed CA certificate for key. Processes
+// sharing the key create equivalent certificates, which verify each other's
+// SVIDs.
+func newDevCACert(td spiffeid.TrustDomain, key ed25519.PrivateKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate dev CA serial number: %w", err)
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"e5s dev"}, CommonName: "e5s dev CA " + td.Name()},
+		URIs:                  []*url.URL{td.ID().URL()},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(devCAValidity),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dev CA: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dev CA: %w", err)
+	}
+	return cert, nil
+}
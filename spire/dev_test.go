@@ -0,0 +1,174 @@
+package spire
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// TestNewDevSource_RequiresEnv verifies that dev identities are refused
+// unless explicitly allowed.
+func TestNewDevSource_RequiresEnv(t *testing.T) {
+	for _, value := range []string{"", "0", "false", "yes"} {
+		t.Setenv(DevIdentityEnv, value)
+		src, err := NewDevSource(context.Background(), DevConfig{ID: spiffeid.RequireFromString("spiffe://example.org/api")})
+		if err == nil {
+			_ = src.Close()
+			t.Fatalf("NewDevSource() with %s=%q should fail", DevIdentityEnv, value)
+		}
+		if !strings.Contains(err.Error(), DevIdentityEnv) {
+			t.Errorf("NewDevSource() error = %q, want it to name %s", err, DevIdentityEnv)
+		}
+	}
+}
+
+// TestNewDevSource verifies the issued SVID and that sources of the same
+// process and trust domain trust each other.
+func TestNewDevSource(t *testing.T) {
+	t.Setenv(DevIdentityEnv, "1")
+	id := spiffeid.RequireFromString("spiffe://example.org/api")
+
+	server, err := NewDevSource(context.Background(), DevConfig{ID: id, SVIDTTL: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("NewDevSource() error = %v", err)
+	}
+	defer server.Close()
+
+	svid, err := server.GetX509SVID()
+	if err != nil {
+		t.Fatalf("GetX509SVID() error = %v", err)
+	}
+	if svid.ID != id {
+		t.Errorf("SVID ID = %s, want %s", svid.ID, id)
+	}
+	if lifetime := time.Until(svid.Certificates[0].NotAfter); lifetime > 10*time.Minute {
+		t.Errorf("SVID valid for %v, want at most the 10m TTL", lifetime)
+	}
+
+	client, err := NewDevSource(context.Background(), DevConfig{ID: spiffeid.RequireFromString("spiffe://example.org/client")})
+	if err != nil {
+		t.Fatalf("NewDevSource() error = %v", err)
+	}
+	defer client.Close()
+	if !verifies(t, svid, client) {
+		t.Error("SVID does not verify against the bundle of another dev source of the process")
+	}
+
+	// A different trust domain has a different CA
+	other, err := NewDevSource(context.Background(), DevConfig{ID: spiffeid.RequireFromString("spiffe://other.org/api")})
+	if err != nil {
+		t.Fatalf("NewDevSource() error = %v", err)
+	}
+	defer other.Close()
+	otherSVID, err := other.GetX509SVID()
+	if err != nil {
+		t.Fatalf("GetX509SVID() error = %v", err)
+	}
+	if verifies(t, otherSVID, client) {
+		t.Error("SVID of another trust domain verified against the example.org bundle")
+	}
+}
+
+// TestNewDevSource_CAKeyFile verifies that only sources sharing a CA key file
+// trust each other, as separate processes would.
+func TestNewDevSource_CAKeyFile(t *testing.T) {
+	t.Setenv(DevIdentityEnv, "1")
+	keyFile := filepath.Join(t.TempDir(), "dev-ca.pem")
+	newSource := func(id, keyFile string) *DevSource {
+		t.Helper()
+		src, err := NewDevSource(context.Background(), DevConfig{ID: spiffeid.RequireFromString(id), CAKeyFile: keyFile})
+		if err != nil {
+			t.Fatalf("NewDevSource() error = %v", err)
+		}
+		t.Cleanup(func() { _ = src.Close() })
+		return src
+	}
+
+	server := newSource("spiffe://example.org/api", keyFile)
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("CA key file was not created: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("CA key file permissions = %v, want 0600", perm)
+	}
+	svid, err := server.GetX509SVID()
+	if err != nil {
+		t.Fatalf("GetX509SVID() error = %v", err)
+	}
+
+	if !verifies(t, svid, newSource("spiffe://example.org/client", keyFile)) {
+		t.Error("SVID does not verify against a source sharing the CA key file")
+	}
+	if verifies(t, svid, newSource("spiffe://example.org/client", filepath.Join(t.TempDir(), "other-ca.pem"))) {
+		t.Error("SVID verified against a source with another CA key file")
+	}
+	if verifies(t, svid, newSource("spiffe://example.org/client", "")) {
+		t.Error("SVID verified against a source with the process's random CA key")
+	}
+
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if src, err := NewDevSource(context.Background(), DevConfig{ID: spiffeid.RequireFromString("spiffe://example.org/api"), CAKeyFile: keyFile}); err == nil {
+		_ = src.Close()
+		t.Error("NewDevSource() with an invalid CA key file should fail")
+	}
+}
+
+// verifies reports whether svid verifies against the bundle of src.
+func verifies(t *testing.T, svid *x509svid.SVID, src *DevSource) bool {
+	t.Helper()
+	bundle, err := src.GetX509BundleForTrustDomain(svid.ID.TrustDomain())
+	if err != nil {
+		// Another trust domain: the source has no bundle for it
+		return false
+	}
+	_, _, err = x509svid.Verify(svid.Certificates, bundle)
+	return err == nil
+}
+
+// TestDevSource_Rotation verifies that SVIDs are renewed before they expire.
+func TestDevSource_Rotation(t *testing.T) {
+	t.Setenv(DevIdentityEnv, "true")
+	src, err := NewDevSource(context.Background(), DevConfig{
+		ID:      spiffeid.RequireFromString("spiffe://example.org/api"),
+		SVIDTTL: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewDevSource() error = %v", err)
+	}
+	defer src.Close()
+
+	first, err := src.GetX509SVID()
+	if err != nil {
+		t.Fatalf("GetX509SVID() error = %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		svid, err := src.GetX509SVID()
+		if err != nil {
+			t.Fatalf("GetX509SVID() error = %v", err)
+		}
+		if svid.Certificates[0].SerialNumber.Cmp(first.Certificates[0].SerialNumber) != 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("SVID was not rotated")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := src.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if _, err := src.GetX509SVID(); err == nil {
+		t.Error("GetX509SVID() after Close() should fail")
+	}
+}
@@ -0,0 +1,268 @@
+package spire
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// DefaultFilePollInterval is how often a FileSource checks its files for
+// changes if FileConfig.PollInterval is zero.
+const DefaultFilePollInterval = 2 * time.Second
+
+// FileSource provides a SPIFFE X.509 identity from PEM files on disk, for
+// workloads without access to a Workload API whose SVIDs are written by
+// spiffe-helper, cert-manager's csi-driver-spiffe or a similar agent.
+//
+// FileSource implements x509svid.Source and x509bundle.Source, so it can be
+// passed to spiffehttp.NewServerTLSConfig and NewClientTLSConfig in place of
+// IdentitySource.X509Source().
+//
+// Rotation:
+//
+//	The files are polled every FileConfig.PollInterval. Content is compared
+//	rather than modification times, so Kubernetes volume updates that swap
+//	a symlink are picked up too. A new SVID and bundle are only used once the
+//	certificate, key and bundle files all parse, the key matches the
+//	certificate and the certificate verifies against the bundle. Writers
+//	replace the files one at a time, so until then the previous identity
+//	keeps being served: connections never see a certificate paired with the
+//	wrong key or bundle.
+//
+// Trust Domain Federation:
+//
+//	Like IdentitySource, only the bundle of the SVID's own trust domain is
+//	provided.
+//
+// Thread-safety: All methods are safe for concurrent use.
+type FileSource struct {
+	identityStore
+	cfg FileConfig
+
+	// last is the file content behind the current SVID and bundle, only
+	// accessed by the watcher
+	last fileContent
+	// reloadFailed is set while the files do not form a valid identity, so
+	// the error is logged once rather than on every poll
+	reloadFailed bool
+
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// FileConfig configures a file identity source.
+type FileConfig struct {
+	// CertFile is the PEM file holding the X.509 SVID certificate chain,
+	// leaf first (svid.pem for spiffe-helper, tls.crt for csi-driver-spiffe).
+	CertFile string
+
+	// KeyFile is the PEM file holding the SVID's private key in PKCS#8,
+	// SEC 1 (EC) or PKCS#1 (RSA) form (svid_key.pem for spiffe-helper,
+	// tls.key for csi-driver-spiffe).
+	KeyFile string
+
+	// BundleFile is the PEM file holding the trust bundle's CA certificates
+	// (svid_bundle.pem for spiffe-helper, ca.crt for csi-driver-spiffe).
+	BundleFile string
+
+	// PollInterval is how often the files are checked for changes.
+	// If zero, DefaultFilePollInterval is used.
+	PollInterval time.Duration
+
+	// Logf, if set, receives a message when the files are reloaded or fail
+	// to reload. If nil, nothing is logged.
+	Logf func(format string, args ...any)
+}
+
+// fileContent is the raw content of a FileSource's files.
+type fileContent struct {
+	cert, key, bundle []byte
+}
+
+// NewFileSource loads an identity from the files in cfg and starts watching
+// them for rotation.
+//
+// The initial load must succeed. Returns error if:
+//   - Context is nil
+//   - A file path is empty or a file cannot be read
+//   - The certificate or key cannot be parsed, or they do not match
+//   - The certificate is not an X.509 SVID, or does not verify against the bundle
+//
+// ctx controls the lifetime of the background watcher, like for
+// NewIdentitySource: it runs until ctx is canceled or Close is called.
+func NewFileSource(ctx context.Context, cfg FileConfig) (*FileSource, error) {
+	if ctx == nil {
+		return nil, errors.New("context cannot be nil")
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" || cfg.BundleFile == "" {
+		return nil, errors.New("certificate, key and bundle files must all be set")
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = DefaultFilePollInterval
+	}
+	cfg.CertFile = filepath.Clean(cfg.CertFile)
+	cfg.KeyFile = filepath.Clean(cfg.KeyFile)
+	cfg.BundleFile = filepath.Clean(cfg.BundleFile)
+
+	content, err := readFiles(cfg)
+	if err != nil {
+		return nil, err
+	}
+	svid, bundle, err := parseFiles(content)
+	if err != nil {
+		return nil, err
+	}
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	s := &FileSource{
+		identityStore: identityStore{svid: svid, bundle: bundle},
+		cfg:           cfg,
+		last:          content,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+	}
+	go s.watch(watchCtx)
+	return s, nil
+}
+
+// Close stops watching the files. After Close, GetX509SVID and
+// GetX509BundleForTrustDomain return an error.
+//
+// Idempotent: safe to call multiple times.
+func (s *FileSource) Close() error {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		<-s.done
+		s.close()
+	})
+	return nil
+}
+
+// watch polls the files until ctx is done.
+func (s *FileSource) watch(ctx context.Context) {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reload()
+		}
+	}
+}
+
+// reload re-reads the files and swaps in the new identity if their content
+// changed and forms a valid identity.
+func (s *FileSource) reload() {
+	content, err := readFiles(s.cfg)
+	if err == nil && content.equal(s.last) {
+		return
+	}
+	var svid *x509svid.SVID
+	var bundle *x509bundle.Bundle
+	if err == nil {
+		svid, bundle, err = parseFiles(content)
+	}
+	if err != nil {
+		if !s.reloadFailed {
+			logf(s.cfg.Logf, "failed to reload identity files, keeping previous SVID (retrying every %v): %v", s.cfg.PollInterval, err)
+			s.reloadFailed = true
+		}
+		return
+	}
+
+	s.set(svid, bundle)
+	s.last = content
+	s.reloadFailed = false
+	logf(s.cfg.Logf, "reloaded identity files: SVID %s valid until %s",
+		svid.ID, svid.Certificates[0].NotAfter.UTC().Format(time.RFC3339))
+}
+
+// readFiles reads the files of cfg.
+func readFiles(cfg FileConfig) (fileContent, error) {
+	var c fileContent
+	for _, f := range []struct {
+		path string
+		dst  *[]byte
+	}{
+		{cfg.CertFile, &c.cert},
+		{cfg.KeyFile, &c.key},
+		{cfg.BundleFile, &c.bundle},
+	} {
+		data, err := os.ReadFile(f.path) // #nosec G304 - Identity file paths are trusted (from admin/user)
+		if err != nil {
+			return fileContent{}, fmt.Errorf("failed to read identity file: %w", err)
+		}
+		*f.dst = data
+	}
+	return c, nil
+}
+
+// parseFiles parses the SVID and bundle from c and checks that they belong
+// together.
+func parseFiles(c fileContent) (*x509svid.SVID, *x509bundle.Bundle, error) {
+	key, err := pkcs8Key(c.key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid SVID key: %w", err)
+	}
+	svid, err := x509svid.Parse(c.cert, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid SVID certificate or key: %w", err)
+	}
+	bundle, err := x509bundle.Parse(svid.ID.TrustDomain(), c.bundle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid trust bundle: %w", err)
+	}
+	if bundle.Empty() {
+		return nil, nil, errors.New("invalid trust bundle: no CA certificates")
+	}
+	if _, _, err := x509svid.Verify(svid.Certificates, bundle); err != nil {
+		return nil, nil, fmt.Errorf("SVID does not verify against the trust bundle: %w", err)
+	}
+	return svid, bundle, nil
+}
+
+// pkcs8Key converts a PEM encoded SEC 1 or PKCS#1 private key to PKCS#8,
+// the only form x509svid.Parse accepts. Other keys are returned unchanged.
+func pkcs8Key(keyPEM []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return keyPEM, nil
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return keyPEM, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// equal reports whether c and o have the same content.
+func (c fileContent) equal(o fileContent) bool {
+	return bytes.Equal(c.cert, o.cert) && bytes.Equal(c.key, o.key) && bytes.Equal(c.bundle, o.bundle)
+}
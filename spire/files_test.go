@@ -0,0 +1,291 @@
+package spire
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+// testCA issues X.509 SVIDs for file source tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		URIs:                  []*url.URL{{Scheme: "spiffe", Host: "example.org"}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// bundlePEM returns the CA certificate in PEM form.
+func (ca *testCA) bundlePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// issue returns a PEM certificate and PKCS#8 key for an SVID with the given path.
+func (ca *testCA) issue(t *testing.T, path string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(30 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		URIs:         []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: path}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeIdentityFiles writes an SVID and bundle to dir and returns their config.
+func writeIdentityFiles(t *testing.T, dir string, certPEM, keyPEM, bundlePEM []byte) FileConfig {
+	t.Helper()
+	cfg := FileConfig{
+		CertFile:   filepath.Join(dir, "svid.pem"),
+		KeyFile:    filepath.Join(dir, "svid_key.pem"),
+		BundleFile: filepath.Join(dir, "svid_bundle.pem"),
+	}
+	for path, data := range map[string][]byte{cfg.CertFile: certPEM, cfg.KeyFile: keyPEM, cfg.BundleFile: bundlePEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+// TestNewFileSource verifies that the SVID and bundle are loaded from files.
+func TestNewFileSource(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "/workload")
+	cfg := writeIdentityFiles(t, t.TempDir(), certPEM, keyPEM, ca.bundlePEM())
+
+	src, err := NewFileSource(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewFileSource() error = %v", err)
+	}
+	defer src.Close()
+
+	svid, err := src.GetX509SVID()
+	if err != nil {
+		t.Fatalf("GetX509SVID() error = %v", err)
+	}
+	if got := svid.ID.String(); got != "spiffe://example.org/workload" {
+		t.Errorf("SVID ID = %s, want spiffe://example.org/workload", got)
+	}
+
+	bundle, err := src.GetX509BundleForTrustDomain(spiffeid.RequireTrustDomainFromString("example.org"))
+	if err != nil {
+		t.Fatalf("GetX509BundleForTrustDomain() error = %v", err)
+	}
+	if !bundle.HasX509Authority(ca.cert) {
+		t.Error("bundle does not contain the CA certificate")
+	}
+	if _, err := src.GetX509BundleForTrustDomain(spiffeid.RequireTrustDomainFromString("other.org")); err == nil {
+		t.Error("GetX509BundleForTrustDomain() for a foreign trust domain should fail")
+	}
+}
+
+// TestNewFileSource_ECKey verifies that SEC 1 encoded EC keys are accepted.
+func TestNewFileSource_ECKey(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "/workload")
+	block, _ := pem.Decode(keyPEM)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(key.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER})
+	cfg := writeIdentityFiles(t, t.TempDir(), certPEM, ecPEM, ca.bundlePEM())
+
+	src, err := NewFileSource(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewFileSource() with an EC key error = %v", err)
+	}
+	_ = src.Close()
+}
+
+// TestNewFileSource_Errors verifies that invalid identity files are rejected.
+func TestNewFileSource_Errors(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "/workload")
+	_, otherKeyPEM := ca.issue(t, "/other")
+
+	tests := []struct {
+		name    string
+		cfg     func(dir string) FileConfig
+		wantErr string
+	}{
+		{
+			name: "missing file",
+			cfg: func(dir string) FileConfig {
+				cfg := writeIdentityFiles(t, dir, certPEM, keyPEM, ca.bundlePEM())
+				cfg.KeyFile = filepath.Join(dir, "missing.pem")
+				return cfg
+			},
+			wantErr: "failed to read identity file",
+		},
+		{
+			name: "empty path",
+			cfg: func(dir string) FileConfig {
+				cfg := writeIdentityFiles(t, dir, certPEM, keyPEM, ca.bundlePEM())
+				cfg.BundleFile = ""
+				return cfg
+			},
+			wantErr: "must all be set",
+		},
+		{
+			name: "key does not match certificate",
+			cfg: func(dir string) FileConfig {
+				return writeIdentityFiles(t, dir, certPEM, otherKeyPEM, ca.bundlePEM())
+			},
+			wantErr: "invalid SVID certificate or key",
+		},
+		{
+			name: "bundle from another CA",
+			cfg: func(dir string) FileConfig {
+				return writeIdentityFiles(t, dir, certPEM, keyPEM, otherCA.bundlePEM())
+			},
+			wantErr: "does not verify against the trust bundle",
+		},
+		{
+			name: "empty bundle",
+			cfg: func(dir string) FileConfig {
+				return writeIdentityFiles(t, dir, certPEM, keyPEM, nil)
+			},
+			wantErr: "invalid trust bundle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := NewFileSource(context.Background(), tt.cfg(t.TempDir()))
+			if err == nil {
+				_ = src.Close()
+				t.Fatalf("NewFileSource() expected error containing %q, got nil", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewFileSource() error = %q, want error containing %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestFileSource_Rotation verifies that rewritten files are picked up, and
+// that a partially written identity keeps the previous one in use.
+func TestFileSource_Rotation(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "/v1")
+	dir := t.TempDir()
+	cfg := writeIdentityFiles(t, dir, certPEM, keyPEM, ca.bundlePEM())
+	cfg.PollInterval = 10 * time.Millisecond
+
+	src, err := NewFileSource(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewFileSource() error = %v", err)
+	}
+	defer src.Close()
+
+	currentID := func() string {
+		svid, err := src.GetX509SVID()
+		if err != nil {
+			t.Fatalf("GetX509SVID() error = %v", err)
+		}
+		return svid.ID.String()
+	}
+
+	// Only the certificate is rewritten: it does not match the old key
+	newCertPEM, newKeyPEM := ca.issue(t, "/v2")
+	if err := os.WriteFile(cfg.CertFile, newCertPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * cfg.PollInterval)
+	if got := currentID(); got != "spiffe://example.org/v1" {
+		t.Fatalf("SVID ID after a partial write = %s, want the previous spiffe://example.org/v1", got)
+	}
+
+	if err := os.WriteFile(cfg.KeyFile, newKeyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for currentID() != "spiffe://example.org/v2" {
+		if time.Now().After(deadline) {
+			t.Fatal("rotated SVID was not picked up")
+		}
+		time.Sleep(cfg.PollInterval)
+	}
+}
+
+// TestFileSource_Close verifies that Close is idempotent and that the source
+// is unusable afterwards.
+func TestFileSource_Close(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "/workload")
+	cfg := writeIdentityFiles(t, t.TempDir(), certPEM, keyPEM, ca.bundlePEM())
+
+	src, err := NewFileSource(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewFileSource() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := src.Close(); err != nil {
+			t.Errorf("Close() #%d error = %v", i+1, err)
+		}
+	}
+	if _, err := src.GetX509SVID(); err == nil {
+		t.Error("GetX509SVID() after Close() should fail")
+	}
+	if _, err := src.GetX509BundleForTrustDomain(spiffeid.RequireTrustDomainFromString("example.org")); err == nil {
+		t.Error("GetX509BundleForTrustDomain() after Close() should fail")
+	}
+}
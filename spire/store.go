@@ -0,0 +1,65 @@
+package spire
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+)
+
+// errSourceClosed is returned by FileSource and DevSource after Close.
+var errSourceClosed = errors.New("identity source is closed")
+
+// logf calls fn with format and args, unless fn is nil.
+func logf(fn func(format string, args ...any), format string, args ...any) {
+	if fn != nil {
+		fn(format, args...)
+	}
+}
+
+// identityStore holds the current SVID and bundle of a source that rotates
+// them itself. Its methods implement x509svid.Source and x509bundle.Source
+// for the sources embedding it.
+type identityStore struct {
+	mu     sync.RWMutex
+	svid   *x509svid.SVID
+	bundle *x509bundle.Bundle
+	closed bool
+}
+
+// GetX509SVID returns the current X.509 SVID.
+func (s *identityStore) GetX509SVID() (*x509svid.SVID, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, errSourceClosed
+	}
+	return s.svid, nil
+}
+
+// GetX509BundleForTrustDomain returns the current trust bundle if td is the
+// SVID's trust domain.
+func (s *identityStore) GetX509BundleForTrustDomain(td spiffeid.TrustDomain) (*x509bundle.Bundle, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, errSourceClosed
+	}
+	return s.bundle.GetX509BundleForTrustDomain(td)
+}
+
+// set replaces the SVID and bundle together.
+func (s *identityStore) set(svid *x509svid.SVID, bundle *x509bundle.Bundle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.svid, s.bundle = svid, bundle
+}
+
+// close makes the getters fail from now on.
+func (s *identityStore) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+}